@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// accountHeader selects the linked account a request is made for, the same as the /api/accounts/:account path.
+const accountHeader = "X-Account"
+
+var (
+	errAccountNotLinked = errors.New("account is not linked")
+	errLinkPrimary      = errors.New("cannot link the account you are logged in with")
+)
+
+// identityAccount returns the account the token was issued for, the identity owning the linked accounts.
+func identityAccount(claims jwt.MapClaims) util.Account {
+	return util.NewAccount(claims["server"].(string), claims["username"].(string))
+}
+
+// activeAccount returns the account selected by the request, the identity itself when none is selected.
+func activeAccount(c *gin.Context, claims jwt.MapClaims) (util.Account, error) {
+	identity := identityAccount(claims)
+
+	id := c.Param("account")
+	if id == "" {
+		id = c.GetHeader(accountHeader)
+	}
+	if id == "" || id == identity.ID {
+		return identity, nil
+	}
+
+	account, ok := util.Accounts.Find(identity.Key(), id)
+	if !ok {
+		return util.Account{}, errAccountNotLinked
+	}
+	return account, nil
+}
+
+func accountResponse(account util.Account, primary bool) apimodel.Account {
+	_, connected := util.Clients.Get(account.Key())
+	return apimodel.Account{
+		ID:        account.ID,
+		Server:    account.Server,
+		Username:  account.Username,
+		Primary:   primary,
+		Connected: connected,
+	}
+}
+
+// AccountsHandler godoc
+// @Summary List your accounts
+// @Schemes
+// @Description Lists the account you are logged in with, together with the edupage accounts linked to it.
+// @Description Any /api route can be called for a linked account, using the X-Account header or the /api/accounts/{account} prefix.
+// @Tags accounts
+// @Security Bearer
+// @Param Authorization header string true "JWT token"
+// @Produce json
+// @Success 200 {object} apimodel.AccountsResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Router /accounts [get]
+func AccountsHandler(c *gin.Context) {
+	claims, err := getClaims(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	identity := identityAccount(claims)
+
+	accounts := []apimodel.Account{accountResponse(identity, true)}
+	for _, account := range util.Accounts.List(identity.Key()) {
+		accounts = append(accounts, accountResponse(account, false))
+	}
+
+	c.JSON(http.StatusOK, apimodel.AccountsResponse{Accounts: accounts})
+}
+
+// LinkAccountHandler godoc
+// @Summary Link an account
+// @Schemes
+// @Description Logs in to another edupage account and links it to the account you are logged in with.
+// @Description Linking an already linked account logs in to it again, e.g. after its session expired.
+// @Tags accounts
+// @Security Bearer
+// @Accept x-www-form-urlencoded
+// @Param Authorization header string true "JWT token"
+// @Param username formData string true "Username"
+// @Param password formData string true "Password"
+// @Param server formData string false "Server"
+// @Produce json
+// @Success 200 {object} apimodel.LinkAccountSuccessResponse
+// @Failure 400 {object} apimodel.LinkAccountErrorResponse
+// @Failure 401 {object} apimodel.LinkAccountErrorResponse
+// @Failure 500 {object} apimodel.LinkAccountErrorResponse
+// @Router /accounts [post]
+func LinkAccountHandler(c *gin.Context) {
+	claims, err := getClaims(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	identity := identityAccount(claims)
+
+	username := c.PostForm("username")
+	if username == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "username field is missing", "success": false})
+		return
+	}
+
+	password := c.PostForm("password")
+	if password == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "password field is missing", "success": false})
+		return
+	}
+
+	server := c.PostForm("server")
+	if server == "" {
+		server = "login1"
+	}
+
+	account := util.NewAccount(server, username)
+	if account.ID == identity.ID {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errLinkPrimary.Error(), "success": false})
+		return
+	}
+
+	h, err := loginEdupage(username, password, server)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	user, err := h.GetUserContext(c.Request.Context(), false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	// A live session of the account is kept together with the preferences of its owner, the login only proves the password.
+	// A new session of a linked account never stores any data, the preferences belong to the identity.
+	if _, ok := util.Clients.Get(util.SessionKey(server, username)); !ok {
+		if err := registerSession(server, username, h, &util.DataStorageConfig{}); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+	}
+
+	if err := util.Accounts.Link(identity.Key(), account); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"error":   "",
+		"success": true,
+		"name":    user.UserRow.Firstname + " " + user.UserRow.Lastname,
+		"account": accountResponse(account, false),
+	})
+}
+
+// UnlinkAccountHandler godoc
+// @Summary Unlink an account
+// @Schemes
+// @Description Unlinks the edupage account from the account you are logged in with.
+// @Tags accounts
+// @Security Bearer
+// @Param Authorization header string true "JWT token"
+// @Param account path string true "Account ID"
+// @Produce json
+// @Success 200 {object} apimodel.UnlinkAccountSuccessResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.LinkAccountErrorResponse
+// @Failure 500 {object} apimodel.LinkAccountErrorResponse
+// @Router /accounts/{account} [delete]
+func UnlinkAccountHandler(c *gin.Context) {
+	claims, err := getClaims(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	identity := identityAccount(claims)
+
+	ok, err := util.Accounts.Unlink(identity.Key(), c.Param("account"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errAccountNotLinked.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"error": "", "success": true})
+}
@@ -0,0 +1,33 @@
+package apimodel
+
+type Account struct {
+	// ID selects the account, in the X-Account header or the /api/accounts/{account} path
+	ID       string `json:"id" example:"3f1a9c2b7d4e"`
+	Server   string `json:"server" example:"gymnaziumxyz"`
+	Username string `json:"username" example:"jan.novak"`
+	// Primary is the account the user logged in with, the other accounts are linked to it
+	Primary bool `json:"primary" example:"true"`
+	// Connected is false when the server has no edupage session for the account
+	Connected bool `json:"connected" example:"true"`
+}
+
+type AccountsResponse struct {
+	Accounts []Account `json:"accounts"`
+}
+
+type LinkAccountSuccessResponse struct {
+	Success bool    `json:"success" example:"true"`
+	Error   string  `json:"error" example:""`
+	Name    string  `json:"name" example:"Jan Novák"`
+	Account Account `json:"account"`
+}
+
+type LinkAccountErrorResponse struct {
+	Success bool   `json:"success" example:"false"`
+	Error   string `json:"error" example:"account is not linked"`
+}
+
+type UnlinkAccountSuccessResponse struct {
+	Success bool   `json:"success" example:"true"`
+	Error   string `json:"error" example:""`
+}
@@ -0,0 +1,56 @@
+package apimodel
+
+import (
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+type Absence struct {
+	ID     string        `json:"id"`
+	Date   *time.Time    `json:"date"`
+	Period *model.Period `json:"period"`
+	// Subject is null when the absence isn't linked to a lesson
+	Subject *model.Subject           `json:"subject"`
+	Type    *model.StudentAbsentType `json:"type"`
+	// Status is one of excused, unexcused, pending or late
+	Status      string `json:"status" example:"excused"`
+	LateMinutes int    `json:"late_minutes"`
+	Note        string `json:"note"`
+	// Year and Half are the half of the school year the absence belongs to, empty without a date
+	Year string `json:"year" example:"2024"`
+	Half string `json:"half" example:"P1"`
+}
+
+// SubjectAttendance are the absences from the lessons of a subject.
+type SubjectAttendance struct {
+	Subject model.Subject `json:"subject"`
+	// Lessons is the number of the lessons in the timetable until today
+	Lessons int `json:"lessons"`
+	Absent  int `json:"absent"`
+	Late    int `json:"late"`
+	// Percent is the share of the lessons the student was absent from, the late arrivals aren't counted
+	Percent float64 `json:"percent"`
+}
+
+// AttendanceTotals are the absences in a half of a school year.
+type AttendanceTotals struct {
+	Year      string  `json:"year" example:"2024"`
+	Half      string  `json:"half" example:"P1"`
+	Lessons   int     `json:"lessons"`
+	Absent    int     `json:"absent"`
+	Excused   int     `json:"excused"`
+	Unexcused int     `json:"unexcused"`
+	Pending   int     `json:"pending"`
+	Late      int     `json:"late"`
+	Percent   float64 `json:"percent"`
+	// Subjects are ordered by their ID
+	Subjects []SubjectAttendance `json:"subjects"`
+}
+
+type AttendanceResponse struct {
+	// Absences are ordered from the newest one
+	Absences []Absence `json:"absences"`
+	// Halves contain the totals of the halves of the school year which have started
+	Halves []AttendanceTotals `json:"halves"`
+}
@@ -1,11 +1,14 @@
 package apimodel
 
 type LoginSuccessResponse struct {
-	Success   bool   `json:"success" example:"true"`
-	Error     string `json:"error" example:""`
-	Token     string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJzdWIiOiIxMjM"`
-	Firstname string `json:"firstname" example:"John"`
-	Lastname  string `json:"lastname" example:"Doe"`
+	Success bool   `json:"success" example:"true"`
+	Error   string `json:"error" example:""`
+	Token   string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJzdWIiOiIxMjM"`
+	// RefreshToken is empty when the server has no database to store refresh tokens in
+	RefreshToken string `json:"refreshToken" example:"qL8mB0n6Yb1VQ2z7wWkz3r7s9P1nJ4tF0cXh5dG2aE8"`
+	Expires      int64  `json:"expires" example:"1620000000"`
+	Firstname    string `json:"firstname" example:"John"`
+	Lastname     string `json:"lastname" example:"Doe"`
 }
 
 type LoginBadRequestResponse struct {
@@ -34,6 +37,36 @@ type ValidateTokenUnauthorizedResponse struct {
 	Error   string `json:"error" example:"Unauthorized"`
 }
 
+type RefreshTokenSuccessResponse struct {
+	Success      bool   `json:"success" example:"true"`
+	Error        string `json:"error" example:""`
+	Token        string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJzdWIiOiIxMjM"`
+	RefreshToken string `json:"refreshToken" example:"qL8mB0n6Yb1VQ2z7wWkz3r7s9P1nJ4tF0cXh5dG2aE8"`
+	Expires      int64  `json:"expires" example:"1620000000"`
+}
+
+type RevokeTokenSuccessResponse struct {
+	Success bool   `json:"success" example:"true"`
+	Error   string `json:"error" example:""`
+}
+
+type RefreshTokenErrorResponse struct {
+	Success bool   `json:"success" example:"false"`
+	Error   string `json:"error" example:"refresh token reuse detected, all tokens of this login were revoked"`
+}
+
+type LogoutSuccessResponse struct {
+	Success bool   `json:"success" example:"true"`
+	Error   string `json:"error" example:""`
+	// SessionEnded is false when there was no edupage session to end, or other devices of the user still use it
+	SessionEnded bool `json:"sessionEnded" example:"true"`
+}
+
+type LogoutErrorResponse struct {
+	Success bool   `json:"success" example:"false"`
+	Error   string `json:"error" example:"error adding token to denylist: connection refused"`
+}
+
 type UnauthorizedResponse struct {
 	Error string `json:"error" example:"Unauthorized"`
 }
@@ -49,3 +82,13 @@ type ICanteenBadRequestResponse struct {
 type ICanteenInternalErrorResponse struct {
 	Error string `json:"error" example:"failed to load lunches: failed to login: Post https://example.edupage.org/login/edubarLogin.php: dial tcp: lookup example.edupage.org: no such host"`
 }
+
+type QRLoginApproveResponse struct {
+	Success bool   `json:"success" example:"true"`
+	Error   string `json:"error" example:""`
+}
+
+type QRLoginErrorResponse struct {
+	Success bool   `json:"success" example:"false"`
+	Error   string `json:"error" example:"invalid or expired code"`
+}
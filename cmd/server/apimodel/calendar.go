@@ -0,0 +1,12 @@
+package apimodel
+
+type CalendarTokenResponse struct {
+	// Token is only returned once, a new token replaces the previous one
+	Token string `json:"token" example:"Zm9vYmFyYmF6..."`
+	// URL is the feed to subscribe to in a calendar app
+	URL string `json:"url" example:"https://example.com/calendar/Zm9vYmFyYmF6....ics"`
+}
+
+type CalendarTokenRevokeResponse struct {
+	Revoked bool `json:"revoked" example:"true"`
+}
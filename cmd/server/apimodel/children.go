@@ -0,0 +1,15 @@
+package apimodel
+
+import "github.com/DislikesSchool/EduPage2-server/edupage"
+
+type ChildrenResponse struct {
+	// Parent is false for student accounts, which have no children
+	Parent bool `json:"parent" example:"true"`
+	// Active is the ID of the child the data is returned for, the one selected by the request if any
+	Active   string          `json:"active" example:"1001"`
+	Children []edupage.Child `json:"children"`
+}
+
+type ChildErrorResponse struct {
+	Error string `json:"error" example:"not a parent account"`
+}
@@ -0,0 +1,41 @@
+package apimodel
+
+import "github.com/DislikesSchool/EduPage2-server/edupage/model"
+
+type FreeClassroomsPeriod struct {
+	Period     model.Period      `json:"period"`
+	Classrooms []model.Classroom `json:"classrooms"`
+}
+
+type FreeClassroomsResponse struct {
+	Date    string                 `json:"date" example:"2024-09-03"`
+	Periods []FreeClassroomsPeriod `json:"periods"`
+}
+
+type FreeTeachersPeriod struct {
+	Period   model.Period    `json:"period"`
+	Teachers []model.Teacher `json:"teachers"`
+}
+
+type FreeTeachersResponse struct {
+	Date    string               `json:"date" example:"2024-09-03"`
+	Periods []FreeTeachersPeriod `json:"periods"`
+}
+
+// TeacherFreeDay are the periods of a school day in which the teacher doesn't teach.
+type TeacherFreeDay struct {
+	Date    string         `json:"date" example:"2024-09-03"`
+	Periods []model.Period `json:"periods"`
+}
+
+type TeacherFreeTimeResponse struct {
+	Teacher model.Teacher `json:"teacher"`
+	// Days are the school days of the range, the days without lessons are left out
+	Days []TeacherFreeDay `json:"days"`
+}
+
+type FreeRequest struct {
+	Date string `json:"date" example:"2024-09-03T00:00:00Z" default:"today"`
+	// Period is the ID of the period, all periods of the day by default
+	Period string `json:"period" example:"3"`
+}
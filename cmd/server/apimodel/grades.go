@@ -0,0 +1,51 @@
+package apimodel
+
+import (
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/grades"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+// NeededGrade is the mark the next grade of the subject needs to reach the target average.
+type NeededGrade struct {
+	Target float64 `json:"target" example:"1.5"`
+	Weight float64 `json:"weight" example:"1"`
+	Mark   float64 `json:"mark" example:"1.25"`
+	// Reachable is false when even the best mark doesn't reach the target
+	Reachable bool `json:"reachable"`
+}
+
+type SubjectGrades struct {
+	grades.SubjectSummary
+	Subject *model.Subject `json:"subject"`
+	Grades  []grades.Grade `json:"grades"`
+	Needed  *NeededGrade   `json:"needed,omitempty"`
+}
+
+type GradesSummaryResponse struct {
+	// Average is the mean of the averages of the subjects
+	Average  float64         `json:"average" example:"1.75"`
+	Count    int             `json:"count"`
+	Subjects []SubjectGrades `json:"subjects"`
+}
+
+// GradeChange is a grade which has been added, modified or removed.
+type GradeChange struct {
+	ID         uint      `json:"id"`
+	DetectedAt time.Time `json:"detected_at"`
+	// Kind is one of added, modified or removed
+	Kind      string `json:"kind" example:"added"`
+	EventID   string `json:"event_id"`
+	SubjectID string `json:"subject_id"`
+	// Before is null for the added grades
+	Before *model.Event `json:"before"`
+	// After is null for the removed grades
+	After *model.Event `json:"after"`
+}
+
+type GradeChangesResponse struct {
+	Changes []GradeChange `json:"changes"`
+	// CheckedAt is the time the grades were compared, pass it as since to get the later changes
+	CheckedAt time.Time `json:"checked_at"`
+}
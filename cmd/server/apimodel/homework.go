@@ -0,0 +1,39 @@
+package apimodel
+
+import (
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+type Homework struct {
+	ID         string `json:"id"`
+	HomeworkID string `json:"homework_id"`
+	SuperID    string `json:"super_id"`
+	// TimelineID is the timeline item of the homework, it's empty when the item isn't on the requested timeline
+	TimelineID string         `json:"timeline_id"`
+	Type       string         `json:"type"`
+	Title      string         `json:"title"`
+	Details    string         `json:"details"`
+	Subject    *model.Subject `json:"subject"`
+	Author     string         `json:"author"`
+	Assigned   *time.Time     `json:"assigned"`
+	Due        *time.Time     `json:"due"`
+	// AllDay is set when only the day the homework is due is known, Due is midnight in that case
+	AllDay bool `json:"all_day"`
+	// Status is one of pending, done or overdue
+	Status string `json:"status" example:"pending"`
+	Done   bool   `json:"done"`
+	// DoneCount is the number of students who have marked the homework done
+	DoneCount int `json:"done_count"`
+}
+
+type HomeworkResponse struct {
+	Homework []Homework `json:"homework"`
+	// Counts are the numbers of homework by status, before the status filter is applied
+	Counts map[string]int `json:"counts"`
+}
+
+type HomeworkErrorResponse struct {
+	Error string `json:"error" example:"homework not found"`
+}
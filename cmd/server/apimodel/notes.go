@@ -0,0 +1,37 @@
+package apimodel
+
+import (
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+type Note struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+	// Kind is one of praise, reprimand or other
+	Kind string `json:"kind" example:"praise"`
+	// Type is the type of the note as sent by edupage
+	Type    string         `json:"type" example:"pochvala"`
+	Subject *model.Subject `json:"subject"`
+	Date    *time.Time     `json:"date"`
+	// Year and Half are the half of the school year the note belongs to, empty without a date
+	Year string `json:"year" example:"2024"`
+	Half string `json:"half" example:"P1"`
+}
+
+// NoteCounts are the numbers of the notes in a half of a school year.
+type NoteCounts struct {
+	Year      string `json:"year" example:"2024"`
+	Half      string `json:"half" example:"P1"`
+	Praise    int    `json:"praise"`
+	Reprimand int    `json:"reprimand"`
+	Other     int    `json:"other"`
+	Total     int    `json:"total"`
+}
+
+type NotesResponse struct {
+	Notes []Note `json:"notes"`
+	// Counts are the numbers of the notes by the half of the school year, before the kind filter is applied
+	Counts []NoteCounts `json:"counts"`
+}
@@ -0,0 +1,26 @@
+package apimodel
+
+type ReplyRequest struct {
+	Text         string `form:"text" json:"text"`
+	ToAuthorOnly bool   `form:"toAuthorOnly" json:"toAuthorOnly"`
+}
+
+type VoteRequest struct {
+	// Answers are the IDs of the chosen poll options
+	Answers []string `form:"answer" json:"answer"`
+}
+
+type ReplyResponse struct {
+	Success    bool   `json:"success" example:"true"`
+	TimelineID string `json:"timelineid" example:"900001"`
+}
+
+type ReactionResponse struct {
+	Success bool   `json:"success" example:"true"`
+	Error   string `json:"error" example:""`
+}
+
+type ReactionErrorResponse struct {
+	Success bool   `json:"success" example:"false"`
+	Error   string `json:"error" example:"the item is not a poll"`
+}
@@ -0,0 +1,37 @@
+package apimodel
+
+import (
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+// ThreadMessage is a message of a thread with its payload and the replies to it, ordered from the oldest.
+type ThreadMessage struct {
+	model.TimelineItem
+	Payload model.TimelineData `json:"payload"`
+	Unread  bool               `json:"unread"`
+	Replies []ThreadMessage    `json:"replies"`
+}
+
+type Thread struct {
+	ID string `json:"id"`
+	// Partial is set when the root message is a reply to a message outside of the requested range
+	Partial      bool                `json:"partial"`
+	MessageCount int                 `json:"message_count"`
+	UnreadCount  int                 `json:"unread_count"`
+	LastActivity time.Time           `json:"last_activity"`
+	ReadUntil    *time.Time          `json:"read_until"`
+	Participants []model.Participant `json:"participants"`
+	Root         ThreadMessage       `json:"root"`
+}
+
+type ThreadsResponse struct {
+	Threads []Thread `json:"threads"`
+	// NextCursor requests the next page, it's empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+type ThreadErrorResponse struct {
+	Error string `json:"error" example:"thread not found"`
+}
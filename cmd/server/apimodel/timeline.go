@@ -18,6 +18,23 @@ type TimelineItemReduced struct {
 	Removed       int                    `json:"removed"`
 }
 
+// TypedTimelineItem is a timeline item together with its payload decoded by the item type.
+type TypedTimelineItem struct {
+	model.TimelineItem
+	// Payload is one of the model.TimelineData structs, selected by "typ"
+	Payload model.TimelineData `json:"payload"`
+}
+
+type TypedHomework struct {
+	model.Homework
+	Payload *model.HomeworkData `json:"payload"`
+}
+
+type TypedTimeline struct {
+	Homeworks map[string]TypedHomework
+	Items     map[string]TypedTimelineItem
+}
+
 type TimelineItemWithOrigin struct {
 	ID              string                   `json:"timelineid"`
 	Timestamp       model.Time               `json:"timestamp"`
@@ -31,6 +48,7 @@ type TimelineItemWithOrigin struct {
 	TimeAdded       model.Time               `json:"cas_pridania"`
 	TimeEvent       model.Time               `json:"cas_udalosti"`
 	Data            model.StringJsonObject   `json:"data"`
+	Payload         model.TimelineData       `json:"payload"`
 	Owner           string                   `json:"vlastnik"`
 	OwnerName       string                   `json:"vlastnik_meno"`
 	ReactionCount   int                      `json:"poct_reakcii"`
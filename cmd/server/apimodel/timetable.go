@@ -26,3 +26,28 @@ type CompleteTimetableItem struct {
 	StudentIDs []string          `json:"studentids"`
 	Colors     []string          `json:"colors"`
 }
+
+type TimetableRangeRequest struct {
+	From string `json:"from" example:"2022-01-01T00:00:00Z" default:"today"`
+	To   string `json:"to" example:"2022-01-08T00:00:00Z" default:"a week from today"`
+}
+
+// TimetableChange is a lesson changed by a substitution.
+type TimetableChange struct {
+	Date   string `json:"date" example:"2024-09-02"`
+	Period string `json:"period" example:"1"`
+	// Kinds are cancelled or added, or any of substituted, moved and replaced
+	Kinds []string              `json:"kinds" example:"substituted"`
+	Type  *model.SubstitionType `json:"type"`
+	Note  string                `json:"note"`
+	// Subject, Teachers and Classrooms are the lesson after the change, the unchanged ones are copied from the original lesson
+	Subject    *model.Subject    `json:"subject"`
+	Teachers   []model.Teacher   `json:"teachers"`
+	Classrooms []model.Classroom `json:"classrooms"`
+	// Original is the lesson of the regular timetable, null for the added lessons
+	Original *CompleteTimetableItem `json:"original"`
+}
+
+type TimetableChangesResponse struct {
+	Changes []TimetableChange `json:"changes"`
+}
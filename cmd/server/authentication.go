@@ -3,14 +3,10 @@ package main
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
-	"io"
-	"math/rand"
+	"math"
 	"net/http"
-	"os"
 	"slices"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/DislikesSchool/EduPage2-server/cmd/server/crypto"
@@ -31,22 +27,100 @@ func getSecretKey() []byte {
 	return []byte(key)
 }
 
-func generateJWT(server string, username string) (string, error) {
-	expirationTime := time.Now().Add(time.Hour * 6)
+// accessTokenType is the "typ" claim of access tokens.
+const accessTokenType = "access"
 
+// generateJWT issues an access token valid for accessTokenTTL, returns the token and its expiration time.
+// The familyID links the token to the refresh tokens of the same login, it may be empty.
+func generateJWT(server string, username string, familyID string) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(accessTokenTTL())
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// iat has millisecond precision, so logging out everywhere does not revoke tokens issued right after it
 	claims := jwt.MapClaims{
 		"server":   server,
 		"username": username,
+		"typ":      accessTokenType,
+		"jti":      jti,
+		"iat":      float64(now.UnixMilli()) / 1000,
 		"exp":      expirationTime.Unix(),
 	}
+	if familyID != "" {
+		claims["fid"] = familyID
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(getSecretKey())
+	signedToken, err := signToken(claims)
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 
-	return signedToken, nil
+	return signedToken, expirationTime, nil
+}
+
+// parseAccessToken verifies the access token and returns its claims.
+func parseAccessToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, verificationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("token is expired")
+	}
+
+	// Tokens issued before refresh tokens were introduced have no type
+	if typ, ok := claims["typ"]; ok && typ != accessTokenType {
+		return nil, errors.New("invalid token type")
+	}
+
+	if _, ok := claims["server"].(string); !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	if _, ok := claims["username"].(string); !ok {
+		return nil, errors.New("invalid token claims")
+	}
+
+	if err := checkRevoked(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// checkRevoked rejects tokens which were revoked by logging out.
+func checkRevoked(claims jwt.MapClaims) error {
+	if jti, ok := claims["jti"].(string); ok {
+		revoked, err := util.IsTokenRevoked(jti)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return errTokenRevoked
+		}
+	}
+
+	before, err := util.TokensRevokedBefore(util.SessionKey(claims["server"].(string), claims["username"].(string)))
+	if err != nil {
+		return err
+	}
+	if !before.IsZero() {
+		// Tokens issued before refresh tokens were introduced have no iat
+		iat, _ := claims["iat"].(float64)
+		if time.UnixMilli(int64(math.Round(iat * 1000))).Before(before) {
+			return errTokenRevoked
+		}
+	}
+	return nil
 }
 
 func authMiddleware() gin.HandlerFunc {
@@ -65,35 +139,35 @@ func authMiddleware() gin.HandlerFunc {
 
 		tokenString := authHeaderParts[1]
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return getSecretKey(), nil
-		})
+		claims, err := parseAccessToken(tokenString)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
-
-		if _, ok := token.Claims.(jwt.MapClaims); !ok || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			return
-		}
+		// The handlers read the verified claims, see getClaims
+		c.Set("claims", claims)
 
 		client, dataStorage, err := clientFromContext(c)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			// clientFromContext has already responded with the matching status
+			if !c.IsAborted() {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			}
 			return
 		}
 		c.Set("client", client)
 		c.Set("dataStorage", dataStorage)
 
-		c.Next()
+		nextForChild(c, client)
 	}
 }
 
+// getClaims returns the claims verified by authMiddleware, or verifies the token outside of it.
 func getClaims(c *gin.Context) (jwt.MapClaims, error) {
+	if claims, ok := c.Get("claims"); ok {
+		return claims.(jwt.MapClaims), nil
+	}
+
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
 		return nil, errors.New("missing Authorization header")
@@ -101,19 +175,7 @@ func getClaims(c *gin.Context) (jwt.MapClaims, error) {
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return getSecretKey(), nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return nil, errors.New("invalid token claims")
-	}
-
-	return claims, nil
+	return parseAccessToken(tokenString)
 }
 
 type LoginData struct {
@@ -161,18 +223,16 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
-	var cred edupage.Credentials
-	var err error
 	if server == "" {
 		server = "login1"
 	}
 
-	u := util.Clients[server+username]
+	u, ok := util.Clients.Get(util.SessionKey(server, username))
 
-	if u != nil {
+	if ok {
 		passwordCorrect := edupage.CheckPasswordHash(password, u.Client.Credentials.PasswordHash)
 		if passwordCorrect {
-			user, err := u.Client.GetUser(false)
+			user, err := u.Client.GetUserContext(c.Request.Context(), false)
 			if err != nil {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 					"error":   err.Error(),
@@ -200,6 +260,7 @@ func LoginHandler(c *gin.Context) {
 						userModel.LastOnline = time.Now()
 						userModel.StoreMessages = dataStorage.Messages
 						userModel.StoreTimeline = dataStorage.Timeline
+						userModel.StoreGrades = dataStorage.Grades
 
 						if userModel.Password == "" {
 							var passwordToStore string
@@ -244,6 +305,7 @@ func LoginHandler(c *gin.Context) {
 							LastOnline:    time.Now(),
 							StoreMessages: dataStorage.Messages,
 							StoreTimeline: dataStorage.Timeline,
+							StoreGrades:   dataStorage.Grades,
 						}
 
 						if err := util.Db.Create(userModel).Error; err != nil {
@@ -257,16 +319,18 @@ func LoginHandler(c *gin.Context) {
 				}
 			}
 
-			token, err := generateJWT(server, username)
+			tokens, err := issueTokens(server, username)
 			if err != nil {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
 			c.JSON(http.StatusOK, gin.H{
-				"error":   "",
-				"success": true,
-				"name":    user.UserRow.Firstname + " " + user.UserRow.Lastname,
-				"token":   token,
+				"error":        "",
+				"success":      true,
+				"name":         user.UserRow.Firstname + " " + user.UserRow.Lastname,
+				"token":        tokens.AccessToken,
+				"refreshToken": tokens.RefreshToken,
+				"expires":      tokens.ExpiresAt.Unix(),
 			})
 			return
 		} else {
@@ -278,8 +342,7 @@ func LoginHandler(c *gin.Context) {
 		}
 	}
 
-	cred, err = edupage.Login(username, password, server)
-
+	h, err := loginEdupage(username, password, server)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"error":   err.Error(),
@@ -288,28 +351,7 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
-	schoolId := strings.Split(cred.Server, ".")[0]
-	if config.AppConfig.Schools.IsBlacklist {
-		if slices.Contains(config.AppConfig.Schools.Whitelist, schoolId) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "This school is blacklisted",
-				"success": false,
-			})
-			return
-		}
-	} else {
-		if !slices.Contains(config.AppConfig.Schools.Whitelist, schoolId) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error":   "This school is not whitelisted",
-				"success": false,
-			})
-			return
-		}
-	}
-
-	var h *edupage.EdupageClient
-	h, err = edupage.CreateClient(cred)
-
+	user, err := h.GetUserContext(c.Request.Context(), false)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"error":   err.Error(),
@@ -318,16 +360,7 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
-	user, err := h.GetUser(false)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-			"error":   err.Error(),
-			"success": false,
-		})
-		return
-	}
-
-	token, err := generateJWT(server, username)
+	tokens, err := issueTokens(server, username)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -376,6 +409,7 @@ func LoginHandler(c *gin.Context) {
 				userModel.LastOnline = time.Now()
 				userModel.StoreMessages = dataStorage.Messages
 				userModel.StoreTimeline = dataStorage.Timeline
+				userModel.StoreGrades = dataStorage.Grades
 
 				if err := util.Db.Save(userModel).Error; err != nil {
 					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user data: " + err.Error()})
@@ -389,6 +423,7 @@ func LoginHandler(c *gin.Context) {
 					LastOnline:    time.Now(),
 					StoreMessages: dataStorage.Messages,
 					StoreTimeline: dataStorage.Timeline,
+					StoreGrades:   dataStorage.Grades,
 				}
 
 				if err := util.Db.Create(newUser).Error; err != nil {
@@ -402,34 +437,59 @@ func LoginHandler(c *gin.Context) {
 		}
 	}
 
-	util.Clients[server+username] = &util.ClientData{
-		Client:      h,
-		DataStorage: dataStorage,
+	if err := registerSession(server, username, h, dataStorage); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"error":        "",
+		"success":      true,
+		"name":         user.UserRow.Firstname + " " + user.UserRow.Lastname,
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expires":      tokens.ExpiresAt.Unix(),
+	})
+}
+
+// loginEdupage logs in to edupage and creates the client, rejecting the schools which are not allowed.
+func loginEdupage(username, password, server string) (*edupage.EdupageClient, error) {
+	cred, err := edupage.LoginWithOptions(username, password, server, util.EdupageOptions)
+	if err != nil {
+		return nil, err
 	}
 
-	// The cron is kinda broken when run from the go test command
-	if os.Getenv("CI") == "" {
-		jobId, err := util.Cr.AddFunc("@every 10m", func() {
-			fmt.Println("Pinging", username, strings.Split(cred.Server, ".")[0])
-			success, err := h.PingSession()
-			if err != nil || !success {
-				fmt.Println("session ping failed")
-				util.Cr.Remove(util.Clients[server+username].CrJobId)
-				util.Clients[server+username] = nil
-			}
-		})
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+	schoolId := strings.Split(cred.Server, ".")[0]
+	if config.AppConfig.Schools.IsBlacklist {
+		if slices.Contains(config.AppConfig.Schools.Whitelist, schoolId) {
+			return nil, errors.New("This school is blacklisted")
+		}
+	} else {
+		if !slices.Contains(config.AppConfig.Schools.Whitelist, schoolId) {
+			return nil, errors.New("This school is not whitelisted")
 		}
-		util.Clients[server+username].CrJobId = jobId
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"error":   "",
-		"success": true,
-		"name":    user.UserRow.Firstname + " " + user.UserRow.Lastname,
-		"token":   token,
-	})
+
+	return edupage.CreateClient(cred)
+}
+
+// registerSession stores the client in the session registry, keeps it alive and persists it.
+func registerSession(server, username string, client *edupage.EdupageClient, dataStorage *util.DataStorageConfig) error {
+	key := util.SessionKey(server, username)
+	session := util.NewClientData(client, dataStorage)
+	if err := util.Clients.SchedulePing(key, session); err != nil {
+		return err
+	}
+	util.Clients.Set(key, session)
+
+	if err := util.PersistSession(key, session); err != nil {
+		util.LogUserSession("session persist", username, server, err)
+	}
+
+	// The DBI has just been loaded from edupage, the other users of the school get it too
+	if err := util.Schools.Refresh(client); err != nil {
+		util.LogUserSession("school cache", username, server, err)
+	}
+	return nil
 }
 
 func clientFromContext(c *gin.Context) (*edupage.EdupageClient, *util.DataStorageConfig, error) {
@@ -438,14 +498,20 @@ func clientFromContext(c *gin.Context) (*edupage.EdupageClient, *util.DataStorag
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return &edupage.EdupageClient{}, &util.DataStorageConfig{}, err
 	}
-	server := claims["server"].(string)
-	username := claims["username"].(string)
 
-	client, ok := util.Clients[server+username]
-	if !ok {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "client not found"})
+	account, err := activeAccount(c, claims)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		return &edupage.EdupageClient{}, &util.DataStorageConfig{}, err
 	}
+	c.Set("account", account)
+
+	client, ok := util.Clients.Get(account.Key())
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errClientNotFound.Error()})
+		return &edupage.EdupageClient{}, &util.DataStorageConfig{}, errClientNotFound
+	}
+	client.Touch()
 
 	return client.Client, client.DataStorage, nil
 }
@@ -470,12 +536,12 @@ func ValidateTokenHandler(c *gin.Context) {
 	username := claims["username"].(string)
 	exp := claims["exp"].(float64)
 
-	h, ok := util.Clients[server+username]
+	h, ok := util.Clients.Get(util.SessionKey(server, username))
 	if !ok {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "client not found"})
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errClientNotFound.Error()})
 		return
 	}
-	user, err := h.Client.GetUser(false)
+	user, err := h.Client.GetUserContext(c.Request.Context(), false)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"error":   err.Error(),
@@ -491,107 +557,3 @@ func ValidateTokenHandler(c *gin.Context) {
 		"expires": exp,
 	})
 }
-
-var (
-	sseclients = make(map[string]chan QRLoginData)
-	mu         sync.Mutex
-)
-
-type QRLoginData struct {
-	Code     string `json:"code"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Endpoint string `json:"endpoint"`
-	Server   string `json:"server"`
-}
-
-// QRLoginHandler godoc
-// @Summary Log in using a QR code
-// @Schemes
-// @Description Logs in using a QR code. This route uses Server-Sent Events (SSE).
-// @Tags auth
-// @Router /qrlogin [get]
-func QRLoginHandler(c *gin.Context) {
-	code := generateCode(8)
-	dataChannel := make(chan QRLoginData, 1)
-
-	mu.Lock()
-	sseclients[code] = dataChannel
-	mu.Unlock()
-
-	c.Writer.Header().Set("Content-Type", "text/event-stream")
-	c.Writer.Header().Set("Cache-Control", "no-cache")
-	c.Writer.Header().Set("Connection", "keep-alive")
-	c.Writer.Header().Set("Transfer-Encoding", "chunked")
-	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-
-	sentCode := false
-	c.Stream(func(w io.Writer) bool {
-		if !sentCode {
-			c.SSEvent("code", code)
-			sentCode = true
-		}
-		select {
-		case data := <-dataChannel:
-			c.SSEvent("data", data)
-			return false
-		default:
-			return true
-		}
-	})
-
-	mu.Lock()
-	delete(sseclients, code)
-	mu.Unlock()
-
-	close(dataChannel)
-
-	c.Status(http.StatusOK)
-}
-
-// FinishQRLoginHandler godoc
-// @Summary Finish QR login
-// @Schemes
-// @Description Finishes QR login by sending the login data to the client that initiated the SSE channel.
-// @Tags auth
-// @Param code path string true "Code"
-// @Param username formData string true "Username"
-// @Param password formData string true "Password"
-// @Param endpoint formData string true "Endpoint"
-// @Param server formData string true "Server"
-// @Router /qrlogin/:code [post]
-func FinishQRLoginHandler(c *gin.Context) {
-	code := c.Param("code")
-	username := c.PostForm("username")
-	password := c.PostForm("password")
-	endpoint := c.PostForm("endpoint")
-	server := c.PostForm("server")
-
-	mu.Lock()
-	dataChannel, ok := sseclients[code]
-	mu.Unlock()
-
-	if !ok {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid code"})
-		return
-	}
-
-	dataChannel <- QRLoginData{
-		Code:     code,
-		Username: username,
-		Password: password,
-		Endpoint: endpoint,
-		Server:   server,
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Login data sent"})
-}
-
-func generateCode(n int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	result := make([]byte, n)
-	for i := range result {
-		result[i] = letters[rand.Intn(len(letters))]
-	}
-	return string(result)
-}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/gin-gonic/gin"
+)
+
+// childHeader selects the child of a parent account the request is made for, the same as the child query parameter.
+const childHeader = "X-Child"
+
+// nextForChild runs the rest of the handlers for the child selected by the request.
+// The requests for the same child run concurrently, another child is selected on the edupage session once they return.
+// The ID of the active child is stored as "child" in the context, it is empty for students.
+func nextForChild(c *gin.Context, client *edupage.EdupageClient) {
+	child := c.GetHeader(childHeader)
+	if child == "" {
+		child = c.Query("child")
+	}
+
+	err := client.WithChild(c.Request.Context(), child, func() error {
+		if client.IsParent() {
+			active, err := client.GetStudentID()
+			if err != nil {
+				return err
+			}
+			c.Set("child", active)
+		}
+
+		c.Next()
+		return nil
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(childErrorStatus(err), gin.H{"error": err.Error()})
+	}
+}
+
+func childErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, edupage.ErrorNotParent):
+		return http.StatusBadRequest
+	case errors.Is(err, edupage.ErrorNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, edupage.ErrorUnauthorized):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
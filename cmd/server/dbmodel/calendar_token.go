@@ -0,0 +1,16 @@
+package dbmodel
+
+import (
+	"time"
+)
+
+// CalendarToken is the token of the calendar feed of an account, or of a child of a parent account.
+// Only the hash of the token is stored, every feed has at most one token.
+type CalendarToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	TokenHash string `gorm:"uniqueIndex;size:64;not null"`
+	Server    string `gorm:"uniqueIndex:idx_calendar_feed;not null"`
+	Username  string `gorm:"uniqueIndex:idx_calendar_feed;not null"`
+	Child     string `gorm:"uniqueIndex:idx_calendar_feed;not null"`
+}
@@ -0,0 +1,29 @@
+package dbmodel
+
+import (
+	"time"
+)
+
+// GradeSnapshot is the last known results of the owner in a half of a school year, e.g. "2024:P1".
+// The owner is the edupage user, or the child of a parent, the results belong to.
+type GradeSnapshot struct {
+	ID        uint `gorm:"primarykey"`
+	UpdatedAt time.Time
+	Owner     string `gorm:"uniqueIndex:idx_grade_snapshot;not null"`
+	Period    string `gorm:"uniqueIndex:idx_grade_snapshot;not null"`
+	// Results is the JSON encoded model.Results
+	Results string `gorm:"not null"`
+}
+
+// GradeChange is a grade added, modified or removed between two snapshots.
+type GradeChange struct {
+	ID         uint      `gorm:"primarykey"`
+	DetectedAt time.Time `gorm:"index;not null"`
+	Owner      string    `gorm:"index:idx_grade_change;not null"`
+	Period     string    `gorm:"index:idx_grade_change;not null"`
+	Kind       string    `gorm:"not null"`
+	EventID    string    `gorm:"not null"`
+	// Before and After are the JSON encoded model.Event, empty for the added and removed grades
+	Before string
+	After  string
+}
@@ -0,0 +1,15 @@
+package dbmodel
+
+import (
+	"time"
+)
+
+// LinkedAccount is an edupage account linked to an EduPage2 identity,
+// the identity is the session key of the account the user logged in with.
+type LinkedAccount struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Identity  string `gorm:"uniqueIndex:idx_linked_account;not null"`
+	Server    string `gorm:"uniqueIndex:idx_linked_account;not null"`
+	Username  string `gorm:"uniqueIndex:idx_linked_account;not null"`
+}
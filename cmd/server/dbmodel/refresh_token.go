@@ -0,0 +1,19 @@
+package dbmodel
+
+import (
+	"time"
+)
+
+// RefreshToken is an issued refresh token. Only the hash of the token is stored.
+// Every refresh rotates the token, the rotated tokens share the FamilyID of the login they originate from.
+type RefreshToken struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	TokenHash string    `gorm:"uniqueIndex;size:64;not null"`
+	FamilyID  string    `gorm:"index;size:64;not null"`
+	Server    string    `gorm:"not null"`
+	Username  string    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
@@ -0,0 +1,14 @@
+package dbmodel
+
+import (
+	"time"
+)
+
+// Session is a persisted edupage session, used when redis is not enabled.
+type Session struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	SessionKey string `gorm:"unique;not null"`
+	Data       string `gorm:"type:text;not null"`
+}
@@ -0,0 +1,15 @@
+package dbmodel
+
+import (
+	"time"
+)
+
+// ThreadRead marks the messages of a thread added until ReadAt as read.
+// The owner is the edupage user, or the child of a parent, the thread belongs to.
+type ThreadRead struct {
+	ID        uint `gorm:"primarykey"`
+	UpdatedAt time.Time
+	Owner     string    `gorm:"uniqueIndex:idx_thread_read;not null"`
+	ThreadID  string    `gorm:"uniqueIndex:idx_thread_read;not null"`
+	ReadAt    time.Time `gorm:"not null"`
+}
@@ -14,4 +14,5 @@ type User struct {
 	LastOnline    time.Time `gorm:"not null"`
 	StoreMessages bool      `gorm:"not null"`
 	StoreTimeline bool      `gorm:"not null"`
+	StoreGrades   bool      `gorm:"not null;default:false"`
 }
@@ -0,0 +1,421 @@
+// Package jwtkeys manages the asymmetric keys used to sign the JWT tokens.
+//
+// Every key is identified by its key ID (the "kid" header of the tokens). The newest key signs new tokens,
+// the older keys are kept for verification until all tokens signed by them have expired.
+// The public keys are published as a JSON Web Key Set, so other services can verify the tokens.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	rsaKeyBits     = 2048
+	createdHeader  = "Created"
+	reloadInterval = time.Minute
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a single signing key.
+type Key struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+
+	private crypto.Signer
+}
+
+// Public returns the public key used to verify the tokens signed by the key.
+func (k *Key) Public() crypto.PublicKey {
+	return k.private.Public()
+}
+
+// Options configure a KeySet.
+type Options struct {
+	// Algorithm of the signing key, AlgorithmRS256 or AlgorithmEdDSA.
+	Algorithm string
+	// Dir stores the keys as PEM files, so they survive restarts and can be shared between instances.
+	// The keys are kept only in memory when empty.
+	Dir string
+	// Rotation is the age after which a new signing key is created, zero disables the rotation.
+	Rotation time.Duration
+	// Retention is how long a replaced key is kept for verification, the lifetime of the tokens.
+	Retention time.Duration
+}
+
+// KeySet holds the signing keys, it is safe for concurrent use.
+type KeySet struct {
+	options Options
+
+	mu         sync.RWMutex
+	keys       []*Key // oldest first
+	lastReload time.Time
+}
+
+// New creates a key set, loading the stored keys from the directory.
+// A new signing key is created when there is no usable one.
+func New(options Options) (*KeySet, error) {
+	if options.Algorithm != AlgorithmRS256 && options.Algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", options.Algorithm)
+	}
+
+	s := &KeySet{options: options}
+	if options.Dir != "" {
+		if err := os.MkdirAll(options.Dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create keys directory: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	if s.signingKey() == nil {
+		if err := s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// SigningKey returns the key used to sign new tokens.
+func (s *KeySet) SigningKey() *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.signingKey()
+}
+
+// Keys returns all keys of the set, oldest first.
+func (s *KeySet) Keys() []*Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Key(nil), s.keys...)
+}
+
+// Sign signs the claims with the signing key, the "kid" header is set to its ID.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key := s.SigningKey()
+	if key == nil {
+		return "", errors.New("no signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// Keyfunc returns the public key to verify the token with, it can be passed to jwt.Parse.
+// Keys unknown to the set are looked up in the directory, as another instance may have created them.
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no key id")
+	}
+
+	key := s.lookup(kid)
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Public(), nil
+}
+
+func (s *KeySet) lookup(kid string) *Key {
+	s.mu.RLock()
+	key := s.find(kid)
+	reload := key == nil && s.options.Dir != "" && time.Since(s.lastReload) > reloadInterval
+	s.mu.RUnlock()
+
+	if !reload {
+		return key
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.lastReload) > reloadInterval {
+		if err := s.reload(); err != nil {
+			return nil
+		}
+	}
+	return s.find(kid)
+}
+
+// RotateIfDue creates a new signing key when the current one is older than the rotation interval,
+// and removes the keys which are not needed for verification anymore.
+// Returns whether a new key was created.
+func (s *KeySet) RotateIfDue() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return false, err
+	}
+
+	rotated := false
+	key := s.signingKey()
+	if key == nil || (s.options.Rotation > 0 && time.Since(key.CreatedAt) >= s.options.Rotation) {
+		if err := s.rotate(); err != nil {
+			return false, err
+		}
+		rotated = true
+	}
+
+	return rotated, s.prune()
+}
+
+// Rotate creates a new signing key, the previous keys stay valid for verification.
+func (s *KeySet) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rotate()
+}
+
+func (s *KeySet) signingKey() *Key {
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if s.keys[i].Algorithm == s.options.Algorithm {
+			return s.keys[i]
+		}
+	}
+	return nil
+}
+
+func (s *KeySet) find(kid string) *Key {
+	for _, key := range s.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+func (s *KeySet) rotate() error {
+	key, err := generateKey(s.options.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	if s.options.Dir != "" {
+		if err := writeKey(s.options.Dir, key); err != nil {
+			return err
+		}
+	}
+
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+// prune removes the keys replaced longer than the retention ago.
+func (s *KeySet) prune() error {
+	signing := s.signingKey()
+	kept := s.keys[:0]
+	var errs []error
+
+	for i, key := range s.keys {
+		if key != signing && i+1 < len(s.keys) && time.Since(s.keys[i+1].CreatedAt) > s.options.Retention {
+			if s.options.Dir != "" {
+				if err := os.Remove(keyPath(s.options.Dir, key.ID)); err != nil && !os.IsNotExist(err) {
+					errs = append(errs, err)
+				}
+			}
+			continue
+		}
+		kept = append(kept, key)
+	}
+
+	s.keys = kept
+	return errors.Join(errs...)
+}
+
+// reload reads the keys from the directory, the keys kept only in memory are preserved.
+func (s *KeySet) reload() error {
+	s.lastReload = time.Now()
+	if s.options.Dir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.options.Dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+		if s.find(kid) != nil {
+			continue
+		}
+
+		key, err := readKey(file, kid)
+		if err != nil {
+			return err
+		}
+		s.keys = append(s.keys, key)
+	}
+
+	sort.SliceStable(s.keys, func(i, j int) bool {
+		return s.keys[i].CreatedAt.Before(s.keys[j].CreatedAt)
+	})
+	return nil
+}
+
+func generateKey(algorithm string) (*Key, error) {
+	var private crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		Algorithm: algorithm,
+		CreatedAt: time.Now(),
+		private:   private,
+	}, nil
+}
+
+func keyPath(dir, kid string) string {
+	return filepath.Join(dir, kid+".pem")
+}
+
+func writeKey(dir string, key *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{createdHeader: key.CreatedAt.UTC().Format(time.RFC3339Nano)},
+		Bytes:   der,
+	})
+
+	// Write to a temporary file first, so other instances never read a partial key
+	tmp := keyPath(dir, key.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+	return os.Rename(tmp, keyPath(dir, key.ID))
+}
+
+func readKey(file, kid string) (*Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("invalid signing key %s", file)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %s: %w", file, err)
+	}
+
+	key := &Key{ID: kid}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm, key.private = AlgorithmRS256, private
+	case ed25519.PrivateKey:
+		key.Algorithm, key.private = AlgorithmEdDSA, private
+	default:
+		return nil, fmt.Errorf("unsupported signing key %s", file)
+	}
+
+	key.CreatedAt, err = time.Parse(time.RFC3339Nano, block.Headers[createdHeader])
+	if err != nil {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		key.CreatedAt = info.ModTime()
+	}
+	return key, nil
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 (RFC 8037)
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set.
+func (s *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range s.Keys() {
+		jwk := JWK{
+			ID:        key.ID,
+			Use:       "sig",
+			Algorithm: key.Algorithm,
+		}
+
+		switch public := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
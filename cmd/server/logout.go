@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/gin-gonic/gin"
+)
+
+// LogoutHandler godoc
+// @Summary Log out
+// @Schemes
+// @Description Revokes the token together with the refresh tokens of the same login. The edupage session on the server is shared by all devices of the user,
+// @Description it is ended once the last login with a refresh token is revoked. Without refresh tokens, it is kept until it expires.
+// @Tags auth
+// @Security Bearer
+// @Param Authorization header string true "JWT token"
+// @Produce json
+// @Success 200 {object} apimodel.LogoutSuccessResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.LogoutErrorResponse
+// @Router /logout [post]
+func LogoutHandler(c *gin.Context) {
+	claims, err := getClaims(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	server := claims["server"].(string)
+	username := claims["username"].(string)
+	key := util.SessionKey(server, username)
+
+	expiresAt := time.Unix(int64(claims["exp"].(float64)), 0)
+	if jti, ok := claims["jti"].(string); ok {
+		err = util.RevokeToken(jti, expiresAt)
+	} else {
+		// Tokens issued before refresh tokens were introduced have no jti, they are revoked until they expire
+		err = util.RevokeTokensIssuedBefore(key, time.Now(), max(time.Until(expiresAt), accessTokenTTL()))
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	// The other devices of the user share the edupage session, it is only ended when none of them can refresh its token
+	ended := false
+	if familyID, ok := claims["fid"].(string); ok && refreshTokensEnabled() {
+		if err := revokeTokenFamily(util.Db, familyID); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+
+		active, err := hasActiveRefreshTokens(server, username)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		if !active {
+			ended = endSession(server, username)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"error":        "",
+		"success":      true,
+		"sessionEnded": ended,
+	})
+}
+
+// LogoutAllHandler godoc
+// @Summary Log out everywhere
+// @Schemes
+// @Description Revokes every token and refresh token of the user, on all devices, and ends the edupage session on the server.
+// @Tags auth
+// @Security Bearer
+// @Param Authorization header string true "JWT token"
+// @Produce json
+// @Success 200 {object} apimodel.LogoutSuccessResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.LogoutErrorResponse
+// @Router /logout/all [post]
+func LogoutAllHandler(c *gin.Context) {
+	claims, err := getClaims(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	server := claims["server"].(string)
+	username := claims["username"].(string)
+	key := util.SessionKey(server, username)
+
+	// Tokens are issued with millisecond precision, the tokens issued within the current millisecond are revoked as well
+	before := time.Now().Truncate(time.Millisecond).Add(time.Millisecond)
+	// The tokens issued before refresh tokens were introduced live up to legacyTokenLifetime
+	if err := util.RevokeTokensIssuedBefore(key, before, max(accessTokenTTL(), legacyTokenLifetime)); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	if err := revokeUserRefreshTokens(server, username); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"error":        "",
+		"success":      true,
+		"sessionEnded": endSession(server, username),
+	})
+}
+
+// endSession removes the edupage session of the user together with its ping job and persisted copy.
+// Returns false if there was no session.
+func endSession(server, username string) bool {
+	key := util.SessionKey(server, username)
+
+	_, ok := util.Clients.Evict(key)
+	if err := util.DeletePersistedSession(key); err != nil {
+		util.LogUserSession("logout", username, server, err)
+	}
+	if ok {
+		util.LogUserSession("logout", username, server, nil)
+	}
+	return ok
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// qrLoginTTL is how long a code can be approved after it was shown
+	qrLoginTTL = 2 * time.Minute
+	// qrLoginCodeBytes is the entropy of the codes, encoded to 16 characters
+	qrLoginCodeBytes = 10
+	// qrLoginKeepAlive keeps the event stream open through proxies while waiting for the approval
+	qrLoginKeepAlive = 15 * time.Second
+)
+
+var (
+	errQRLoginCodeInvalid = errors.New("invalid or expired code")
+	errTooManyRequests    = errors.New("too many requests, try again later")
+
+	qrLoginLimiter   = util.NewRateLimiter(10, time.Minute)
+	qrApproveLimiter = util.NewRateLimiter(20, time.Minute)
+	qrLogins         = newQRLoginRegistry()
+)
+
+// qrLoginResult is sent to the new device once the code is approved.
+type qrLoginResult struct {
+	Name         string `json:"name"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	Expires      int64  `json:"expires"`
+}
+
+// qrLogin is a code waiting to be approved, the result is delivered to the device which requested it.
+type qrLogin struct {
+	Code      string
+	ExpiresAt time.Time
+	result    chan qrLoginResult
+	// approving is set while an approval of the code is in progress, the registry lock guards it
+	approving bool
+}
+
+type qrLoginRegistry struct {
+	mu      sync.Mutex
+	pending map[string]*qrLogin
+}
+
+func newQRLoginRegistry() *qrLoginRegistry {
+	return &qrLoginRegistry{pending: make(map[string]*qrLogin)}
+}
+
+// create starts a new login with a random code.
+func (r *qrLoginRegistry) create() (*qrLogin, error) {
+	b := make([]byte, qrLoginCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	login := &qrLogin{
+		Code:      base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b),
+		ExpiresAt: time.Now().Add(qrLoginTTL),
+		result:    make(chan qrLoginResult, 1),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[login.Code] = login
+	return login, nil
+}
+
+// claim returns the login with the code and marks it as being approved, so no other request approves it at the same time.
+// The code stays valid until the approval completes, see complete and release.
+func (r *qrLoginRegistry) claim(code string) (*qrLogin, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	login, ok := r.pending[code]
+	if !ok || login.approving {
+		return nil, false
+	}
+	if time.Now().After(login.ExpiresAt) {
+		delete(r.pending, code)
+		return nil, false
+	}
+	login.approving = true
+	return login, true
+}
+
+// release makes the claimed login approvable again, e.g. after the tokens couldn't be issued.
+func (r *qrLoginRegistry) release(login *qrLogin) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	login.approving = false
+}
+
+// complete removes the claimed login, so every code can only be approved once.
+func (r *qrLoginRegistry) complete(login *qrLogin) {
+	r.remove(login.Code)
+}
+
+func (r *qrLoginRegistry) remove(code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, code)
+}
+
+// QRLoginHandler godoc
+// @Summary Log in using a QR code
+// @Schemes
+// @Description Logs in a new device by approving it on a device which is already logged in. This route uses Server-Sent Events (SSE).
+// @Description The "code" event contains the code to show as a QR code, together with its expiration.
+// @Description Once another device approves the code, the "token" event delivers the tokens of the new device.
+// @Description The "expired" event is sent when the code was not approved in time. The stream ends after either of them.
+// @Tags auth
+// @Produce text/event-stream
+// @Failure 429 {object} apimodel.QRLoginErrorResponse
+// @Failure 500 {object} apimodel.QRLoginErrorResponse
+// @Router /qrlogin [get]
+func QRLoginHandler(c *gin.Context) {
+	if !qrLoginLimiter.Allow(c.ClientIP()) {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": errTooManyRequests.Error()})
+		return
+	}
+
+	login, err := qrLogins.create()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer qrLogins.remove(login.Code)
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+
+	c.SSEvent("code", gin.H{"code": login.Code, "expires": login.ExpiresAt.Unix()})
+	c.Writer.Flush()
+
+	expired := time.NewTimer(time.Until(login.ExpiresAt))
+	defer expired.Stop()
+	keepAlive := time.NewTicker(qrLoginKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case result := <-login.result:
+			c.SSEvent("token", result)
+			c.Writer.Flush()
+			return
+		case <-expired.C:
+			c.SSEvent("expired", gin.H{"error": errQRLoginCodeInvalid.Error()})
+			c.Writer.Flush()
+			return
+		case <-keepAlive.C:
+			c.SSEvent("ping", "")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// ApproveQRLoginHandler godoc
+// @Summary Approve a QR login
+// @Schemes
+// @Description Approves the code shown on a new device, which receives its own tokens for your account.
+// @Description The password never leaves this device, the code can only be approved once.
+// @Tags auth
+// @Security Bearer
+// @Param Authorization header string true "JWT token"
+// @Param code path string true "Code"
+// @Produce json
+// @Success 200 {object} apimodel.QRLoginApproveResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.QRLoginErrorResponse
+// @Failure 429 {object} apimodel.QRLoginErrorResponse
+// @Failure 500 {object} apimodel.QRLoginErrorResponse
+// @Router /qrlogin/{code} [post]
+func ApproveQRLoginHandler(c *gin.Context) {
+	if !qrApproveLimiter.Allow(c.ClientIP()) {
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": errTooManyRequests.Error(), "success": false})
+		return
+	}
+
+	claims, err := getClaims(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	server := claims["server"].(string)
+	username := claims["username"].(string)
+
+	session, ok := util.Clients.Get(util.SessionKey(server, username))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": errClientNotFound.Error()})
+		return
+	}
+
+	login, ok := qrLogins.claim(c.Param("code"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errQRLoginCodeInvalid.Error(), "success": false})
+		return
+	}
+
+	user, err := session.Client.GetUserContext(c.Request.Context(), false)
+	if err != nil {
+		qrLogins.release(login)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	// The new device gets its own token family, so it can be logged out separately
+	tokens, err := issueTokens(server, username)
+	if err != nil {
+		qrLogins.release(login)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	// The code is only used up once the tokens are issued, a failed approval can be retried
+	qrLogins.complete(login)
+	login.result <- qrLoginResult{
+		Name:         user.UserRow.Firstname + " " + user.UserRow.Lastname,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Expires:      tokens.ExpiresAt.Unix(),
+	}
+	util.LogUserSession("qr login", username, server, nil)
+
+	c.JSON(http.StatusOK, gin.H{"error": "", "success": true})
+}
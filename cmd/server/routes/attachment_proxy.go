@@ -0,0 +1,185 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/DislikesSchool/EduPage2-server/config"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultMaxCachedAttachmentSize limits the files which are buffered to be cached, larger files are streamed.
+const defaultMaxCachedAttachmentSize = 1 << 20
+
+// proxiedHeaders are copied from the edupage response when the file is streamed.
+var proxiedHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Content-Disposition", "Accept-Ranges", "ETag", "Last-Modified"}
+
+var (
+	errMissingAttachmentURL = errors.New("missing attachment url")
+	errIncompleteAttachment = errors.New("incomplete attachment received from edupage")
+)
+
+func maxCachedAttachmentSize() int64 {
+	if size := config.AppConfig.Attachments.Cache.MaxSize; size > 0 {
+		return size
+	}
+	return defaultMaxCachedAttachmentSize
+}
+
+// AttachmentHandler godoc
+// @Summary Download an attachment
+// @Schemes
+// @Description Downloads the attachment of a message or homework using the user's edupage session, e.g. the urls returned in the attachments of the timeline.
+// @Description Supports range requests and ETags. Small files may be served from the server's cache.
+// @Tags timeline
+// @Param Authorization header string true "JWT token"
+// @Param url query string true "Attachment url, relative to the edupage server"
+// @Param Range header string false "Requested byte range"
+// @Param If-None-Match header string false "ETag of the cached file"
+// @Produce octet-stream
+// @Security Bearer
+// @Success 200 {file} file
+// @Success 206 {file} file "Partial content"
+// @Success 304 "Not modified"
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.InternalErrorResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/attachment [get]
+func AttachmentHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	link := c.Query("url")
+	if link == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errMissingAttachmentURL.Error()})
+		return
+	}
+
+	// The files are only served to the user who has downloaded them, edupage checks the access to them
+	var cacheKey string
+	if util.AttachmentCache != nil {
+		sum := sha256.Sum256([]byte(link))
+		key, err := util.CacheKeyFromEPClient(client, "attachment:"+hex.EncodeToString(sum[:]))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		cacheKey = key
+
+		// The file is downloaded again when the cache fails
+		if cached, ok, err := util.AttachmentCache.Get(cacheKey); err == nil && ok {
+			serveAttachment(c, cached)
+			return
+		}
+	}
+
+	resp, err := client.OpenAttachmentContext(c.Request.Context(), link, c.Request.Header)
+	if err != nil {
+		c.AbortWithStatusJSON(attachmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	limit := maxCachedAttachmentSize()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < 0 || resp.ContentLength > limit {
+		streamAttachment(c, resp)
+		return
+	}
+
+	attachment, err := readAttachment(resp)
+	if err != nil {
+		c.AbortWithStatusJSON(attachmentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if cacheKey != "" {
+		_ = util.AttachmentCache.Set(cacheKey, attachment)
+	}
+	serveAttachment(c, attachment)
+}
+
+// readAttachment reads the whole file from the response, creating an ETag if edupage hasn't sent one.
+func readAttachment(resp *http.Response) (util.CachedAttachment, error) {
+	content, err := io.ReadAll(io.LimitReader(resp.Body, resp.ContentLength+1))
+	if err != nil {
+		return util.CachedAttachment{}, err
+	}
+	if int64(len(content)) != resp.ContentLength {
+		return util.CachedAttachment{}, errIncompleteAttachment
+	}
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		sum := sha256.Sum256(content)
+		etag = fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:16]))
+	}
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return util.CachedAttachment{
+		ContentType: resp.Header.Get("Content-Type"),
+		Disposition: resp.Header.Get("Content-Disposition"),
+		ETag:        etag,
+		ModTime:     modTime,
+		Content:     content,
+	}, nil
+}
+
+// serveAttachment serves the whole file, http.ServeContent handles the range and conditional requests.
+func serveAttachment(c *gin.Context, attachment util.CachedAttachment) {
+	attachmentSecurityHeaders(c)
+	if attachment.ContentType != "" {
+		c.Header("Content-Type", attachment.ContentType)
+	}
+	if attachment.Disposition != "" {
+		c.Header("Content-Disposition", attachment.Disposition)
+	}
+	c.Header("ETag", attachment.ETag)
+
+	http.ServeContent(c.Writer, c.Request, "", attachment.ModTime, bytes.NewReader(attachment.Content))
+}
+
+// streamAttachment copies the response of edupage, which may already be partial or not modified.
+func streamAttachment(c *gin.Context, resp *http.Response) {
+	attachmentSecurityHeaders(c)
+	for _, name := range proxiedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			c.Header(name, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+	if resp.StatusCode == http.StatusNotModified {
+		return
+	}
+	_, _ = io.Copy(c.Writer, resp.Body)
+}
+
+// attachmentSecurityHeaders prevent the files from running as documents of the server's origin, e.g. html files.
+func attachmentSecurityHeaders(c *gin.Context) {
+	c.Header("Cache-Control", "private")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+}
+
+// attachmentErrorStatus chooses the response status for errors returned when downloading attachments.
+func attachmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, edupage.ErrorInvalidAttachmentURL):
+		return http.StatusBadRequest
+	case errors.Is(err, edupage.ErrorNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, edupage.ErrorUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
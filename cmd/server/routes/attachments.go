@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/DislikesSchool/EduPage2-server/config"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxAttachmentSize = 10 << 20
+	defaultMaxAttachments    = 10
+	// attachmentsField is the multipart form field of the attached files
+	attachmentsField = "attachments"
+	// formOverhead is the space left for the other fields of a multipart form
+	formOverhead = 1 << 20
+)
+
+// defaultAttachmentTypes are allowed when the types are not configured, application/zip covers the office documents.
+var defaultAttachmentTypes = []string{
+	"application/pdf",
+	"application/zip",
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"text/plain",
+}
+
+var (
+	errTooManyAttachments = errors.New("too many attachments")
+	errAttachmentTooLarge = errors.New("attachment is too large")
+	errAttachmentType     = errors.New("attachment type is not allowed")
+)
+
+func maxAttachmentSize() int64 {
+	if size := config.AppConfig.Attachments.MaxSize; size > 0 {
+		return size
+	}
+	return defaultMaxAttachmentSize
+}
+
+func maxAttachments() int {
+	if count := config.AppConfig.Attachments.MaxCount; count > 0 {
+		return count
+	}
+	return defaultMaxAttachments
+}
+
+func allowedAttachmentTypes() []string {
+	if types := config.AppConfig.Attachments.AllowedTypes; len(types) > 0 {
+		return types
+	}
+	return defaultAttachmentTypes
+}
+
+// attachmentFiles parses the multipart form of the request and checks its files against the limits.
+// Requests which are not multipart have no files. Responds with an error and returns false if the files are refused.
+func attachmentFiles(c *gin.Context) ([]*multipart.FileHeader, bool) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		return nil, true
+	}
+
+	limit := int64(maxAttachments())*maxAttachmentSize() + formOverhead
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": errAttachmentTooLarge.Error()})
+			return nil, false
+		}
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	files := form.File[attachmentsField]
+	if len(files) > maxAttachments() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errTooManyAttachments.Error()})
+		return nil, false
+	}
+
+	for _, file := range files {
+		if file.Size > maxAttachmentSize() {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("%s: %s", errAttachmentTooLarge, file.Filename)})
+			return nil, false
+		}
+
+		typ, err := detectAttachmentType(file)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		if !slices.Contains(allowedAttachmentTypes(), typ) {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": fmt.Sprintf("%s: %s (%s)", errAttachmentType, file.Filename, typ)})
+			return nil, false
+		}
+	}
+	return files, true
+}
+
+// detectAttachmentType detects the media type of the file from its contents, the type sent by the client is not trusted.
+func detectAttachmentType(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	typ, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if err != nil {
+		return "", err
+	}
+	return typ, nil
+}
+
+// uploadAttachments uploads the files to edupage.
+// Responds with an error and returns false if any of the uploads fails.
+func uploadAttachments(c *gin.Context, client *edupage.EdupageClient, files []*multipart.FileHeader) ([]edupage.Attachment, bool) {
+	attachments := make([]edupage.Attachment, 0, len(files))
+	for _, file := range files {
+		f, err := file.Open()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+
+		attachment, err := client.UploadAttachmentContext(c.Request.Context(), file.Filename, f)
+		f.Close()
+		if err != nil {
+			c.AbortWithStatusJSON(reactionErrorStatus(err), gin.H{"error": err.Error()})
+			return nil, false
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, true
+}
@@ -0,0 +1,205 @@
+package routes
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"github.com/gin-gonic/gin"
+)
+
+// lessonType is the type of the timetable items which are lessons, the other items are e.g. events.
+const lessonType = "lesson"
+
+// attendanceTotals counts the lessons and absences of a half of the school year.
+type attendanceTotals struct {
+	apimodel.AttendanceTotals
+	subjects map[string]*apimodel.SubjectAttendance
+}
+
+func (t *attendanceTotals) subject(dbi *model.DBI, id string) *apimodel.SubjectAttendance {
+	subject, ok := t.subjects[id]
+	if !ok {
+		subject = &apimodel.SubjectAttendance{Subject: dbi.Subjects[id]}
+		if subject.Subject.ID == "" {
+			subject.Subject.ID = id
+		}
+		t.subjects[id] = subject
+	}
+	return subject
+}
+
+// AttendanceHandler godoc
+// @Summary Get the user's attendance
+// @Schemes
+// @Description Returns the absences and late arrivals of the school year, from the newest one.
+// @Description The halves contain the totals of both halves of the year and the share of the missed lessons of every subject,
+// @Description the lessons are counted using the timetable until today.
+// @Tags attendance
+// @Param Authorization header string true "JWT token"
+// @Param year query string false "School year, e.g. 2024 for 2024/2025, the current one by default"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.AttendanceResponse
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/attendance [get]
+func AttendanceHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	year, _ := resultsPeriod(c)
+	from, err := time.ParseInLocation("2006", year, time.Local)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from = from.AddDate(0, int(time.September-time.January), 0)
+	to := from.AddDate(1, 0, -1)
+
+	response := apimodel.AttendanceResponse{Absences: []apimodel.Absence{}, Halves: []apimodel.AttendanceTotals{}}
+
+	// Only the lessons which have already taken place are counted
+	today := time.Now()
+	if today.Before(to) {
+		to = today
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	user, err := client.GetUserContext(c.Request.Context(), false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	attendance, err := client.GetAttendanceContext(c.Request.Context(), from, to)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	timetable, err := client.GetTimetableContext(c.Request.Context(), from, to)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	halves := make(map[string]*attendanceTotals)
+	half := func(date time.Time) *attendanceTotals {
+		year, half := model.SchoolHalf(date)
+		totals, ok := halves[half]
+		if !ok {
+			totals = &attendanceTotals{
+				AttendanceTotals: apimodel.AttendanceTotals{Year: year, Half: half},
+				subjects:         make(map[string]*apimodel.SubjectAttendance),
+			}
+			halves[half] = totals
+		}
+		return totals
+	}
+
+	for day, items := range timetable.Days {
+		date, err := time.Parse(model.TimeFormatYearMonthDay, day)
+		if err != nil {
+			continue
+		}
+		for _, item := range items {
+			if item.Type != lessonType {
+				continue
+			}
+			totals := half(date)
+			totals.Lessons++
+			if item.SubjectID != "" {
+				totals.subject(&user.DBI, item.SubjectID).Lessons++
+			}
+		}
+	}
+
+	for _, absence := range attendance.Sorted() {
+		converted := convertAbsence(&user.DBI, absence)
+		response.Absences = append(response.Absences, converted)
+
+		date, ok := absence.ParsedDate()
+		if !ok {
+			continue
+		}
+		totals := half(date)
+		var subject *apimodel.SubjectAttendance
+		if absence.SubjectID != "" {
+			subject = totals.subject(&user.DBI, string(absence.SubjectID))
+		}
+
+		if converted.Status == model.AbsenceLate {
+			totals.Late++
+			if subject != nil {
+				subject.Late++
+			}
+			continue
+		}
+		totals.Absent++
+		if subject != nil {
+			subject.Absent++
+		}
+		switch converted.Status {
+		case model.AbsenceExcused:
+			totals.Excused++
+		case model.AbsenceUnexcused:
+			totals.Unexcused++
+		default:
+			totals.Pending++
+		}
+	}
+
+	for _, totals := range halves {
+		totals.Percent = percent(totals.Absent, totals.Lessons)
+		totals.Subjects = make([]apimodel.SubjectAttendance, 0, len(totals.subjects))
+		for _, subject := range totals.subjects {
+			subject.Percent = percent(subject.Absent, subject.Lessons)
+			totals.Subjects = append(totals.Subjects, *subject)
+		}
+		sort.Slice(totals.Subjects, func(i, j int) bool { return totals.Subjects[i].Subject.ID < totals.Subjects[j].Subject.ID })
+		response.Halves = append(response.Halves, totals.AttendanceTotals)
+	}
+	sort.Slice(response.Halves, func(i, j int) bool { return response.Halves[i].Half < response.Halves[j].Half })
+
+	c.JSON(http.StatusOK, response)
+}
+
+// convertAbsence links the absence to its subject, period and type.
+func convertAbsence(dbi *model.DBI, absence model.Absence) apimodel.Absence {
+	converted := apimodel.Absence{
+		ID:          string(absence.ID),
+		Status:      absence.Status(dbi),
+		LateMinutes: int(absence.LateMinutes),
+		Note:        absence.Note,
+	}
+
+	if subject, ok := dbi.Subjects[string(absence.SubjectID)]; ok {
+		converted.Subject = &subject
+	}
+	if period, ok := dbi.Periods[json.Number(absence.Period)]; ok {
+		converted.Period = &period
+	}
+	if absentType, ok := dbi.StudentAbsentTypes[string(absence.TypeID)]; ok {
+		converted.Type = &absentType
+	}
+	if date, ok := absence.ParsedDate(); ok {
+		converted.Date = &date
+		converted.Year, converted.Half = model.SchoolHalf(date)
+	}
+	return converted
+}
+
+// percent returns the share of the part in the total, rounded to two decimal places. It's zero without a total.
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*10000) / 100
+}
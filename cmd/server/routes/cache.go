@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"github.com/gin-gonic/gin"
+)
+
+// The caches of the data of the users, see util.UserCache.
+var (
+	timelineCache  = util.NewUserCache[model.Timeline]("timeline")
+	timetableCache = util.NewUserCache[apimodel.CompleteTimetable]("timetable")
+	resultsCache   = util.NewUserCache[model.Results]("results")
+)
+
+// cached reads the data from the cache and sends the X-Cache and Age headers. The fetch mustn't use the context of the request,
+// it may run after the response has been sent. Responds with an error and returns false if the data can't be retrieved.
+func cached[T any](c *gin.Context, client *edupage.EdupageClient, cache *util.UserCache[T], fetch func(ctx context.Context) (T, error), params ...string) (util.Cached[T], bool) {
+	result, err := cache.Get(c.Request.Context(), client, c.GetString("child"), fetch, params...)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return result, false
+	}
+
+	c.Header("X-Cache", string(result.Status))
+	c.Header("Age", strconv.Itoa(int(result.Age.Seconds())))
+	return result, true
+}
@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/ical"
+	"github.com/gin-gonic/gin"
+)
+
+// calendarPath is the path of the feeds, followed by the token and the .ics extension.
+const calendarPath = "/calendar/"
+
+var (
+	errCalendarNotFound = errors.New("calendar not found")
+	errCalendarExpired  = errors.New("the session of the account has expired, log in to renew the calendar")
+)
+
+// CreateCalendarTokenHandler godoc
+// @Summary Create a calendar feed
+// @Schemes
+// @Description Creates a read-only token of the iCalendar feed with the user's timetable and homework, which calendar apps can subscribe to.
+// @Description The feed of a parent account is for the selected child. A new token replaces the previous token of the feed.
+// @Description The feed is only available while the server has a session of the account.
+// @Tags calendar
+// @Param Authorization header string true "JWT token"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.CalendarTokenResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/calendar/token [post]
+func CreateCalendarTokenHandler(c *gin.Context) {
+	token, err := util.CalendarTokens.Issue(calendarFeed(c))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, apimodel.CalendarTokenResponse{
+		Token: token,
+		URL:   requestOrigin(c) + calendarPath + token + ".ics",
+	})
+}
+
+// RevokeCalendarTokenHandler godoc
+// @Summary Revoke the calendar feed
+// @Schemes
+// @Description Revokes the token of the user's calendar feed, the subscribed apps can no longer read it.
+// @Tags calendar
+// @Param Authorization header string true "JWT token"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.CalendarTokenRevokeResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/calendar/token [delete]
+func RevokeCalendarTokenHandler(c *gin.Context) {
+	revoked, err := util.CalendarTokens.Revoke(calendarFeed(c))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, apimodel.CalendarTokenRevokeResponse{Revoked: revoked})
+}
+
+// CalendarFeedHandler godoc
+// @Summary Get the calendar feed
+// @Schemes
+// @Description Returns the iCalendar (RFC 5545) feed of the lessons and the homework deadlines, authenticated by the token of the feed.
+// @Description The lessons are from the configured number of days before and after today, the homework is from the recent timeline.
+// @Tags calendar
+// @Param token path string true "Token of the feed, with the .ics extension"
+// @Produce text/calendar
+// @Success 200 {string} string "iCalendar feed"
+// @Failure 404 {object} apimodel.InternalErrorResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Failure 503 {object} apimodel.InternalErrorResponse "The session of the account has expired"
+// @Router /calendar/{token} [get]
+func CalendarFeedHandler(c *gin.Context) {
+	feed, ok, err := util.CalendarTokens.Lookup(strings.TrimSuffix(c.Param("token"), ".ics"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errCalendarNotFound.Error()})
+		return
+	}
+
+	session, ok := util.Clients.Get(feed.Key())
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": errCalendarExpired.Error()})
+		return
+	}
+	client := session.Client
+
+	location, err := util.SchoolLocation()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, after := util.CalendarDays()
+	now := time.Now().In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+
+	calendar := ical.Calendar{
+		Name:     "EduPage2",
+		Domain:   client.Credentials.Server + ".edupage.org",
+		TimeZone: location.String(),
+		Stamp:    now,
+	}
+
+	ctx := c.Request.Context()
+	err = client.WithChild(ctx, feed.Child, func() error {
+		user, err := client.GetUserContext(ctx, false)
+		if err != nil {
+			return err
+		}
+		timetable, err := client.GetTimetableContext(ctx, today.AddDate(0, 0, -before), today.AddDate(0, 0, after))
+		if err != nil {
+			return err
+		}
+		timeline, err := client.GetRecentTimelineContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		calendar.Events = append(ical.LessonEvents(timetable, &user.DBI, location), ical.HomeworkEvents(timeline.SortedHomeworks(), &user.DBI, location)...)
+		return nil
+	})
+	if err != nil {
+		c.AbortWithStatusJSON(calendarErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", ical.ContentType)
+	c.Header("Cache-Control", "private, max-age=900")
+	c.Status(http.StatusOK)
+	_, _ = calendar.WriteTo(c.Writer)
+}
+
+// calendarFeed returns the feed of the account and the child selected by the request.
+func calendarFeed(c *gin.Context) util.CalendarFeed {
+	account := c.MustGet("account").(util.Account)
+	return util.CalendarFeed{Server: account.Server, Username: account.Username, Child: c.GetString("child")}
+}
+
+// requestOrigin returns the scheme and the host the request was sent to, the scheme set by a proxy is preferred.
+func requestOrigin(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// calendarErrorStatus chooses the response status for errors returned when creating the feed.
+func calendarErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, edupage.ErrorNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, edupage.ErrorUnauthorized):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
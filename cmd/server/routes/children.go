@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/gin-gonic/gin"
+)
+
+// ChildrenHandler godoc
+// @Summary Get the children of a parent account
+// @Schemes
+// @Description Returns the children of a parent account. The data of a child is returned by the other routes
+// @Description when the child is selected, using the X-Child header or the child query parameter.
+// @Tags user
+// @Param Authorization header string true "JWT token"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.ChildrenResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/children [get]
+func ChildrenHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	if !client.IsParent() {
+		c.JSON(http.StatusOK, apimodel.ChildrenResponse{Children: []edupage.Child{}})
+		return
+	}
+
+	children, err := client.GetChildren()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, apimodel.ChildrenResponse{
+		Parent:   true,
+		Active:   c.GetString("child"),
+		Children: children,
+	})
+}
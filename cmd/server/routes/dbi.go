@@ -1,15 +1,21 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
 	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
 	"github.com/DislikesSchool/EduPage2-server/edupage"
-	"github.com/DislikesSchool/EduPage2-server/edupage/model"
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	errSubjectNotFound   = errors.New("subject not found")
+	errTeacherNotFound   = errors.New("teacher not found")
+	errClassroomNotFound = errors.New("classroom not found")
+)
+
 // RecipientsHandler godoc
 // @Summary Get recipients
 // @Schemes
@@ -25,44 +31,20 @@ import (
 func RecipientsHandler(c *gin.Context) {
 	client := c.MustGet("client").(*edupage.EdupageClient)
 
-	var cacheKey string
-	var err error
-	if util.ShouldCache {
-		cacheKey, err = util.CacheKeyFromEPClient(client, "recipients")
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		cached, err := util.IsCached(cacheKey)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		if cached {
-			var recipients []apimodel.Recipient
-			read, err := util.ReadCache(cacheKey, &recipients)
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			if read {
-				c.JSON(http.StatusOK, recipients)
-				return
-			}
-		}
+	// The students depend on the class of the user, the teachers are shared by the school
+	user, err := client.GetUserContext(c.Request.Context(), false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-
-	user, err := client.GetUser(false)
+	school, err := util.Schools.DBI(c.Request.Context(), client)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	students := user.DBI.Students
-	teachers := user.DBI.Teachers
+	teachers := school.Teachers
 
 	recipients := make([]apimodel.Recipient, len(students)+len(teachers))
 
@@ -86,10 +68,6 @@ func RecipientsHandler(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, recipients)
-
-	if util.ShouldCache {
-		_ = util.CacheData(cacheKey, recipients, util.TTLFromType("dbi"))
-	}
 }
 
 // SubjectHandler godoc
@@ -103,54 +81,22 @@ func RecipientsHandler(c *gin.Context) {
 // @Security Bearer
 // @Success 200 {object} model.Subject
 // @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.InternalErrorResponse
 // @Failure 500 {object} apimodel.InternalErrorResponse
 // @Router /api/subject/{id} [get]
 func SubjectHandler(c *gin.Context) {
-	client := c.MustGet("client").(*edupage.EdupageClient)
-
-	id := c.Param("id")
-
-	var cacheKey string
-	var err error
-	if util.ShouldCache {
-		cacheKey, err = util.CacheKeyFromEPClient(client, "subject:"+id)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		cached, err := util.IsCached(cacheKey)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		if cached {
-			var subject model.Subject
-			read, err := util.ReadCache(cacheKey, &subject)
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			if read {
-				c.JSON(http.StatusOK, subject)
-				return
-			}
-		}
+	school, ok := schoolDBI(c)
+	if !ok {
+		return
 	}
 
-	subject, err := client.GetSubjectByID(id)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	subject, ok := school.Subjects[c.Param("id")]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errSubjectNotFound.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, subject)
-
-	if util.ShouldCache {
-		_ = util.CacheData(cacheKey, subject, util.TTLFromType("dbi"))
-	}
 }
 
 // TeacherHandler godoc
@@ -164,54 +110,22 @@ func SubjectHandler(c *gin.Context) {
 // @Security Bearer
 // @Success 200 {object} model.Teacher
 // @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.InternalErrorResponse
 // @Failure 500 {object} apimodel.InternalErrorResponse
 // @Router /api/teacher/{id} [get]
 func TeacherHandler(c *gin.Context) {
-	client := c.MustGet("client").(*edupage.EdupageClient)
-
-	id := c.Param("id")
-
-	var cacheKey string
-	var err error
-	if util.ShouldCache {
-		cacheKey, err = util.CacheKeyFromEPClient(client, "teacher:"+id)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		cached, err := util.IsCached(cacheKey)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		if cached {
-			var subject model.Subject
-			read, err := util.ReadCache(cacheKey, &subject)
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			if read {
-				c.JSON(http.StatusOK, subject)
-				return
-			}
-		}
+	school, ok := schoolDBI(c)
+	if !ok {
+		return
 	}
 
-	subject, err := client.GetTeacherByID(id)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	teacher, ok := school.Teachers[c.Param("id")]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errTeacherNotFound.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, subject)
-
-	if util.ShouldCache {
-		_ = util.CacheData(cacheKey, subject, util.TTLFromType("dbi"))
-	}
+	c.JSON(http.StatusOK, teacher)
 }
 
 // ClassroomHandler godoc
@@ -225,54 +139,22 @@ func TeacherHandler(c *gin.Context) {
 // @Security Bearer
 // @Success 200 {object} model.Classroom
 // @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.InternalErrorResponse
 // @Failure 500 {object} apimodel.InternalErrorResponse
 // @Router /api/classroom/{id} [get]
 func ClassroomHandler(c *gin.Context) {
-	client := c.MustGet("client").(*edupage.EdupageClient)
-
-	id := c.Param("id")
-
-	var cacheKey string
-	var err error
-	if util.ShouldCache {
-		cacheKey, err = util.CacheKeyFromEPClient(client, "classroom:"+id)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		cached, err := util.IsCached(cacheKey)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		if cached {
-			var subject model.Subject
-			read, err := util.ReadCache(cacheKey, &subject)
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			if read {
-				c.JSON(http.StatusOK, subject)
-				return
-			}
-		}
+	school, ok := schoolDBI(c)
+	if !ok {
+		return
 	}
 
-	subject, err := client.GetClassroomByID(id)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	classroom, ok := school.Classrooms[c.Param("id")]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errClassroomNotFound.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, subject)
-
-	if util.ShouldCache {
-		_ = util.CacheData(cacheKey, subject, util.TTLFromType("dbi"))
-	}
+	c.JSON(http.StatusOK, classroom)
 }
 
 // PeriodsHandler godoc
@@ -288,13 +170,22 @@ func ClassroomHandler(c *gin.Context) {
 // @Failure 500 {object} apimodel.InternalErrorResponse
 // @Router /api/periods [get]
 func PeriodsHandler(c *gin.Context) {
+	school, ok := schoolDBI(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, school.Periods)
+}
+
+// schoolDBI returns the DBI shared by the school of the user, from the school cache.
+func schoolDBI(c *gin.Context) (util.SchoolDBI, bool) {
 	client := c.MustGet("client").(*edupage.EdupageClient)
 
-	user, err := client.GetUser(false)
+	school, err := util.Schools.DBI(c.Request.Context(), client)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return util.SchoolDBI{}, false
 	}
-
-	c.JSON(http.StatusOK, user.DBI.Periods)
+	return school, true
 }
@@ -0,0 +1,210 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"github.com/gin-gonic/gin"
+)
+
+// maxFreeRange limits the range of the free time of a teacher, every week of the range needs the timetables of all classes.
+const maxFreeRange = 31 * 24 * time.Hour
+
+var (
+	errUnknownPeriod = errors.New("unknown period")
+	errRangeTooLong  = errors.New("the range can be at most 31 days long")
+)
+
+// FreeClassroomsHandler godoc
+// @Summary Find the free classrooms
+// @Schemes
+// @Description Returns the classrooms which aren't used in the periods of the day, computed from the timetables of all classes of the school.
+// @Description The occupancy of the school is cached for all its users.
+// @Tags free
+// @Param Authorization header string true "JWT token"
+// @Param query query apimodel.FreeRequest false "Day and period"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.FreeClassroomsResponse
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/free/classrooms [get]
+func FreeClassroomsHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	user, day, periods, ok := freeQuery(c, client)
+	if !ok {
+		return
+	}
+	occupancy, ok := schoolOccupancy(c, client, day, day)
+	if !ok {
+		return
+	}
+
+	date := day.Format(model.TimeFormatYearMonthDay)
+	response := apimodel.FreeClassroomsResponse{Date: date, Periods: make([]apimodel.FreeClassroomsPeriod, len(periods))}
+	for i, period := range periods {
+		response.Periods[i] = apimodel.FreeClassroomsPeriod{Period: period, Classrooms: occupancy.FreeClassrooms(&user.DBI, date, period.ID)}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// FreeTeachersHandler godoc
+// @Summary Find the free teachers
+// @Schemes
+// @Description Returns the teachers who don't teach in the periods of the day, computed from the timetables of all classes of the school.
+// @Description The occupancy of the school is cached for all its users.
+// @Tags free
+// @Param Authorization header string true "JWT token"
+// @Param query query apimodel.FreeRequest false "Day and period"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.FreeTeachersResponse
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/free/teachers [get]
+func FreeTeachersHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	user, day, periods, ok := freeQuery(c, client)
+	if !ok {
+		return
+	}
+	occupancy, ok := schoolOccupancy(c, client, day, day)
+	if !ok {
+		return
+	}
+
+	date := day.Format(model.TimeFormatYearMonthDay)
+	response := apimodel.FreeTeachersResponse{Date: date, Periods: make([]apimodel.FreeTeachersPeriod, len(periods))}
+	for i, period := range periods {
+		response.Periods[i] = apimodel.FreeTeachersPeriod{Period: period, Teachers: occupancy.FreeTeachers(&user.DBI, date, period.ID)}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// TeacherFreeTimeHandler godoc
+// @Summary Find when a teacher is free
+// @Schemes
+// @Description Returns the periods of the school days in which the teacher doesn't teach, from today to a week from today by default.
+// @Description The range can be at most 31 days long.
+// @Tags free
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Teacher ID"
+// @Param range query apimodel.TimetableRangeRequest false "Date range"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.TeacherFreeTimeResponse
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.InternalErrorResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/free/teachers/{id} [get]
+func TeacherFreeTimeHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	from, to, err := weekRange(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if to.Sub(from) > maxFreeRange {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errRangeTooLong.Error()})
+		return
+	}
+
+	user, err := client.GetUserContext(c.Request.Context(), false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	teacher, ok := user.DBI.Teachers[c.Param("id")]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errTeacherNotFound.Error()})
+		return
+	}
+
+	occupancy, ok := schoolOccupancy(c, client, from, to)
+	if !ok {
+		return
+	}
+
+	response := apimodel.TeacherFreeTimeResponse{Teacher: teacher, Days: []apimodel.TeacherFreeDay{}}
+	for day := startOfDay(from); !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(model.TimeFormatYearMonthDay)
+		if periods := occupancy.TeacherFreePeriods(&user.DBI, teacher.ID, date); periods != nil {
+			response.Days = append(response.Days, apimodel.TeacherFreeDay{Date: date, Periods: periods})
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// freeQuery parses the date and the period query parameters, all periods of today by default.
+func freeQuery(c *gin.Context, client *edupage.EdupageClient) (model.User, time.Time, []model.Period, bool) {
+	day := time.Now()
+	if value := c.Query("date"); value != "" {
+		var err error
+		if day, err = time.Parse(time.RFC3339, value); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return model.User{}, time.Time{}, nil, false
+		}
+	}
+
+	user, err := client.GetUserContext(c.Request.Context(), false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return model.User{}, time.Time{}, nil, false
+	}
+
+	periods := model.SortedPeriods(&user.DBI)
+	if value := c.Query("period"); value != "" {
+		period, ok := user.DBI.Periods[json.Number(value)]
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errUnknownPeriod.Error()})
+			return model.User{}, time.Time{}, nil, false
+		}
+		periods = []model.Period{period}
+	}
+	return user, startOfDay(day), periods, true
+}
+
+// schoolOccupancy returns the occupancy of the school in the weeks of the range. The weeks are cached per school,
+// all users of the school share them.
+func schoolOccupancy(c *gin.Context, client *edupage.EdupageClient, from, to time.Time) (model.Occupancy, bool) {
+	occupancy := model.NewOccupancy()
+	for monday := startOfWeek(from); !monday.After(to); monday = monday.AddDate(0, 0, 7) {
+		week, err := weekOccupancy(c, client, monday)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return model.Occupancy{}, false
+		}
+		occupancy.Merge(week)
+	}
+	return occupancy, true
+}
+
+// weekOccupancy returns the occupancy of the school in the week, which is shared by all users of the school.
+func weekOccupancy(c *gin.Context, client *edupage.EdupageClient, monday time.Time) (model.Occupancy, error) {
+	key := "occupancy:" + monday.Format(model.TimeFormatYearMonthDay)
+	return util.SchoolData(c.Request.Context(), client, key, util.TTLFromType("occupancy"), func(ctx context.Context) (model.Occupancy, error) {
+		return client.GetOccupancyContext(ctx, monday, monday.AddDate(0, 0, 6))
+	})
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns the monday of the week of the time.
+func startOfWeek(t time.Time) time.Time {
+	return startOfDay(t).AddDate(0, 0, -int(t.Weekday()+6)%7)
+}
@@ -0,0 +1,221 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/grades"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidTarget         = errors.New("the target must be a mark between 1 and 5")
+	errInvalidWeight         = errors.New("the weight must be a positive number")
+	errGradeHistoryDisabled  = errors.New("grade history is disabled, enable grades in the data storage preferences")
+	errGradeHistoryNoStorage = errors.New("grade history requires data storage, which is disabled on this server")
+)
+
+// GradesSummaryHandler godoc
+// @Summary Get the averages of the user's grades
+// @Schemes
+// @Description Returns the weighted averages of the user's grades by subject, with their development over time.
+// @Description The grades are converted to marks from 1 (best) to 5, percentages and points included.
+// @Description When the target is set, every subject contains the mark the next grade needs so the average reaches the target.
+// @Tags grades
+// @Param Authorization header string true "JWT token"
+// @Param year query string false "Year"
+// @Param half query string false "Half"
+// @Param target query number false "Target average"
+// @Param weight query number false "Weight of the next grade, 1 by default"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.GradesSummaryResponse
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/grades/summary [get]
+func GradesSummaryHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	var target float64
+	if value := c.Query("target"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < grades.BestMark || parsed > grades.WorstMark {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidTarget.Error()})
+			return
+		}
+		target = parsed
+	}
+	weight := 1.0
+	if value := c.Query("weight"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidWeight.Error()})
+			return
+		}
+		weight = parsed
+	}
+
+	year, half := resultsPeriod(c)
+	results, err := client.GetResultsContext(c.Request.Context(), year, half)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	graded := grades.FromResults(results)
+	summary := grades.Summarize(graded, time.Now())
+
+	bySubject := make(map[string][]grades.Grade, len(summary.Subjects))
+	for _, grade := range graded {
+		bySubject[grade.SubjectID] = append(bySubject[grade.SubjectID], grade)
+	}
+
+	response := apimodel.GradesSummaryResponse{
+		Average:  summary.Average,
+		Count:    summary.Count,
+		Subjects: make([]apimodel.SubjectGrades, 0, len(summary.Subjects)),
+	}
+	for _, subject := range summary.SortedSubjects() {
+		converted := apimodel.SubjectGrades{
+			SubjectSummary: *subject,
+			Grades:         bySubject[subject.SubjectID],
+		}
+		if s, err := client.GetSubjectByID(subject.SubjectID); err == nil {
+			converted.Subject = &s
+		} else {
+			converted.Subject = &model.Subject{ID: subject.SubjectID}
+		}
+		if target > 0 {
+			mark, reachable := subject.Needed(target, weight)
+			converted.Needed = &apimodel.NeededGrade{Target: target, Weight: weight, Mark: mark, Reachable: reachable}
+		}
+		response.Subjects = append(response.Subjects, converted)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GradeChangesHandler godoc
+// @Summary Get the changes of the user's grades
+// @Schemes
+// @Description Returns the grades which have been added, modified or removed since the time.
+// @Description The grades are compared with the last stored snapshot on every request, the first request only stores the snapshot.
+// @Description Requires the grades data storage preference.
+// @Tags grades
+// @Param Authorization header string true "JWT token"
+// @Param since query string false "Return the changes detected after the time, RFC3339"
+// @Param year query string false "Year"
+// @Param half query string false "Half"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.GradeChangesResponse
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 403 {object} apimodel.InternalErrorResponse "Grade history is disabled"
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Failure 501 {object} apimodel.InternalErrorResponse "Data storage is disabled on the server"
+// @Router /api/grades/changes [get]
+func GradeChangesHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+	dataStorage := c.MustGet("dataStorage").(*util.DataStorageConfig)
+
+	if !util.ShouldStore {
+		c.AbortWithStatusJSON(http.StatusNotImplemented, gin.H{"error": errGradeHistoryNoStorage.Error()})
+		return
+	}
+	if !dataStorage.StoresGrades() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": errGradeHistoryDisabled.Error()})
+		return
+	}
+
+	var since time.Time
+	if value := c.Query("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		since = parsed
+	}
+
+	year, half := resultsPeriod(c)
+	results, err := client.GetResultsContext(c.Request.Context(), year, half)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	checked := time.Now()
+	owner, err := recordGrades(client, dataStorage, year, half, results, checked)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	records, err := util.Grades.Changes(owner, gradesPeriod(year, half), since)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := apimodel.GradeChangesResponse{Changes: make([]apimodel.GradeChange, 0, len(records)), CheckedAt: checked}
+	for _, record := range records {
+		change := apimodel.GradeChange{
+			ID:         record.ID,
+			DetectedAt: record.DetectedAt,
+			Kind:       record.Kind,
+			EventID:    record.EventID,
+			Before:     decodeEvent(record.Before),
+			After:      decodeEvent(record.After),
+		}
+		if change.After != nil {
+			change.SubjectID = change.After.SubjectID
+		} else if change.Before != nil {
+			change.SubjectID = change.Before.SubjectID
+		}
+		response.Changes = append(response.Changes, change)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// recordGrades stores the results in the grade history when the user has opted in, returns the owner of the history.
+// The changes are detected at the time.
+func recordGrades(client *edupage.EdupageClient, dataStorage *util.DataStorageConfig, year, half string, results model.Results, at time.Time) (string, error) {
+	if !dataStorage.StoresGrades() {
+		return "", nil
+	}
+
+	owner, err := util.CacheKeyFromEPClient(client, "grades")
+	if err != nil {
+		return "", err
+	}
+	if _, err := util.Grades.Record(owner, gradesPeriod(year, half), results, at); err != nil {
+		return "", err
+	}
+	return owner, nil
+}
+
+// gradesPeriod identifies the half of the school year in the grade history.
+func gradesPeriod(year, half string) string {
+	return year + ":" + half
+}
+
+func decodeEvent(encoded string) *model.Event {
+	if encoded == "" {
+		return nil
+	}
+	var event model.Event
+	if err := json.Unmarshal([]byte(encoded), &event); err != nil {
+		return nil
+	}
+	return &event
+}
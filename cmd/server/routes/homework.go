@@ -0,0 +1,223 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"github.com/gin-gonic/gin"
+)
+
+var homeworkStatuses = []string{model.HomeworkPending, model.HomeworkDone, model.HomeworkOverdue}
+
+var (
+	errHomeworkNotFound     = errors.New("homework not found")
+	errHomeworkItemNotFound = errors.New("homework is not on the timeline")
+	errInvalidStatus        = errors.New("invalid homework status")
+)
+
+// homeworkFilter selects the homework by the query parameters of the request.
+type homeworkFilter struct {
+	subject   string
+	statuses  []string
+	dueAfter  time.Time
+	dueBefore time.Time
+}
+
+// parseHomeworkFilter parses the subject, status, due_after and due_before query parameters.
+func parseHomeworkFilter(c *gin.Context) (homeworkFilter, error) {
+	filter := homeworkFilter{subject: c.Query("subject")}
+
+	for _, status := range c.QueryArray("status") {
+		for _, status := range strings.Split(status, ",") {
+			if !slices.Contains(homeworkStatuses, status) {
+				return homeworkFilter{}, fmt.Errorf("%w: %s", errInvalidStatus, status)
+			}
+			filter.statuses = append(filter.statuses, status)
+		}
+	}
+
+	var err error
+	if after := c.Query("due_after"); after != "" {
+		if filter.dueAfter, err = time.Parse(time.RFC3339, after); err != nil {
+			return homeworkFilter{}, err
+		}
+	}
+	if before := c.Query("due_before"); before != "" {
+		if filter.dueBefore, err = time.Parse(time.RFC3339, before); err != nil {
+			return homeworkFilter{}, err
+		}
+	}
+	return filter, nil
+}
+
+// matchesDue reports whether the homework is due in the window, homework without a due date only matches without a window.
+func (f homeworkFilter) matchesDue(homework model.Homework, location *time.Location) bool {
+	if f.dueAfter.IsZero() && f.dueBefore.IsZero() {
+		return true
+	}
+	due, _, ok := homework.Due(location)
+	if !ok {
+		return false
+	}
+	return (f.dueAfter.IsZero() || !due.Before(f.dueAfter)) && (f.dueBefore.IsZero() || due.Before(f.dueBefore))
+}
+
+// HomeworkHandler godoc
+// @Summary Get the user's homework
+// @Schemes
+// @Description Returns the homework on the user's timeline, ordered by the due date. The homework without a due date is last.
+// @Description The homework assigned in the last 30 days is returned, unless the date is set.
+// @Tags homework
+// @Param Authorization header string true "JWT token"
+// @Param date query string false "Return the homework assigned since the date, RFC3339"
+// @Param subject query string false "Subject ID"
+// @Param status query []string false "Status, pending, done or overdue" collectionFormat(csv)
+// @Param due_after query string false "Only the homework due at or after the time, RFC3339"
+// @Param due_before query string false "Only the homework due before the time, RFC3339"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.HomeworkResponse
+// @Failure 400 {object} apimodel.HomeworkErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/homework [get]
+func HomeworkHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	filter, err := parseHomeworkFilter(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The times of edupage are local times of the school
+	location, err := util.SchoolLocation()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	timeline, ok := itemTimeline(c, client)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	response := apimodel.HomeworkResponse{
+		Homework: []apimodel.Homework{},
+		Counts:   make(map[string]int, len(homeworkStatuses)),
+	}
+	for _, status := range homeworkStatuses {
+		response.Counts[status] = 0
+	}
+
+	for _, homework := range timeline.SortedHomeworks() {
+		if filter.subject != "" && homework.SubjectID() != filter.subject {
+			continue
+		}
+		if !filter.matchesDue(homework, location) {
+			continue
+		}
+
+		converted := convertHomework(client, &timeline, homework, now, location)
+		response.Counts[converted.Status]++
+		if len(filter.statuses) > 0 && !slices.Contains(filter.statuses, converted.Status) {
+			continue
+		}
+		response.Homework = append(response.Homework, converted)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// MarkHomeworkDoneHandler godoc
+// @Summary Mark the homework done
+// @Schemes
+// @Description Marks the homework done on edupage. The date is needed for homework assigned more than 30 days ago.
+// @Tags homework
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Homework ID"
+// @Param date query string false "Date the homework was assigned, RFC3339"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.ReactionResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.ReactionErrorResponse
+// @Failure 422 {object} apimodel.ReactionErrorResponse "Refused by edupage"
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/homework/{id}/done [post]
+func MarkHomeworkDoneHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	timeline, ok := itemTimeline(c, client)
+	if !ok {
+		return
+	}
+
+	homework, ok := timeline.Homeworks[c.Param("id")]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errHomeworkNotFound.Error(), "success": false})
+		return
+	}
+	item, ok := timeline.HomeworkItem(homework)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errHomeworkItemNotFound.Error(), "success": false})
+		return
+	}
+
+	if err := client.MarkHomeworkDoneContext(c.Request.Context(), item); err != nil {
+		c.AbortWithStatusJSON(reactionErrorStatus(err), gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"error": "", "success": true})
+}
+
+// convertHomework normalizes the dates of the homework and links it to its subject.
+// The times are in the location of the school.
+func convertHomework(client *edupage.EdupageClient, timeline *model.Timeline, homework model.Homework, now time.Time, location *time.Location) apimodel.Homework {
+	converted := apimodel.Homework{
+		ID:         homework.ID,
+		HomeworkID: homework.HomeworkID,
+		SuperID:    homework.ESuperID,
+		Type:       homework.Type,
+		Title:      homework.Name,
+		Details:    homework.Details,
+		Author:     homework.AuthorName,
+		Status:     homework.Status(now, location),
+		Done:       homework.Done(),
+	}
+
+	if item, ok := timeline.HomeworkItem(homework); ok {
+		converted.TimelineID = item.ID
+	}
+
+	// Subjects missing from the DBI keep the name sent with the homework
+	if id := homework.SubjectID(); id != "" {
+		subject, err := client.GetSubjectByID(id)
+		if err != nil {
+			subject = model.Subject{ID: id, Name: homework.LessonName}
+		}
+		converted.Subject = &subject
+	}
+
+	if assigned, ok := homework.Assigned(location); ok {
+		converted.Assigned = &assigned
+	}
+	if due, allDay, ok := homework.Due(location); ok {
+		converted.Due = &due
+		converted.AllDay = allDay
+	}
+	if count, err := homework.DoneCount.Int64(); err == nil {
+		converted.DoneCount = int(count)
+	}
+	return converted
+}
@@ -0,0 +1,168 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"github.com/gin-gonic/gin"
+)
+
+var noteKinds = []string{model.NotePraise, model.NoteReprimand, model.NoteOther}
+
+// wholeYear requests the results of both halves of the school year.
+const wholeYear = "RX"
+
+var errInvalidNoteKind = errors.New("invalid note type")
+
+// noteFilter selects the notes by the query parameters of the request.
+type noteFilter struct {
+	kinds  []string
+	after  time.Time
+	before time.Time
+}
+
+// parseNoteFilter parses the type, after and before query parameters.
+func parseNoteFilter(c *gin.Context) (noteFilter, error) {
+	var filter noteFilter
+
+	for _, kind := range c.QueryArray("type") {
+		for _, kind := range strings.Split(kind, ",") {
+			if !slices.Contains(noteKinds, kind) {
+				return noteFilter{}, fmt.Errorf("%w: %s", errInvalidNoteKind, kind)
+			}
+			filter.kinds = append(filter.kinds, kind)
+		}
+	}
+
+	var err error
+	if after := c.Query("after"); after != "" {
+		if filter.after, err = time.Parse(time.RFC3339, after); err != nil {
+			return noteFilter{}, err
+		}
+	}
+	if before := c.Query("before"); before != "" {
+		if filter.before, err = time.Parse(time.RFC3339, before); err != nil {
+			return noteFilter{}, err
+		}
+	}
+	return filter, nil
+}
+
+// matchesDate reports whether the note is from the window, notes without a date only match without a window.
+func (f noteFilter) matchesDate(note model.Note) bool {
+	if f.after.IsZero() && f.before.IsZero() {
+		return true
+	}
+	date, ok := note.ParsedDate()
+	if !ok {
+		return false
+	}
+	return (f.after.IsZero() || !date.Before(f.after)) && (f.before.IsZero() || date.Before(f.before))
+}
+
+// NotesHandler godoc
+// @Summary Get the user's notes
+// @Schemes
+// @Description Returns the praises, reprimands and other behaviour notes of the school year, from the newest one.
+// @Description The counts contain the numbers of the notes in both halves of the year.
+// @Tags grades
+// @Param Authorization header string true "JWT token"
+// @Param year query string false "School year, e.g. 2024 for 2024/2025, the current one by default"
+// @Param type query []string false "Type, praise, reprimand or other" collectionFormat(csv)
+// @Param after query string false "Only the notes from the time on, RFC3339"
+// @Param before query string false "Only the notes from before the time, RFC3339"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.NotesResponse
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/notes [get]
+func NotesHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	filter, err := parseNoteFilter(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	year, _ := resultsPeriod(c)
+	results, err := client.GetResultsContext(c.Request.Context(), year, wholeYear)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := apimodel.NotesResponse{Notes: []apimodel.Note{}, Counts: []apimodel.NoteCounts{}}
+	counts := make(map[string]*apimodel.NoteCounts)
+
+	for _, note := range results.SortedNotes() {
+		if !filter.matchesDate(note) {
+			continue
+		}
+
+		converted := convertNote(client, note)
+		if converted.Half != "" {
+			key := converted.Year + ":" + converted.Half
+			count, ok := counts[key]
+			if !ok {
+				count = &apimodel.NoteCounts{Year: converted.Year, Half: converted.Half}
+				counts[key] = count
+			}
+			switch converted.Kind {
+			case model.NotePraise:
+				count.Praise++
+			case model.NoteReprimand:
+				count.Reprimand++
+			default:
+				count.Other++
+			}
+			count.Total++
+		}
+
+		if len(filter.kinds) > 0 && !slices.Contains(filter.kinds, converted.Kind) {
+			continue
+		}
+		response.Notes = append(response.Notes, converted)
+	}
+
+	for _, count := range counts {
+		response.Counts = append(response.Counts, *count)
+	}
+	slices.SortFunc(response.Counts, func(a, b apimodel.NoteCounts) int {
+		return strings.Compare(a.Year+a.Half, b.Year+b.Half)
+	})
+
+	c.JSON(http.StatusOK, response)
+}
+
+// convertNote parses the date of the note and links it to its subject.
+func convertNote(client *edupage.EdupageClient, note model.Note) apimodel.Note {
+	converted := apimodel.Note{
+		ID:   note.ID,
+		Text: note.Text,
+		Kind: note.Kind(),
+		Type: note.Type,
+	}
+
+	// Subjects missing from the DBI are left out, the notes don't carry their names
+	if note.SubjectID != "" {
+		if subject, err := client.GetSubjectByID(note.SubjectID); err == nil {
+			converted.Subject = &subject
+		}
+	}
+
+	if date, ok := note.ParsedDate(); ok {
+		converted.Date = &date
+		converted.Year, converted.Half = model.SchoolHalf(date)
+	}
+	return converted
+}
@@ -0,0 +1,181 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"github.com/gin-gonic/gin"
+)
+
+var errEmptyReply = errors.New("the reply has no text")
+
+// ReplyHandler godoc
+// @Summary Reply to a timeline item
+// @Schemes
+// @Description Replies to the timeline item, e.g. a message. The date is needed for items older than 30 days.
+// @Tags messages
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Timeline item ID"
+// @Param date query string false "Date the item was added, RFC3339"
+// @Param reply formData apimodel.ReplyRequest true "Reply"
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.ReplyResponse
+// @Failure 400 {object} apimodel.ReactionErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.ReactionErrorResponse
+// @Failure 422 {object} apimodel.ReactionErrorResponse "Refused by edupage"
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/timelineitem/{id}/reply [post]
+func ReplyHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	options := edupage.ReplyOptions{
+		Text:         c.PostForm("text"),
+		ToAuthorOnly: c.PostForm("toAuthorOnly") == "true",
+	}
+	if options.Text == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errEmptyReply.Error(), "success": false})
+		return
+	}
+
+	item, ok := findTimelineItem(c, client)
+	if !ok {
+		return
+	}
+
+	id, err := client.ReplyContext(c.Request.Context(), item, options)
+	if err != nil {
+		c.AbortWithStatusJSON(reactionErrorStatus(err), gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "timelineid": id})
+}
+
+// ConfirmReceiptHandler godoc
+// @Summary Confirm a message has been read
+// @Schemes
+// @Description Sends the read receipt requested by the message. The date is needed for items older than 30 days.
+// @Tags messages
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Timeline item ID"
+// @Param date query string false "Date the item was added, RFC3339"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.ReactionResponse
+// @Failure 400 {object} apimodel.ReactionErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.ReactionErrorResponse
+// @Failure 422 {object} apimodel.ReactionErrorResponse "Refused by edupage"
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/timelineitem/{id}/receipt [post]
+func ConfirmReceiptHandler(c *gin.Context) {
+	react(c, func(client *edupage.EdupageClient, item model.TimelineItem) error {
+		return client.ConfirmReceiptContext(c.Request.Context(), item)
+	})
+}
+
+// LikeHandler godoc
+// @Summary Like a timeline item
+// @Schemes
+// @Description Likes the timeline item. The date is needed for items older than 30 days.
+// @Tags messages
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Timeline item ID"
+// @Param date query string false "Date the item was added, RFC3339"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.ReactionResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.ReactionErrorResponse
+// @Failure 422 {object} apimodel.ReactionErrorResponse "Refused by edupage"
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/timelineitem/{id}/like [post]
+func LikeHandler(c *gin.Context) {
+	react(c, func(client *edupage.EdupageClient, item model.TimelineItem) error {
+		return client.LikeContext(c.Request.Context(), item)
+	})
+}
+
+// VoteHandler godoc
+// @Summary Vote in a poll
+// @Schemes
+// @Description Votes in the poll of the message. Only a single answer is allowed, unless the poll allows multiple ones.
+// @Description The date is needed for items older than 30 days.
+// @Tags messages
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Timeline item ID"
+// @Param date query string false "Date the item was added, RFC3339"
+// @Param vote formData apimodel.VoteRequest true "Chosen answers"
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.ReactionResponse
+// @Failure 400 {object} apimodel.ReactionErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.ReactionErrorResponse
+// @Failure 422 {object} apimodel.ReactionErrorResponse "Refused by edupage"
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/timelineitem/{id}/vote [post]
+func VoteHandler(c *gin.Context) {
+	answers := c.PostFormArray("answer")
+	react(c, func(client *edupage.EdupageClient, item model.TimelineItem) error {
+		return client.VoteContext(c.Request.Context(), item, answers)
+	})
+}
+
+// react runs the reaction on the item from the id path parameter and responds with its result.
+func react(c *gin.Context, reaction func(client *edupage.EdupageClient, item model.TimelineItem) error) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	item, ok := findTimelineItem(c, client)
+	if !ok {
+		return
+	}
+
+	if err := reaction(client, item); err != nil {
+		c.AbortWithStatusJSON(reactionErrorStatus(err), gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"error": "", "success": true})
+}
+
+// findTimelineItem looks up the item from the id path parameter, see itemTimeline.
+// Responds with an error and returns false if the item can't be found.
+func findTimelineItem(c *gin.Context, client *edupage.EdupageClient) (model.TimelineItem, bool) {
+	timeline, ok := itemTimeline(c, client)
+	if !ok {
+		return model.TimelineItem{}, false
+	}
+
+	item, ok := timeline.Items[c.Param("id")]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errTimelineItemNotFound.Error(), "success": false})
+		return model.TimelineItem{}, false
+	}
+	return item, true
+}
+
+// reactionErrorStatus maps the errors of the reactions to response codes.
+func reactionErrorStatus(err error) int {
+	var refused *edupage.RefusedError
+	switch {
+	case errors.As(err, &refused):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, edupage.ErrorRepliesDisabled),
+		errors.Is(err, edupage.ErrorNoReceipt),
+		errors.Is(err, edupage.ErrorNotPoll),
+		errors.Is(err, edupage.ErrorInvalidVote),
+		errors.Is(err, edupage.ErrorNotHomework):
+		return http.StatusBadRequest
+	case errors.Is(err, edupage.ErrorUnauthorized):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
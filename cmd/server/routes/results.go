@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -27,72 +28,34 @@ import (
 func ResultsHandler(c *gin.Context) {
 	client := c.MustGet("client").(*edupage.EdupageClient)
 
-	var cacheKey string
-	var err error
-	if util.ShouldCache {
-		cacheKey, err = util.CacheKeyFromEPClient(client, "results")
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	year, half := resultsPeriod(c)
+	// The preferences are read before the fetch, which may run in the background after the request
+	var dataStorage *util.DataStorageConfig
+	value, _ := c.Get("dataStorage")
+	if storage, ok := value.(*util.DataStorageConfig); ok && storage != nil {
+		preferences := *storage
+		dataStorage = &preferences
+	}
 
-		cached, err := util.IsCached(cacheKey)
+	results, ok := cached(c, client, resultsCache, func(ctx context.Context) (model.Results, error) {
+		results, err := client.GetResultsContext(ctx, year, half)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return model.Results{}, err
 		}
 
-		if cached {
-			var results model.Results
-			read, err := util.ReadCache(cacheKey, &results)
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			if read {
-				c.JSON(http.StatusOK, results)
-
-				go func() {
-					year := c.Query("year")
-					half := c.Query("half")
-
-					if year == "" {
-						month := time.Now().Month()
-						if month >= time.January && month <= time.August {
-							year = time.Now().AddDate(-1, 0, 0).Format("2006")
-						}
-						if month >= time.September && month <= time.December {
-							year = time.Now().Format("2006")
-						}
-					}
-					if half == "" {
-						month := time.Now().Month()
-						if month == time.January {
-							half = "P1"
-						}
-						if month >= time.February && month <= time.August {
-							half = "P2"
-						}
-						if month >= time.September && month <= time.December {
-							half = "P1"
-						}
-					}
-
-					results, err := client.GetResults(year, half)
-					if err != nil {
-						c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-						return
-					}
-
-					_ = util.CacheData(cacheKey, results, util.TTLFromType("results"))
-				}()
-
-				return
-			}
-		}
+		// Every retrieval can contain new grades, including the refreshes in the background
+		_, _ = recordGrades(client, dataStorage, year, half, results, time.Now())
+		return results, nil
+	}, year, half)
+	if !ok {
+		return
 	}
 
+	c.JSON(http.StatusOK, results.Data)
+}
+
+// resultsPeriod returns the school year and the half of it from the year and half query parameters, the current ones by default.
+func resultsPeriod(c *gin.Context) (string, string) {
 	year := c.Query("year")
 	half := c.Query("half")
 
@@ -117,16 +80,5 @@ func ResultsHandler(c *gin.Context) {
 			half = "P1"
 		}
 	}
-
-	results, err := client.GetResults(year, half)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, results)
-
-	if util.ShouldCache {
-		_ = util.CacheData(cacheKey, results, util.TTLFromType("results"))
-	}
+	return year, half
 }
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"github.com/gin-gonic/gin"
+)
+
+// ClassTimetableHandler godoc
+// @Summary Get the timetable of a class
+// @Schemes
+// @Description Returns the timetable of any class of the school, from today to a week from today by default.
+// @Tags timetable
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Class ID"
+// @Param range query apimodel.TimetableRangeRequest false "Date range"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.CompleteTimetable
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.InternalErrorResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/timetable/class/{id} [get]
+func ClassTimetableHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+	schoolTimetable(c, client.GetClassTimetableContext)
+}
+
+// TeacherTimetableHandler godoc
+// @Summary Get the timetable of a teacher
+// @Schemes
+// @Description Returns the timetable of any teacher of the school, from today to a week from today by default.
+// @Tags timetable
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Teacher ID"
+// @Param range query apimodel.TimetableRangeRequest false "Date range"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.CompleteTimetable
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.InternalErrorResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/timetable/teacher/{id} [get]
+func TeacherTimetableHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+	schoolTimetable(c, client.GetTeacherTimetableContext)
+}
+
+// ClassroomTimetableHandler godoc
+// @Summary Get the timetable of a classroom
+// @Schemes
+// @Description Returns the timetable of any classroom of the school, from today to a week from today by default.
+// @Tags timetable
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Classroom ID"
+// @Param range query apimodel.TimetableRangeRequest false "Date range"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.CompleteTimetable
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.InternalErrorResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/timetable/classroom/{id} [get]
+func ClassroomTimetableHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+	schoolTimetable(c, client.GetClassroomTimetableContext)
+}
+
+// schoolTimetable responds with the timetable of the class, teacher or classroom in the id path parameter.
+func schoolTimetable(c *gin.Context, fetch func(ctx context.Context, id string, from, to time.Time) (model.Timetable, error)) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	from, to, err := weekRange(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := client.GetUserContext(c.Request.Context(), false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	timetable, err := fetch(c.Request.Context(), c.Param("id"), from, to)
+	if errors.Is(err, edupage.ErrorNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, convertTimetable(&user.DBI, timetable))
+}
+
+// weekRange parses the from and to query parameters, from today to a week from today by default.
+func weekRange(c *gin.Context) (time.Time, time.Time, error) {
+	from := time.Now()
+	to := from.AddDate(0, 0, 7)
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+	}
+	return from, to, nil
+}
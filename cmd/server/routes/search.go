@@ -182,7 +182,7 @@ func ConversationSearchHandler(c *gin.Context) {
 	client := c.MustGet("client").(*edupage.EdupageClient)
 
 	// Get user info
-	user, err := client.GetUser(false)
+	user, err := client.GetUserContext(c.Request.Context(), false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to get user information: " + err.Error(),
@@ -32,5 +32,9 @@ func ServerCapabilities(c *gin.Context) {
 		"storage":     config.AppConfig.Database.Enabled,
 		"encryption":  config.AppConfig.Encryption.Enabled,
 		"meilisearch": config.AppConfig.Meilisearch.Enabled,
+		// Refresh tokens are stored in the database
+		"refreshTokens": config.AppConfig.Database.Enabled,
+		// Grade changes are detected using the snapshots stored in the database
+		"gradeHistory": config.AppConfig.Database.Enabled,
 	})
 }
@@ -0,0 +1,474 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	threadsPageSize    = 20
+	threadsMaxPageSize = 50
+	// threadsWindowDays is how many days of the timeline are fetched at once
+	threadsWindowDays = 30
+	// threadsMaxWindows limits the windows fetched for a single page, so long periods without messages don't stall the request
+	threadsMaxWindows = 4
+	// threadsLookbackDays is how far into the past the pagination goes
+	threadsLookbackDays = 365
+
+	cursorDateFormat = "2006-01-02"
+)
+
+var (
+	errThreadNotFound       = errors.New("thread not found")
+	errTimelineItemNotFound = errors.New("timeline item not found")
+	errInvalidCursor        = errors.New("invalid cursor")
+	errInvalidLimit         = errors.New("invalid limit")
+)
+
+// threadCursor is the position of a page of threads, sent to the clients as an opaque string.
+// The pages walk the timeline backwards in windows of threadsWindowDays, the threads are ordered by their last activity.
+type threadCursor struct {
+	// To is the last day of the window the page starts in
+	To string `json:"to"`
+	// Floor is the first day the pagination reaches
+	Floor string `json:"floor"`
+	// Activity and ID are the position of the last thread returned from the window
+	Activity int64  `json:"activity,omitempty"`
+	ID       string `json:"id,omitempty"`
+	// Spanning are the threads already returned whose root is in an older window, the older windows skip them
+	Spanning []spanningThread `json:"spanning,omitempty"`
+}
+
+// spanningThread is a thread with replies in a newer window than its root.
+type spanningThread struct {
+	ID string `json:"id"`
+	// Root is when the root message was added
+	Root int64 `json:"root"`
+}
+
+func newThreadCursor(now time.Time) threadCursor {
+	return threadCursor{
+		To:    now.Format(cursorDateFormat),
+		Floor: now.AddDate(0, 0, -threadsLookbackDays).Format(cursorDateFormat),
+	}
+}
+
+func parseThreadCursor(s string) (threadCursor, error) {
+	if s == "" {
+		return newThreadCursor(time.Now()), nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return threadCursor{}, errInvalidCursor
+	}
+
+	var cursor threadCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return threadCursor{}, errInvalidCursor
+	}
+	if _, err := time.Parse(cursorDateFormat, cursor.To); err != nil {
+		return threadCursor{}, errInvalidCursor
+	}
+	if _, err := time.Parse(cursorDateFormat, cursor.Floor); err != nil {
+		return threadCursor{}, errInvalidCursor
+	}
+	return cursor, nil
+}
+
+func (cursor threadCursor) String() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// window returns the days of the timeline the cursor points to, it never reaches past the floor.
+func (cursor threadCursor) window() (from, to, floor time.Time) {
+	to, _ = time.Parse(cursorDateFormat, cursor.To)
+	floor, _ = time.Parse(cursorDateFormat, cursor.Floor)
+	from = to.AddDate(0, 0, -(threadsWindowDays - 1))
+	if from.Before(floor) {
+		from = floor
+	}
+	return from, to, floor
+}
+
+// after reports whether the thread comes after the position of the cursor.
+func (cursor threadCursor) after(thread *model.Thread) bool {
+	if cursor.ID == "" {
+		return true
+	}
+	position := model.Thread{ID: cursor.ID, LastActivity: time.Unix(cursor.Activity, 0)}
+	return position.Before(thread)
+}
+
+// returned reports whether the thread was already returned by a newer window.
+func (cursor threadCursor) returned(thread *model.Thread) bool {
+	return slices.ContainsFunc(cursor.Spanning, func(spanning spanningThread) bool {
+		return spanning.ID == thread.ID
+	})
+}
+
+// olderThan keeps the spanning threads whose root is older than the time, the others can't appear in the older windows.
+func (cursor threadCursor) olderThan(t time.Time) []spanningThread {
+	var spanning []spanningThread
+	for _, thread := range cursor.Spanning {
+		if thread.Root < t.Unix() {
+			spanning = append(spanning, thread)
+		}
+	}
+	return spanning
+}
+
+// threadTimelines fetches the windows of the timeline, every window is fetched once per request.
+type threadTimelines struct {
+	c       *gin.Context
+	client  *edupage.EdupageClient
+	fetched map[string]model.Timeline
+}
+
+func (w *threadTimelines) get(from, to time.Time) (model.Timeline, error) {
+	key := from.Format(cursorDateFormat) + ":" + to.Format(cursorDateFormat)
+	if timeline, ok := w.fetched[key]; ok {
+		return timeline, nil
+	}
+	timeline, err := w.client.GetTimelineContext(w.c.Request.Context(), from, to)
+	if err != nil {
+		return model.Timeline{}, err
+	}
+	w.fetched[key] = timeline
+	return timeline, nil
+}
+
+// widened fetches the window of the cursor together with the older windows holding the roots of the threads active in it,
+// so the threads with replies in several windows are complete. The roots are looked for up to threadsMaxWindows back.
+func (w *threadTimelines) widened(cursor threadCursor) (model.Timeline, error) {
+	from, to, floor := cursor.window()
+	timeline, err := w.get(from, to)
+	if err != nil {
+		return model.Timeline{}, err
+	}
+
+	widened := model.Timeline{Items: maps.Clone(timeline.Items)}
+	older := from
+	for windows := 0; windows < threadsMaxWindows && older.After(floor) && hasPartialThreads(&widened, from); windows++ {
+		olderFrom, olderTo, _ := threadCursor{To: older.AddDate(0, 0, -1).Format(cursorDateFormat), Floor: cursor.Floor}.window()
+		timeline, err := w.get(olderFrom, olderTo)
+		if err != nil {
+			return model.Timeline{}, err
+		}
+		maps.Copy(widened.Items, timeline.Items)
+		older = olderFrom
+	}
+	return widened, nil
+}
+
+// hasPartialThreads reports whether a thread active since the time misses its root.
+func hasPartialThreads(timeline *model.Timeline, since time.Time) bool {
+	for _, thread := range timeline.Threads() {
+		if thread.Partial && !thread.LastActivity.Before(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// ThreadsHandler godoc
+// @Summary Get the message threads
+// @Schemes
+// @Description Returns the conversations on the timeline, the most recently active first. Replies are nested under the message they reply to.
+// @Description The pages go back a year, use next_cursor to request the next page. An empty next_cursor marks the last page.
+// @Tags messages
+// @Param Authorization header string true "JWT token"
+// @Param limit query int false "Threads per page" default(20) maximum(50)
+// @Param cursor query string false "Cursor of the page"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.ThreadsResponse
+// @Failure 400 {object} apimodel.ThreadErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/threads [get]
+func ThreadsHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	limit := threadsPageSize
+	if s := c.Query("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > threadsMaxPageSize {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errInvalidLimit.Error()})
+			return
+		}
+	}
+
+	cursor, err := parseThreadCursor(c.Query("cursor"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, err := newThreadReader(c, client)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	timelines := &threadTimelines{c: c, client: client, fetched: make(map[string]model.Timeline)}
+	page := []apimodel.Thread{}
+	next := ""
+	for windows := 0; windows < threadsMaxWindows; windows++ {
+		from, _, floor := cursor.window()
+		timeline, err := timelines.widened(cursor)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		threads := timeline.Threads()
+		full := false
+		for i := range threads {
+			thread := &threads[i]
+			// Every thread belongs to the window of its last activity, the older threads are returned by the older windows
+			if thread.LastActivity.Before(from) || cursor.returned(thread) || !cursor.after(thread) {
+				continue
+			}
+			if len(page) == limit {
+				full = true
+				break
+			}
+
+			page = append(page, reader.thread(thread))
+			cursor.Activity = thread.LastActivity.Unix()
+			cursor.ID = thread.ID
+			if root := thread.Root.TimeAdded.Time; root.Before(from) {
+				cursor.Spanning = append(cursor.Spanning, spanningThread{ID: thread.ID, Root: root.Unix()})
+			}
+		}
+
+		if full {
+			// The next page continues in the same window
+			next = cursor.String()
+			break
+		}
+		if !from.After(floor) {
+			next = ""
+			break
+		}
+
+		cursor = threadCursor{
+			To:       from.AddDate(0, 0, -1).Format(cursorDateFormat),
+			Floor:    cursor.Floor,
+			Spanning: cursor.olderThan(from),
+		}
+		next = cursor.String()
+		if len(page) == limit {
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, apimodel.ThreadsResponse{
+		Threads:    page,
+		NextCursor: next,
+	})
+}
+
+// ThreadHandler godoc
+// @Summary Get a message thread
+// @Schemes
+// @Description Returns the thread started by the message, with all replies to it. The date is needed for threads older than 30 days.
+// @Tags messages
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Timeline item ID of the message"
+// @Param date query string false "Date the thread was started, RFC3339"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.Thread
+// @Failure 400 {object} apimodel.ThreadErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.ThreadErrorResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/threads/{id} [get]
+func ThreadHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	thread, ok := findThread(c, client)
+	if !ok {
+		return
+	}
+
+	reader, err := newThreadReader(c, client)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, reader.thread(&thread))
+}
+
+// MarkThreadReadHandler godoc
+// @Summary Mark a thread as read
+// @Schemes
+// @Description Marks all messages of the thread as read, replies added later are unread.
+// @Tags messages
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Timeline item ID of the message"
+// @Param date query string false "Date the thread was started, RFC3339"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.Thread
+// @Failure 400 {object} apimodel.ThreadErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.ThreadErrorResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/threads/{id}/read [post]
+func MarkThreadReadHandler(c *gin.Context) {
+	markThread(c, func(owner string, thread *model.Thread) error {
+		return util.ThreadReads.MarkRead(owner, thread.ID, thread.LastActivity)
+	})
+}
+
+// MarkThreadUnreadHandler godoc
+// @Summary Mark a thread as unread
+// @Schemes
+// @Description Marks all messages of the thread as unread.
+// @Tags messages
+// @Param Authorization header string true "JWT token"
+// @Param id path string true "Timeline item ID of the message"
+// @Param date query string false "Date the thread was started, RFC3339"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.Thread
+// @Failure 400 {object} apimodel.ThreadErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.ThreadErrorResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/threads/{id}/read [delete]
+func MarkThreadUnreadHandler(c *gin.Context) {
+	markThread(c, func(owner string, thread *model.Thread) error {
+		return util.ThreadReads.MarkUnread(owner, thread.ID)
+	})
+}
+
+// markThread changes the read state of the thread and responds with the updated thread.
+func markThread(c *gin.Context, mark func(owner string, thread *model.Thread) error) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	thread, ok := findThread(c, client)
+	if !ok {
+		return
+	}
+
+	owner, err := threadOwner(client)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := mark(owner, &thread); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	reader, err := newThreadReader(c, client)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, reader.thread(&thread))
+}
+
+// findThread looks up the thread from the id path parameter, see itemTimeline.
+// Responds with an error and returns false if the thread can't be found.
+func findThread(c *gin.Context, client *edupage.EdupageClient) (model.Thread, bool) {
+	timeline, ok := itemTimeline(c, client)
+	if !ok {
+		return model.Thread{}, false
+	}
+
+	thread, ok := timeline.Thread(c.Param("id"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errThreadNotFound.Error()})
+		return model.Thread{}, false
+	}
+	return thread, true
+}
+
+// threadOwner returns the key the read marks of the user are stored under, parents have separate marks for every child.
+func threadOwner(client *edupage.EdupageClient) (string, error) {
+	return util.CacheKeyFromEPClient(client, "threads")
+}
+
+// threadReader converts the threads to the API model, together with their read state.
+type threadReader struct {
+	user  model.User
+	marks map[string]time.Time
+}
+
+func newThreadReader(c *gin.Context, client *edupage.EdupageClient) (*threadReader, error) {
+	user, err := client.GetUserContext(c.Request.Context(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := threadOwner(client)
+	if err != nil {
+		return nil, err
+	}
+
+	marks, err := util.ThreadReads.Get(owner)
+	if err != nil {
+		return nil, err
+	}
+	return &threadReader{user: user, marks: marks}, nil
+}
+
+func (r *threadReader) thread(thread *model.Thread) apimodel.Thread {
+	response := apimodel.Thread{
+		ID:           thread.ID,
+		Partial:      thread.Partial,
+		MessageCount: thread.MessageCount,
+		LastActivity: thread.LastActivity,
+		Participants: thread.Participants(&r.user.DBI),
+	}
+
+	readUntil, read := r.marks[thread.ID]
+	if read {
+		response.ReadUntil = &readUntil
+	}
+
+	var convert func(message *model.ThreadMessage) apimodel.ThreadMessage
+	convert = func(message *model.ThreadMessage) apimodel.ThreadMessage {
+		// The user's own messages are never unread
+		unread := message.Owner != r.user.UserRow.UserID && (!read || message.TimeAdded.After(readUntil))
+		if unread {
+			response.UnreadCount++
+		}
+
+		converted := apimodel.ThreadMessage{
+			TimelineItem: message.TimelineItem,
+			Payload:      typedData(&message.TimelineItem),
+			Unread:       unread,
+			Replies:      make([]apimodel.ThreadMessage, 0, len(message.Replies)),
+		}
+		for _, reply := range message.Replies {
+			converted.Replies = append(converted.Replies, convert(reply))
+		}
+		return converted
+	}
+	response.Root = convert(thread.Root)
+
+	return response
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
-	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
 	"github.com/DislikesSchool/EduPage2-server/edupage"
 	"github.com/DislikesSchool/EduPage2-server/edupage/model"
 	"github.com/gin-gonic/gin"
@@ -20,64 +19,19 @@ import (
 // @Param Authorization header string true "JWT token"
 // @Produce json
 // @Security Bearer
-// @Success 200 {object} apimodel.Timeline
+// @Success 200 {object} apimodel.TypedTimeline
 // @Failure 401 {object} apimodel.UnauthorizedResponse
 // @Failure 500 {object} apimodel.InternalErrorResponse
 // @Router /api/timeline/recent [get]
 func RecentTimelineHandler(c *gin.Context) {
 	client := c.MustGet("client").(*edupage.EdupageClient)
 
-	var cacheKey string
-	var err error
-	if util.ShouldCache {
-		cacheKey, err = util.CacheKeyFromEPClient(client, "timeline")
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		cached, err := util.IsCached(cacheKey)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		if cached {
-			var timeline model.Timeline
-			read, err := util.ReadCache(cacheKey, &timeline)
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			if read {
-				c.JSON(http.StatusOK, timeline)
-
-				go func() {
-					timeline, err := client.GetRecentTimeline()
-					if err != nil {
-						return
-					}
-
-					_ = util.CacheData(cacheKey, timeline, util.TTLFromType("timeline"))
-				}()
-
-				return
-			}
-		}
-	}
-
-	timeline, err := client.GetRecentTimeline()
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	timeline, ok := cached(c, client, timelineCache, client.GetRecentTimelineContext)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, timeline)
-
-	if util.ShouldCache {
-		_ = util.CacheData(cacheKey, timeline, util.TTLFromType("timeline"))
-	}
+	c.JSON(http.StatusOK, typedTimeline(timeline.Data))
 }
 
 // TimelineHandler godoc
@@ -89,7 +43,7 @@ func RecentTimelineHandler(c *gin.Context) {
 // @Param range query apimodel.TimelineRequest true "Date range"
 // @Produce json
 // @Security Bearer
-// @Success 200 {object} apimodel.Timeline
+// @Success 200 {object} apimodel.TypedTimeline
 // @Failure 401 {object} apimodel.UnauthorizedResponse
 // @Failure 500 {object} apimodel.InternalErrorResponse
 // @Router /api/timeline [get]
@@ -119,31 +73,43 @@ func TimelineHandler(c *gin.Context) {
 		return
 	}
 
-	timeline, err := client.GetTimeline(dateFrom, dateTo)
+	timeline, err := client.GetTimelineContext(c.Request.Context(), dateFrom, dateTo)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, timeline)
+	c.JSON(http.StatusOK, typedTimeline(timeline))
 }
 
 // SendMessageHandler godoc
 // @Summary Send a message
 // @Schemes
-// @Description Sends a message to a recipient.
+// @Description Sends a message to a recipient. Files can be attached by sending a multipart form with the files in the attachments field,
+// @Description they are uploaded to edupage before the message is sent. The size, count and types of the files are limited by the server configuration.
 // @Tags messages
 // @Param Authorization header string true "JWT token"
 // @Param message body apimodel.SendMessageRequest true "Message"
+// @Param attachments formData file false "Attached files"
+// @Accept x-www-form-urlencoded,mpfd
 // @Produce json
 // @Security Bearer
 // @Success 200
+// @Failure 400 {object} apimodel.InternalErrorResponse
 // @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 413 {object} apimodel.InternalErrorResponse
+// @Failure 415 {object} apimodel.InternalErrorResponse
+// @Failure 422 {object} apimodel.InternalErrorResponse "Refused by edupage"
 // @Failure 500 {object} apimodel.InternalErrorResponse
 // @Router /api/message [post]
 func SendMessageHandler(c *gin.Context) {
 	client := c.MustGet("client").(*edupage.EdupageClient)
 
+	files, ok := attachmentFiles(c)
+	if !ok {
+		return
+	}
+
 	recipient := c.PostForm("recipient")
 	optsJson := c.PostForm("message")
 
@@ -153,7 +119,13 @@ func SendMessageHandler(c *gin.Context) {
 		return
 	}
 
-	if err := client.SendMessage(recipient, opts); err != nil {
+	attachments, ok := uploadAttachments(c, client, files)
+	if !ok {
+		return
+	}
+	opts.Attachments = append(opts.Attachments, attachments...)
+
+	if err := client.SendMessageContext(c.Request.Context(), recipient, opts); err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -164,7 +136,7 @@ func SendMessageHandler(c *gin.Context) {
 // TimelineItemHandler godoc
 // @Summary Get the timeline item by ID
 // @Schemes
-// @Description Returns the timeline item by ID.
+// @Description Returns the timeline item by ID, together with all replies to it.
 // @Tags timeline
 // @Param Authorization header string true "JWT token"
 // @Param id path string true "Timeline item ID"
@@ -172,91 +144,110 @@ func SendMessageHandler(c *gin.Context) {
 // @Security Bearer
 // @Success 200 {object} apimodel.TimelineItemWithOrigin
 // @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 404 {object} apimodel.ThreadErrorResponse
 // @Failure 500 {object} apimodel.InternalErrorResponse
 // @Router /api/timelineitem/{id} [get]
 func TimelineItemHandler(c *gin.Context) {
 	client := c.MustGet("client").(*edupage.EdupageClient)
 
-	id := c.Param("id")
-	date := c.Query("date")
+	timeline, ok := itemTimeline(c, client)
+	if !ok {
+		return
+	}
 
-	var timeline model.Timeline
-	var err error
+	thread, ok := timeline.Thread(c.Param("id"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": errTimelineItemNotFound.Error()})
+		return
+	}
 
-	if date != "" {
-		dateTime, err := time.Parse(time.RFC3339, date)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
+	c.JSON(http.StatusOK, timelineItemWithOrigin(thread.Root, client.Credentials.Server))
+}
 
-		timeline, err = client.GetTimeline(dateTime, time.Now())
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	} else {
-		timeline, err = client.GetRecentTimeline()
+// itemTimeline fetches the timeline containing the item, the recent one or the one since the date query parameter.
+// Responds with an error and returns false if the timeline can't be fetched.
+func itemTimeline(c *gin.Context, client *edupage.EdupageClient) (model.Timeline, bool) {
+	date := c.Query("date")
+	if date == "" {
+		timeline, err := client.GetRecentTimelineContext(c.Request.Context())
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return model.Timeline{}, false
 		}
+		return timeline, true
 	}
 
-	timelineItem := timeline.Items[id]
+	from, err := time.Parse(time.RFC3339, date)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return model.Timeline{}, false
+	}
 
-	var replies []apimodel.TimelineItemWithOrigin
-	for _, msg := range timeline.Items {
-		if msg.ReactionTo == timelineItem.ID {
-			replies = append(replies, apimodel.TimelineItemWithOrigin{
-				ID:              msg.ID,
-				Timestamp:       msg.Timestamp,
-				ReactionTo:      msg.ReactionTo,
-				Type:            msg.Type,
-				User:            msg.User,
-				TargetUser:      msg.TargetUser,
-				UserName:        msg.UserName,
-				OtherID:         msg.OtherID,
-				Text:            msg.Text,
-				TimeAdded:       msg.TimeAdded,
-				TimeEvent:       msg.TimeEvent,
-				Data:            msg.Data,
-				Owner:           msg.Owner,
-				OwnerName:       msg.OwnerName,
-				ReactionCount:   msg.ReactionCount,
-				LastReaction:    msg.LastReaction,
-				PomocnyZaznam:   msg.PomocnyZaznam,
-				Removed:         msg.Removed,
-				TimeAddedBTC:    msg.TimeAddedBTC,
-				LastReactionBTC: msg.LastReactionBTC,
-				OriginServer:    client.Credentials.Server,
-			})
-		}
+	timeline, err := client.GetTimelineContext(c.Request.Context(), from, time.Now())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return model.Timeline{}, false
+	}
+	return timeline, true
+}
 
+// timelineItemWithOrigin converts the message together with all replies to it, at any depth.
+func timelineItemWithOrigin(message *model.ThreadMessage, server string) apimodel.TimelineItemWithOrigin {
+	var replies []apimodel.TimelineItemWithOrigin
+	for _, reply := range message.Replies {
+		replies = append(replies, timelineItemWithOrigin(reply, server))
 	}
 
-	c.JSON(http.StatusOK, apimodel.TimelineItemWithOrigin{
-		ID:              timelineItem.ID,
-		Timestamp:       timelineItem.Timestamp,
-		ReactionTo:      timelineItem.ReactionTo,
-		Type:            timelineItem.Type,
-		User:            timelineItem.User,
-		TargetUser:      timelineItem.TargetUser,
-		UserName:        timelineItem.UserName,
-		OtherID:         timelineItem.OtherID,
-		Text:            timelineItem.Text,
-		TimeAdded:       timelineItem.TimeAdded,
-		TimeEvent:       timelineItem.TimeEvent,
-		Data:            timelineItem.Data,
-		Owner:           timelineItem.Owner,
-		OwnerName:       timelineItem.OwnerName,
-		ReactionCount:   timelineItem.ReactionCount,
-		LastReaction:    timelineItem.LastReaction,
-		PomocnyZaznam:   timelineItem.PomocnyZaznam,
-		Removed:         timelineItem.Removed,
-		TimeAddedBTC:    timelineItem.TimeAddedBTC,
-		LastReactionBTC: timelineItem.LastReactionBTC,
-		OriginServer:    client.Credentials.Server,
+	return apimodel.TimelineItemWithOrigin{
+		ID:              message.ID,
+		Timestamp:       message.Timestamp,
+		ReactionTo:      message.ReactionTo,
+		Type:            message.Type,
+		User:            message.User,
+		TargetUser:      message.TargetUser,
+		UserName:        message.UserName,
+		OtherID:         message.OtherID,
+		Text:            message.Text,
+		TimeAdded:       message.TimeAdded,
+		TimeEvent:       message.TimeEvent,
+		Data:            message.Data,
+		Payload:         typedData(&message.TimelineItem),
+		Owner:           message.Owner,
+		OwnerName:       message.OwnerName,
+		ReactionCount:   message.ReactionCount,
+		LastReaction:    message.LastReaction,
+		PomocnyZaznam:   message.PomocnyZaznam,
+		Removed:         message.Removed,
+		TimeAddedBTC:    message.TimeAddedBTC,
+		LastReactionBTC: message.LastReactionBTC,
+		OriginServer:    server,
 		Replies:         replies,
-	})
+	}
+}
+
+// typedTimeline decodes the payloads of the timeline items and homeworks.
+func typedTimeline(timeline model.Timeline) apimodel.TypedTimeline {
+	typed := apimodel.TypedTimeline{
+		Homeworks: make(map[string]apimodel.TypedHomework, len(timeline.Homeworks)),
+		Items:     make(map[string]apimodel.TypedTimelineItem, len(timeline.Items)),
+	}
+
+	for id, item := range timeline.Items {
+		typed.Items[id] = apimodel.TypedTimelineItem{TimelineItem: item, Payload: typedData(&item)}
+	}
+	for id, homework := range timeline.Homeworks {
+		// The payload is omitted when it doesn't match the homework
+		payload, _ := homework.TypedData()
+		typed.Homeworks[id] = apimodel.TypedHomework{Homework: homework, Payload: payload}
+	}
+	return typed
+}
+
+// typedData decodes the payload of the item, the payload is omitted when it doesn't match its type.
+func typedData(item *model.TimelineItem) model.TimelineData {
+	data, err := item.TypedData()
+	if err != nil {
+		return nil
+	}
+	return data
 }
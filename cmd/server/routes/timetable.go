@@ -1,11 +1,11 @@
 package routes
 
 import (
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
-	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
 	"github.com/DislikesSchool/EduPage2-server/edupage"
 	"github.com/DislikesSchool/EduPage2-server/edupage/model"
 	"github.com/gin-gonic/gin"
@@ -26,152 +26,24 @@ import (
 func RecentTimetableHandler(c *gin.Context) {
 	client := c.MustGet("client").(*edupage.EdupageClient)
 
-	var cacheKey string
-	var err error
-	if util.ShouldCache {
-		cacheKey, err = util.CacheKeyFromEPClient(client, "timetable")
+	timetable, ok := cached(c, client, timetableCache, func(ctx context.Context) (apimodel.CompleteTimetable, error) {
+		timetable, err := client.GetRecentTimetableContext(ctx)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return apimodel.CompleteTimetable{}, err
 		}
 
-		cached, err := util.IsCached(cacheKey)
+		user, err := client.GetUserContext(ctx, false)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return apimodel.CompleteTimetable{}, err
 		}
 
-		if cached {
-			var timetable apimodel.CompleteTimetable
-			read, err := util.ReadCache(cacheKey, &timetable)
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			if read {
-				c.JSON(http.StatusOK, timetable)
-
-				go func() {
-					timetable, err := client.GetRecentTimetable()
-					if err != nil {
-						return
-					}
-
-					user, err := client.GetUser(false)
-					if err != nil {
-						return
-					}
-
-					completeTimetable := apimodel.CompleteTimetable{
-						Days: make(map[string][]apimodel.CompleteTimetableItem, len(timetable.Days)),
-					}
-
-					for date, items := range timetable.Days {
-						for _, item := range items {
-							completeItem := apimodel.CompleteTimetableItem{
-								Type:       item.Type,
-								Date:       item.Date,
-								Period:     item.Period,
-								StartTime:  item.StartTime,
-								EndTime:    item.EndTime,
-								Subject:    user.DBI.Subjects[item.SubjectID],
-								Classes:    make([]model.Class, len(item.ClassIDs)),
-								GroupNames: item.GroupNames,
-								IGroupID:   item.IGroupID,
-								Teachers:   make([]model.Teacher, len(item.TeacherIDs)),
-								Classrooms: make([]model.Classroom, len(item.ClassroomIDs)),
-								StudentIDs: item.StudentIDs,
-								Colors:     item.Colors,
-							}
-
-							for i, classID := range item.ClassIDs {
-								completeItem.Classes[i] = user.DBI.Classes[classID]
-							}
-
-							for i, teacherID := range item.TeacherIDs {
-								completeItem.Teachers[i] = user.DBI.Teachers[teacherID]
-							}
-
-							for i, classroomID := range item.ClassroomIDs {
-								completeItem.Classrooms[i] = user.DBI.Classrooms[classroomID]
-							}
-
-							if original, ok := completeTimetable.Days[date]; ok {
-								completeTimetable.Days[date] = append(original, completeItem)
-							} else {
-								completeTimetable.Days[date] = []apimodel.CompleteTimetableItem{completeItem}
-							}
-						}
-					}
-
-					_ = util.CacheData(cacheKey, completeTimetable, util.TTLFromType("timetable"))
-				}()
-
-				return
-			}
-		}
-	}
-
-	timetable, err := client.GetRecentTimetable()
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	user, err := client.GetUser(false)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return convertTimetable(&user.DBI, timetable), nil
+	})
+	if !ok {
 		return
 	}
 
-	completeTimetable := apimodel.CompleteTimetable{
-		Days: make(map[string][]apimodel.CompleteTimetableItem, len(timetable.Days)),
-	}
-
-	for date, items := range timetable.Days {
-		for _, item := range items {
-			completeItem := apimodel.CompleteTimetableItem{
-				Type:       item.Type,
-				Date:       item.Date,
-				Period:     item.Period,
-				StartTime:  item.StartTime,
-				EndTime:    item.EndTime,
-				Subject:    user.DBI.Subjects[item.SubjectID],
-				Classes:    make([]model.Class, len(item.ClassIDs)),
-				GroupNames: item.GroupNames,
-				IGroupID:   item.IGroupID,
-				Teachers:   make([]model.Teacher, len(item.TeacherIDs)),
-				Classrooms: make([]model.Classroom, len(item.ClassroomIDs)),
-				StudentIDs: item.StudentIDs,
-				Colors:     item.Colors,
-			}
-
-			for i, classID := range item.ClassIDs {
-				completeItem.Classes[i] = user.DBI.Classes[classID]
-			}
-
-			for i, teacherID := range item.TeacherIDs {
-				completeItem.Teachers[i] = user.DBI.Teachers[teacherID]
-			}
-
-			for i, classroomID := range item.ClassroomIDs {
-				completeItem.Classrooms[i] = user.DBI.Classrooms[classroomID]
-			}
-
-			if original, ok := completeTimetable.Days[date]; ok {
-				completeTimetable.Days[date] = append(original, completeItem)
-			} else {
-				completeTimetable.Days[date] = []apimodel.CompleteTimetableItem{completeItem}
-			}
-		}
-	}
-
-	c.JSON(http.StatusOK, completeTimetable)
-
-	if util.ShouldCache {
-		_ = util.CacheData(cacheKey, completeTimetable, util.TTLFromType("timetable"))
-	}
+	c.JSON(http.StatusOK, timetable.Data)
 }
 
 // RecentTimetableHandler godoc
@@ -213,59 +85,32 @@ func TimetableHandler(c *gin.Context) {
 		return
 	}
 
-	timetable, err := client.GetTimetable(dateFrom, dateTo)
+	timetable, err := client.GetTimetableContext(c.Request.Context(), dateFrom, dateTo)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	user, err := client.GetUser(false)
+	user, err := client.GetUserContext(c.Request.Context(), false)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	completeTimetable := convertTimetable(&user.DBI, timetable)
+
+	c.JSON(http.StatusOK, completeTimetable)
+}
+
+// convertTimetable links the lessons of the timetable to their subjects, classes, teachers and classrooms.
+func convertTimetable(dbi *model.DBI, timetable model.Timetable) apimodel.CompleteTimetable {
 	completeTimetable := apimodel.CompleteTimetable{
 		Days: make(map[string][]apimodel.CompleteTimetableItem, len(timetable.Days)),
 	}
-
 	for date, items := range timetable.Days {
 		for _, item := range items {
-			completeItem := apimodel.CompleteTimetableItem{
-				Type:       item.Type,
-				Date:       item.Date,
-				Period:     item.Period,
-				StartTime:  item.StartTime,
-				EndTime:    item.EndTime,
-				Subject:    user.DBI.Subjects[item.SubjectID],
-				Classes:    make([]model.Class, len(item.ClassIDs)),
-				GroupNames: item.GroupNames,
-				IGroupID:   item.IGroupID,
-				Teachers:   make([]model.Teacher, len(item.TeacherIDs)),
-				Classrooms: make([]model.Classroom, len(item.ClassroomIDs)),
-				StudentIDs: item.StudentIDs,
-				Colors:     item.Colors,
-			}
-
-			for i, classID := range item.ClassIDs {
-				completeItem.Classes[i] = user.DBI.Classes[classID]
-			}
-
-			for i, teacherID := range item.TeacherIDs {
-				completeItem.Teachers[i] = user.DBI.Teachers[teacherID]
-			}
-
-			for i, classroomID := range item.ClassroomIDs {
-				completeItem.Classrooms[i] = user.DBI.Classrooms[classroomID]
-			}
-
-			if original, ok := completeTimetable.Days[date]; ok {
-				completeTimetable.Days[date] = append(original, completeItem)
-			} else {
-				completeTimetable.Days[date] = []apimodel.CompleteTimetableItem{completeItem}
-			}
+			completeTimetable.Days[date] = append(completeTimetable.Days[date], completeTimetableItem(dbi, item))
 		}
 	}
-
-	c.JSON(http.StatusOK, completeTimetable)
+	return completeTimetable
 }
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"github.com/gin-gonic/gin"
+)
+
+// TimetableChangesHandler godoc
+// @Summary Get the changes of the user's timetable
+// @Schemes
+// @Description Returns the cancelled, added, substituted and moved lessons of the user, the substitutions compared with the timetable.
+// @Description The changes from today to a week from today are returned by default.
+// @Tags timetable
+// @Param Authorization header string true "JWT token"
+// @Param range query apimodel.TimetableRangeRequest false "Date range"
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} apimodel.TimetableChangesResponse
+// @Failure 400 {object} apimodel.InternalErrorResponse
+// @Failure 401 {object} apimodel.UnauthorizedResponse
+// @Failure 500 {object} apimodel.InternalErrorResponse
+// @Router /api/timetable/changes [get]
+func TimetableChangesHandler(c *gin.Context) {
+	client := c.MustGet("client").(*edupage.EdupageClient)
+
+	from, to, err := weekRange(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := client.GetUserContext(c.Request.Context(), false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	changes, err := client.GetTimetableChangesContext(c.Request.Context(), from, to)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := apimodel.TimetableChangesResponse{Changes: make([]apimodel.TimetableChange, len(changes))}
+	for i, change := range changes {
+		response.Changes[i] = convertTimetableChange(&user.DBI, change)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// convertTimetableChange links the change to the entities of the DBI.
+func convertTimetableChange(dbi *model.DBI, change model.TimetableChange) apimodel.TimetableChange {
+	substitution := change.Substitution
+	converted := apimodel.TimetableChange{
+		Date:   change.Date,
+		Period: change.Period,
+		Kinds:  change.Kinds,
+		Note:   substitution.Note,
+	}
+	if substitutionType, ok := dbi.SubstitutionTypes[string(substitution.TypeID)]; ok {
+		converted.Type = &substitutionType
+	}
+
+	subjectID, teacherIDs, classroomIDs := substitution.SubjectID, substitution.TeacherIDs, substitution.ClassroomIDs
+	if original := change.Original; original != nil {
+		item := completeTimetableItem(dbi, *original)
+		converted.Original = &item
+
+		if subjectID == "" {
+			subjectID = original.SubjectID
+		}
+		if len(teacherIDs) == 0 {
+			teacherIDs = original.TeacherIDs
+		}
+		if len(classroomIDs) == 0 {
+			classroomIDs = original.ClassroomIDs
+		}
+	}
+
+	if subject, ok := dbi.Subjects[subjectID]; ok {
+		converted.Subject = &subject
+	}
+	converted.Teachers = make([]model.Teacher, len(teacherIDs))
+	for i, id := range teacherIDs {
+		converted.Teachers[i] = dbi.Teachers[id]
+	}
+	converted.Classrooms = make([]model.Classroom, len(classroomIDs))
+	for i, id := range classroomIDs {
+		converted.Classrooms[i] = dbi.Classrooms[id]
+	}
+	return converted
+}
+
+// completeTimetableItem links the lesson to the entities of the DBI.
+func completeTimetableItem(dbi *model.DBI, item model.TimetableItem) apimodel.CompleteTimetableItem {
+	completeItem := apimodel.CompleteTimetableItem{
+		Type:       item.Type,
+		Date:       item.Date,
+		Period:     item.Period,
+		StartTime:  item.StartTime,
+		EndTime:    item.EndTime,
+		Subject:    dbi.Subjects[item.SubjectID],
+		Classes:    make([]model.Class, len(item.ClassIDs)),
+		GroupNames: item.GroupNames,
+		IGroupID:   item.IGroupID,
+		Teachers:   make([]model.Teacher, len(item.TeacherIDs)),
+		Classrooms: make([]model.Classroom, len(item.ClassroomIDs)),
+		StudentIDs: item.StudentIDs,
+		Colors:     item.Colors,
+	}
+
+	for i, classID := range item.ClassIDs {
+		completeItem.Classes[i] = dbi.Classes[classID]
+	}
+	for i, teacherID := range item.TeacherIDs {
+		completeItem.Teachers[i] = dbi.Teachers[teacherID]
+	}
+	for i, classroomID := range item.ClassroomIDs {
+		completeItem.Classrooms[i] = dbi.Classrooms[classroomID]
+	}
+	return completeItem
+}
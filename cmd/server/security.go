@@ -31,7 +31,7 @@ func GetSecurityStatusHandler(c *gin.Context) {
 	username := claims["username"].(string)
 	server := claims["server"].(string)
 
-	clientData, ok := util.Clients[server+username]
+	clientData, ok := util.Clients.Get(util.SessionKey(server, username))
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "client not found"})
 		return
@@ -46,6 +46,12 @@ func GetSecurityStatusHandler(c *gin.Context) {
 			"credentials": dataStorage.Credentials,
 			"messages":    dataStorage.Messages,
 			"timeline":    dataStorage.Timeline,
+			"grades":      dataStorage.Grades,
+		},
+		"session": gin.H{
+			"createdAt": clientData.CreatedAt,
+			"lastUsed":  clientData.LastUsed(),
+			"lastPing":  clientData.LastPing(),
 		},
 	}
 
@@ -58,6 +64,7 @@ func GetSecurityStatusHandler(c *gin.Context) {
 				"lastOnline":    userModel.LastOnline,
 				"storeMessages": userModel.StoreMessages,
 				"storeTimeline": userModel.StoreTimeline,
+				"storeGrades":   userModel.StoreGrades,
 			}
 		}
 	}
@@ -95,12 +102,14 @@ func UpdateDataStoragePrefsHandler(c *gin.Context) {
 	username := claims["username"].(string)
 	server := claims["server"].(string)
 
-	clientData, ok := util.Clients[server+username]
+	clientData, ok := util.Clients.Get(util.SessionKey(server, username))
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "client not found"})
 		return
 	}
 
+	previous := clientData.DataStorage
+
 	// Update the in-memory data storage preferences
 	clientData.DataStorage = &prefs
 
@@ -108,6 +117,11 @@ func UpdateDataStoragePrefsHandler(c *gin.Context) {
 		"dataStorageUpdated": true,
 	}
 
+	// Keep the preferences of the persisted session in sync
+	if err := util.PersistSession(util.SessionKey(server, username), clientData); err != nil {
+		util.LogUserSession("session persist", username, server, err)
+	}
+
 	// If database storage is enabled, update the database
 	if util.ShouldStore {
 		userModel := &dbmodel.User{}
@@ -145,6 +159,7 @@ func UpdateDataStoragePrefsHandler(c *gin.Context) {
 				userModel.LastOnline = time.Now()
 				userModel.StoreMessages = prefs.Messages
 				userModel.StoreTimeline = prefs.Timeline
+				userModel.StoreGrades = prefs.Grades
 
 				if err := util.Db.Save(userModel).Error; err != nil {
 					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user preferences: " + err.Error()})
@@ -162,6 +177,7 @@ func UpdateDataStoragePrefsHandler(c *gin.Context) {
 				LastOnline:    time.Now(),
 				StoreMessages: prefs.Messages,
 				StoreTimeline: prefs.Timeline,
+				StoreGrades:   prefs.Grades,
 			}
 
 			if err := util.Db.Create(userModel).Error; err != nil {
@@ -177,6 +193,15 @@ func UpdateDataStoragePrefsHandler(c *gin.Context) {
 		}
 	}
 
+	// Remove the grade history if the permission has been revoked
+	if previous.StoresGrades() && !prefs.StoresGrades() {
+		if err := util.Grades.Delete(clientData.Client); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete grade history: " + err.Error()})
+			return
+		}
+		changes["gradeHistoryRemoved"] = true
+	}
+
 	// Clean up any cached data if needed
 	if util.ShouldCache {
 		client := clientData.Client
@@ -228,7 +253,7 @@ func DeleteUserDataHandler(c *gin.Context) {
 	username := claims["username"].(string)
 	server := claims["server"].(string)
 
-	clientData, ok := util.Clients[server+username]
+	clientData, ok := util.Clients.Get(util.SessionKey(server, username))
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "client not found"})
 		return
@@ -237,6 +262,22 @@ func DeleteUserDataHandler(c *gin.Context) {
 	result := gin.H{
 		"databaseDeletion": "not applicable",
 		"cacheDeletion":    "not applicable",
+		"sessionDeletion":  "not applicable",
+	}
+
+	// Remove the persisted session, the server will not restore it after a restart
+	if util.ShouldPersistSessions() {
+		if err := util.DeletePersistedSession(util.SessionKey(server, username)); err != nil {
+			result["sessionDeletion"] = "error: " + err.Error()
+		} else {
+			result["sessionDeletion"] = "success"
+		}
+	}
+
+	// Revoke the calendar feeds, they would keep exposing the timetable
+	if err := util.CalendarTokens.RevokeUser(server, username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	// Remove data from database if storage is enabled
@@ -246,6 +287,10 @@ func DeleteUserDataHandler(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user from database: " + dbResult.Error.Error()})
 			return
 		}
+		if err := util.Grades.Delete(clientData.Client); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete grade history: " + err.Error()})
+			return
+		}
 		result["databaseDeletion"] = "success"
 		result["recordsDeleted"] = dbResult.RowsAffected
 	}
@@ -253,7 +298,7 @@ func DeleteUserDataHandler(c *gin.Context) {
 	// Clear any cached data
 	if util.ShouldCache {
 		client := clientData.Client
-		user, err := client.GetUser(false)
+		user, err := client.GetUserContext(c.Request.Context(), false)
 		if err == nil {
 			schoolId := server
 			userId := user.UserRow.UserID
@@ -281,6 +326,7 @@ func DeleteUserDataHandler(c *gin.Context) {
 		Credentials: false,
 		Messages:    false,
 		Timeline:    false,
+		Grades:      false,
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -310,7 +356,7 @@ func RequestDataExportHandler(c *gin.Context) {
 	username := claims["username"].(string)
 	server := claims["server"].(string)
 
-	_, ok := util.Clients[server+username]
+	_, ok := util.Clients.Get(util.SessionKey(server, username))
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "client not found"})
 		return
@@ -336,6 +382,7 @@ func RequestDataExportHandler(c *gin.Context) {
 				"lastOnline":    userModel.LastOnline,
 				"storeMessages": userModel.StoreMessages,
 				"storeTimeline": userModel.StoreTimeline,
+				"storeGrades":   userModel.StoreGrades,
 			}
 
 			// TODO: When implemented, include other stored data like messages, timeline events, etc.
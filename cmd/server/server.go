@@ -37,11 +37,16 @@ import (
 
 func main() {
 	key := config.AppConfig.JWT.Secret
-	if key == "" && gin.Mode() == gin.ReleaseMode {
+	if key == "" && signingAlgorithm() == algorithmHS256 && gin.Mode() == gin.ReleaseMode {
 		fmt.Println("\033[0;31mERROR\033[0m: No JWT_SECRET_KEY environment variable found. Use the JWT_SECRET_KEY environment variable to set the secret key.")
 		panic("No JWT_SECRET_KEY environment variable found")
 	}
 
+	if err := initSigningKeys(); err != nil {
+		fmt.Printf("\033[0;31mERROR\033[0m: %v\n", err)
+		panic("Failed to initialize signing keys")
+	}
+
 	util.Cr = cron.New()
 
 	if util.ShouldCache {
@@ -51,6 +56,33 @@ func main() {
 			Password: config.AppConfig.Redis.Password,
 			DB:       config.AppConfig.Redis.DB,
 		})
+		util.UserCacheStore = util.RedisCacheStore{}
+	}
+
+	switch config.AppConfig.Attachments.Cache.Type {
+	case "":
+	case "disk":
+		dir := config.AppConfig.Attachments.Cache.Dir
+		if dir == "" {
+			dir = "attachments"
+		}
+		store, err := util.NewDiskAttachmentStore(dir, util.AttachmentCacheTTL())
+		if err != nil {
+			fmt.Printf("\033[0;31mERROR\033[0m: %v\n", err)
+			panic("Failed to initialize the attachment cache")
+		}
+		util.AttachmentCache = store
+		if _, err := util.Cr.AddFunc("@hourly", store.Prune); err != nil {
+			panic(err)
+		}
+	case "redis":
+		if !util.ShouldCache {
+			fmt.Println("\033[0;31mERROR\033[0m: The redis attachment cache requires redis to be enabled.")
+			panic("Redis is disabled")
+		}
+		util.AttachmentCache = util.NewRedisAttachmentStore(util.AttachmentCacheTTL())
+	default:
+		panic("Unknown attachment cache type")
 	}
 
 	if config.AppConfig.Encryption.Enabled {
@@ -88,7 +120,7 @@ func main() {
 			panic(err)
 		}
 
-		util.Db.AutoMigrate(&dbmodel.User{})
+		util.Db.AutoMigrate(&dbmodel.User{}, &dbmodel.Session{}, &dbmodel.RefreshToken{}, &dbmodel.LinkedAccount{}, &dbmodel.ThreadRead{}, &dbmodel.GradeSnapshot{}, &dbmodel.GradeChange{}, &dbmodel.CalendarToken{})
 	}
 
 	if util.ShouldSearch {
@@ -118,7 +150,7 @@ func main() {
 		AllowOriginFunc:  func(origin string) bool { return true },
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
 		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Range", "Content-Disposition", "Accept-Ranges", "ETag", "X-Cache", "Age"},
 		AllowCredentials: true,
 		MaxAge:           86400,
 	}))
@@ -128,26 +160,22 @@ func main() {
 
 	router.POST("/login", LoginHandler)
 	router.GET("/validate-token", ValidateTokenHandler)
+	router.POST("/token/refresh", RefreshTokenHandler)
+	router.POST("/token/revoke", RevokeTokenHandler)
+	router.POST("/logout", LogoutHandler)
+	router.POST("/logout/all", LogoutAllHandler)
 	router.GET("/docs/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 	router.GET("/qrlogin", QRLoginHandler)
-	router.POST("/qrlogin/:code", FinishQRLoginHandler)
-
-	api.GET("/timeline", routes.TimelineHandler)
-	api.GET("/timeline/recent", routes.RecentTimelineHandler)
-	api.GET("/timetable", routes.TimetableHandler)
-	api.GET("/timetable/recent", routes.RecentTimetableHandler)
-	api.GET("/subject/:id", routes.SubjectHandler)
-	api.GET("/teacher/:id", routes.TeacherHandler)
-	api.GET("/classroom/:id", routes.ClassroomHandler)
-	api.GET("/periods", routes.PeriodsHandler)
-	api.GET("/timelineitem/:id", routes.TimelineItemHandler)
-	api.GET("/recipients", routes.RecipientsHandler)
-	api.POST("/message", routes.SendMessageHandler)
-	api.GET("/grades", routes.ResultsHandler)
-
-	api.GET("/search/messages", routes.SearchMessagesHandler)
-	api.GET("/search/conversation/:userId", routes.ConversationSearchHandler)
-	api.GET("/search/advanced", routes.MessageFulltextSearchHandler)
+	router.GET("/calendar/:token", routes.CalendarFeedHandler)
+	router.POST("/qrlogin/:code", ApproveQRLoginHandler)
+
+	registerAPIRoutes(api)
+	// Every /api route can be called for a linked account as well
+	registerAPIRoutes(api.Group("/accounts/:account"))
+
+	router.GET("/accounts", AccountsHandler)
+	router.POST("/accounts", LinkAccountHandler)
+	router.DELETE("/accounts/:account", UnlinkAccountHandler)
 
 	srv := router.Group("/server")
 	srv.GET("/version", routes.ServerVersion)
@@ -186,14 +214,32 @@ func main() {
 	router.StaticFS("/icons", http.Dir("./cmd/server/web/icons"))
 
 	router.StaticFile("/.well-known/assetlinks.json", "./cmd/server/.well-known/assetlinks.json")
+	router.GET("/.well-known/jwks.json", JWKSHandler)
 
 	router.NoRoute(func(c *gin.Context) {
 		c.File("./cmd/server/web/index.html")
 	})
 
+	if _, err := util.Cr.AddFunc("@hourly", rotateSigningKeys); err != nil {
+		util.ErrorLogger.Printf("Failed to schedule signing key rotation: %v", err)
+	}
+
 	util.Cr.Start()
 
+	if util.ShouldPersistSessions() {
+		util.InfoLogger.Println("Starting to restore persisted sessions...")
+		util.RestoreSessions()
+	}
+
 	if util.ShouldStore {
+		if _, err := util.Cr.AddFunc("@daily", deleteExpiredRefreshTokens); err != nil {
+			util.ErrorLogger.Printf("Failed to schedule refresh token cleanup: %v", err)
+		}
+
+		if err := util.Accounts.Load(); err != nil {
+			util.ErrorLogger.Printf("Failed to load linked accounts: %v", err)
+		}
+
 		util.InfoLogger.Println("Starting to load stored users...")
 		util.LoadStoredUsers()
 	}
@@ -208,3 +254,48 @@ func main() {
 	}
 	router.Run(host + ":" + port)
 }
+
+// registerAPIRoutes registers the routes which need an edupage session.
+func registerAPIRoutes(g *gin.RouterGroup) {
+	g.GET("/timeline", routes.TimelineHandler)
+	g.GET("/timeline/recent", routes.RecentTimelineHandler)
+	g.GET("/timetable", routes.TimetableHandler)
+	g.GET("/timetable/recent", routes.RecentTimetableHandler)
+	g.GET("/timetable/changes", routes.TimetableChangesHandler)
+	g.GET("/timetable/class/:id", routes.ClassTimetableHandler)
+	g.GET("/timetable/teacher/:id", routes.TeacherTimetableHandler)
+	g.GET("/timetable/classroom/:id", routes.ClassroomTimetableHandler)
+	g.GET("/free/classrooms", routes.FreeClassroomsHandler)
+	g.GET("/free/teachers", routes.FreeTeachersHandler)
+	g.GET("/free/teachers/:id", routes.TeacherFreeTimeHandler)
+	g.GET("/attendance", routes.AttendanceHandler)
+	g.GET("/subject/:id", routes.SubjectHandler)
+	g.GET("/teacher/:id", routes.TeacherHandler)
+	g.GET("/classroom/:id", routes.ClassroomHandler)
+	g.GET("/periods", routes.PeriodsHandler)
+	g.GET("/timelineitem/:id", routes.TimelineItemHandler)
+	g.POST("/timelineitem/:id/reply", routes.ReplyHandler)
+	g.POST("/timelineitem/:id/receipt", routes.ConfirmReceiptHandler)
+	g.POST("/timelineitem/:id/like", routes.LikeHandler)
+	g.POST("/timelineitem/:id/vote", routes.VoteHandler)
+	g.GET("/threads", routes.ThreadsHandler)
+	g.GET("/threads/:id", routes.ThreadHandler)
+	g.POST("/threads/:id/read", routes.MarkThreadReadHandler)
+	g.DELETE("/threads/:id/read", routes.MarkThreadUnreadHandler)
+	g.GET("/recipients", routes.RecipientsHandler)
+	g.POST("/message", routes.SendMessageHandler)
+	g.GET("/attachment", routes.AttachmentHandler)
+	g.GET("/notes", routes.NotesHandler)
+	g.GET("/homework", routes.HomeworkHandler)
+	g.POST("/homework/:id/done", routes.MarkHomeworkDoneHandler)
+	g.GET("/grades", routes.ResultsHandler)
+	g.GET("/grades/summary", routes.GradesSummaryHandler)
+	g.GET("/grades/changes", routes.GradeChangesHandler)
+	g.GET("/children", routes.ChildrenHandler)
+	g.POST("/calendar/token", routes.CreateCalendarTokenHandler)
+	g.DELETE("/calendar/token", routes.RevokeCalendarTokenHandler)
+
+	g.GET("/search/messages", routes.SearchMessagesHandler)
+	g.GET("/search/conversation/:userId", routes.ConversationSearchHandler)
+	g.GET("/search/advanced", routes.MessageFulltextSearchHandler)
+}
@@ -1,17 +1,46 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math/big"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/apimodel"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/crypto"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/dbmodel"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/jwtkeys"
 	"github.com/DislikesSchool/EduPage2-server/cmd/server/routes"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/DislikesSchool/EduPage2-server/config"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/edupagetest"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/robfig/cron/v3"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 var (
@@ -22,6 +51,8 @@ var (
 	ic_username string
 	ic_password string
 	ic_server   string
+
+	fake *edupagetest.Server
 )
 
 func init() {
@@ -34,6 +65,40 @@ func init() {
 	flag.StringVar(&ic_server, "ic_server", "", "iCanteen server")
 }
 
+// TestMain runs the tests against the fake edupage server,
+// unless credentials for a live account are specified.
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	util.Cr = cron.New()
+
+	if err := initSigningKeys(); err != nil {
+		panic(err)
+	}
+
+	if len(username) == 0 && len(password) == 0 {
+		fake = edupagetest.NewServer()
+		username = fake.Username
+		password = fake.Password
+		server = fake.School
+		name = fake.Name()
+
+		util.EdupageOptions = edupage.LoginOptions{BaseURL: fake.URL}
+		edupage.PasswordHashCost = bcrypt.MinCost
+
+		// Allow the fake school, regardless of the whitelist in config.yaml
+		config.AppConfig.Schools.IsBlacklist = false
+		config.AppConfig.Schools.Whitelist = []string{fake.School}
+	}
+
+	code := m.Run()
+
+	if fake != nil {
+		fake.Close()
+	}
+	os.Exit(code)
+}
+
 func TestLoginAuto(t *testing.T) {
 	if len(username) == 0 {
 		t.Log("Username parameter missing, (-username=?)")
@@ -138,6 +203,28 @@ func getAuthToken(t *testing.T) string {
 	return response.Token
 }
 
+// newAPITestRouter creates a router serving the API routes and logs the test user in, do sends a request with their token.
+// The requests with a body are sent as a form.
+func newAPITestRouter(t *testing.T) (*gin.Engine, func(method, path string, body io.Reader) *httptest.ResponseRecorder) {
+	router := gin.Default()
+	api := router.Group("/api")
+	api.Use(authMiddleware())
+	registerAPIRoutes(api)
+
+	token := getAuthToken(t)
+	do := func(method, path string, body io.Reader) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, body)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	return router, do
+}
+
 func TestTimelineHandler(t *testing.T) {
 	if len(username) == 0 || len(password) == 0 {
 		t.Skip("Skipping test: credentials not provided")
@@ -157,6 +244,19 @@ func TestTimelineHandler(t *testing.T) {
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+
+	if fake != nil {
+		var timeline struct {
+			Items map[string]struct {
+				Type    string                 `json:"typ"`
+				Payload map[string]interface{} `json:"payload"`
+			}
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &timeline))
+		assert.Equal(t, "sprava", timeline.Items["100001"].Type)
+		assert.Equal(t, "Zítra nezapomeňte učebnici.", timeline.Items["100001"].Payload["messageContent"])
+		assert.Equal(t, true, timeline.Items["100005"].Payload["receipt"])
+	}
 }
 
 func TestTimetableHandler(t *testing.T) {
@@ -242,3 +342,1554 @@ func TestRecipientsHandler(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestSessionRegistry(t *testing.T) {
+	registry := util.NewSessionRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := util.SessionKey("school", fmt.Sprintf("user%d", j%10))
+				session := util.NewClientData(&edupage.EdupageClient{}, &util.DataStorageConfig{})
+				registry.Set(key, session)
+				if got, ok := registry.Get(key); ok {
+					got.Touch()
+				}
+				if j%3 == 0 {
+					registry.EvictIf(key, session)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, registry.Len(), 10)
+
+	first := util.NewClientData(&edupage.EdupageClient{}, &util.DataStorageConfig{})
+	second := util.NewClientData(&edupage.EdupageClient{}, &util.DataStorageConfig{})
+	registry.Set("key", first)
+	assert.Same(t, first, registry.Set("key", second))
+
+	// A stale session must not evict the newer one
+	assert.False(t, registry.EvictIf("key", first))
+	got, ok := registry.Get("key")
+	assert.True(t, ok)
+	assert.Same(t, second, got)
+	assert.False(t, got.CreatedAt.IsZero())
+	assert.False(t, got.LastUsed().IsZero())
+	assert.True(t, got.LastPing().IsZero())
+
+	count := 0
+	registry.Range(func(key string, session *util.ClientData) bool {
+		count++
+		registry.Evict(key)
+		return true
+	})
+	assert.Greater(t, count, 0)
+	assert.Equal(t, 0, registry.Len())
+}
+
+// useTestDatabase enables the storage in an in-memory sqlite database for the duration of the test.
+func useTestDatabase(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would get its own in-memory database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(&dbmodel.User{}, &dbmodel.Session{}, &dbmodel.RefreshToken{}, &dbmodel.LinkedAccount{}, &dbmodel.ThreadRead{}, &dbmodel.GradeSnapshot{}, &dbmodel.GradeChange{}, &dbmodel.CalendarToken{}); err != nil {
+		t.Fatal(err)
+	}
+
+	shouldStore := util.ShouldStore
+	infoLogger, errorLogger := util.InfoLogger, util.ErrorLogger
+	util.ShouldStore, util.Db = true, db
+	util.InfoLogger, util.ErrorLogger = log.New(io.Discard, "", 0), log.New(io.Discard, "", 0)
+	t.Cleanup(func() {
+		util.ShouldStore, util.Db = shouldStore, nil
+		util.InfoLogger, util.ErrorLogger = infoLogger, errorLogger
+		sqlDB.Close()
+	})
+	return db
+}
+
+func TestPersistedSessions(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	db := useTestDatabase(t)
+
+	if err := crypto.InitCrypto("0123456789abcdef0123456789abcdef"); err != nil {
+		t.Fatal(err)
+	}
+
+	encryption := config.AppConfig.Encryption.Enabled
+	config.AppConfig.Encryption.Enabled = true
+	defer func() {
+		config.AppConfig.Encryption.Enabled = encryption
+	}()
+
+	credentials, err := edupage.LoginWithOptions(fake.Username, fake.Password, fake.School, util.EdupageOptions)
+	assert.NoError(t, err)
+	client, err := edupage.CreateClient(credentials)
+	assert.NoError(t, err)
+
+	key := util.SessionKey(fake.School, fake.Username)
+	session := util.NewClientData(client, &util.DataStorageConfig{Enabled: true, Timeline: true})
+	assert.NoError(t, util.PersistSession(key, session))
+
+	var record dbmodel.Session
+	assert.NoError(t, db.First(&record, "session_key = ?", key).Error)
+	assert.NotContains(t, record.Data, fake.Username, "the session should be encrypted")
+
+	// Simulate a restart of the server
+	util.Clients.Evict(key)
+	assert.Equal(t, 1, util.RestoreSessions())
+
+	restored, ok := util.Clients.Get(key)
+	assert.True(t, ok)
+	assert.True(t, restored.DataStorage.Timeline)
+	_, err = restored.Client.GetRecentTimeline()
+	assert.NoError(t, err)
+
+	// Expired sessions are dropped from the store
+	util.Clients.Evict(key)
+	fake.ExpireSessions()
+	assert.Equal(t, 0, util.RestoreSessions())
+	_, ok = util.Clients.Get(key)
+	assert.False(t, ok)
+
+	var count int64
+	db.Model(&dbmodel.Session{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestRefreshToken(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	useTestDatabase(t)
+
+	router := gin.Default()
+	router.POST("/login", LoginHandler)
+	router.GET("/validate-token", ValidateTokenHandler)
+	router.POST("/token/refresh", RefreshTokenHandler)
+	router.POST("/token/revoke", RevokeTokenHandler)
+
+	type tokenResponse struct {
+		Error        string `json:"error"`
+		Success      bool   `json:"success"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+		Expires      int64  `json:"expires"`
+	}
+
+	post := func(path string, data url.Values) (int, tokenResponse) {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(data.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response tokenResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	code, login := post("/login", url.Values{"username": {username}, "password": {password}, "server": {server}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, login.RefreshToken)
+	assert.Greater(t, login.Expires, time.Now().Unix())
+
+	code, refreshed := post("/token/refresh", url.Values{"refreshToken": {login.RefreshToken}})
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, refreshed.Token)
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+
+	req, _ := http.NewRequest("GET", "/validate-token", nil)
+	req.Header.Set("Authorization", "Bearer "+refreshed.Token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The rotated token was used again, the whole family is revoked
+	code, reused := post("/token/refresh", url.Values{"refreshToken": {login.RefreshToken}})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, errRefreshTokenReused.Error(), reused.Error)
+
+	code, _ = post("/token/refresh", url.Values{"refreshToken": {refreshed.RefreshToken}})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// Revoked explicitly
+	code, login = post("/login", url.Values{"username": {username}, "password": {password}, "server": {server}})
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = post("/token/revoke", url.Values{"refreshToken": {login.RefreshToken}})
+	assert.Equal(t, http.StatusOK, code)
+	code, revoked := post("/token/refresh", url.Values{"refreshToken": {login.RefreshToken}})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, errRefreshTokenRevoked.Error(), revoked.Error)
+
+	code, _ = post("/token/refresh", url.Values{"refreshToken": {"unknown"}})
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestTokensWithoutDatabase(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	db, shouldStore, ttl := util.Db, util.ShouldStore, config.AppConfig.JWT.AccessTTL
+	util.Db, util.ShouldStore, config.AppConfig.JWT.AccessTTL = nil, false, 0
+	t.Cleanup(func() { util.Db, util.ShouldStore, config.AppConfig.JWT.AccessTTL = db, shouldStore, ttl })
+
+	router := gin.Default()
+	router.POST("/login", LoginHandler)
+
+	data := url.Values{"username": {username}, "password": {password}, "server": {server}}
+	req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var login struct {
+		RefreshToken string `json:"refreshToken"`
+		Expires      int64  `json:"expires"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	// The access token can't be renewed, so it lasts as long as the session
+	assert.Empty(t, login.RefreshToken)
+	assert.InDelta(t, time.Now().Add(defaultSessionTokenTTL).Unix(), login.Expires, 5)
+}
+
+func TestLogout(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	useTestDatabase(t)
+
+	router := gin.Default()
+	router.GET("/validate-token", ValidateTokenHandler)
+	router.POST("/logout", LogoutHandler)
+	router.POST("/logout/all", LogoutAllHandler)
+
+	request := func(method, path, token string) int {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	token, other := getAuthToken(t), getAuthToken(t)
+	assert.Equal(t, http.StatusOK, request("GET", "/validate-token", token))
+	assert.Equal(t, http.StatusOK, request("POST", "/logout", token))
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/validate-token", token))
+
+	// The other device still uses the session
+	_, ok := util.Clients.Get(util.SessionKey("login1", username))
+	assert.True(t, ok, "the session should be kept")
+	assert.Equal(t, http.StatusOK, request("GET", "/validate-token", other))
+
+	assert.Equal(t, http.StatusOK, request("POST", "/logout", other))
+	_, ok = util.Clients.Get(util.SessionKey("login1", username))
+	assert.False(t, ok, "the session should be removed with the last login")
+
+	first := getAuthToken(t)
+	second := getAuthToken(t)
+	assert.Equal(t, http.StatusOK, request("POST", "/logout/all", first))
+	assert.Equal(t, http.StatusUnauthorized, request("POST", "/logout", second))
+
+	// Logging in again works after logging out everywhere
+	third := getAuthToken(t)
+	assert.Equal(t, http.StatusOK, request("GET", "/validate-token", third))
+}
+
+func TestLinkedAccounts(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	useTestDatabase(t)
+	t.Cleanup(func() { util.Accounts = util.NewAccountLinks() })
+
+	router := gin.Default()
+	router.GET("/accounts", AccountsHandler)
+	router.POST("/accounts", LinkAccountHandler)
+	router.DELETE("/accounts/:account", UnlinkAccountHandler)
+	api := router.Group("/api")
+	api.Use(authMiddleware())
+	registerAPIRoutes(api)
+	registerAPIRoutes(api.Group("/accounts/:account"))
+
+	request := func(method, path, token string, header http.Header, form url.Values) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	token := getAuthToken(t)
+	identity := util.NewAccount("login1", username)
+	// The fake server accepts the school as the server too, which is a different account
+	linked := util.NewAccount(fake.School, username)
+
+	w := request("POST", "/accounts", token, nil, url.Values{"username": {username}, "password": {password}})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the identity can not be linked to itself")
+
+	w = request("POST", "/accounts", token, nil, url.Values{"username": {username}, "password": {"wrong"}, "server": {fake.School}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = request("POST", "/accounts", token, nil, url.Values{"username": {username}, "password": {password}, "server": {fake.School}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var accounts apimodel.AccountsResponse
+	w = request("GET", "/accounts", token, nil, nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &accounts))
+	if assert.Len(t, accounts.Accounts, 2) {
+		assert.Equal(t, identity.ID, accounts.Accounts[0].ID)
+		assert.True(t, accounts.Accounts[0].Primary)
+		assert.Equal(t, linked.ID, accounts.Accounts[1].ID)
+		assert.True(t, accounts.Accounts[1].Connected)
+	}
+
+	assert.Equal(t, http.StatusOK, request("GET", "/api/periods", token, nil, nil).Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/api/periods", token, http.Header{accountHeader: {linked.ID}}, nil).Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/api/accounts/"+linked.ID+"/periods", token, nil, nil).Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/api/accounts/"+identity.ID+"/periods", token, nil, nil).Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/api/accounts/unknown/periods", token, nil, nil).Code)
+
+	// The links survive a restart
+	util.Accounts = util.NewAccountLinks()
+	assert.NoError(t, util.Accounts.Load())
+	_, ok := util.Accounts.Find(identity.Key(), linked.ID)
+	assert.True(t, ok)
+
+	assert.Equal(t, http.StatusOK, request("DELETE", "/accounts/"+linked.ID, token, nil, nil).Code)
+	assert.Equal(t, http.StatusNotFound, request("DELETE", "/accounts/"+linked.ID, token, nil, nil).Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/api/periods", token, http.Header{accountHeader: {linked.ID}}, nil).Code)
+
+	// Linking an account with a live session keeps the session and the preferences of its owner
+	session, ok := util.Clients.Get(util.SessionKey(fake.School, username))
+	if !assert.True(t, ok) {
+		return
+	}
+	session.DataStorage = &util.DataStorageConfig{Enabled: true, Grades: true}
+	w = request("POST", "/accounts", token, nil, url.Values{"username": {username}, "password": {password}, "server": {fake.School}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	current, ok := util.Clients.Get(util.SessionKey(fake.School, username))
+	assert.True(t, ok)
+	assert.Same(t, session, current)
+	assert.True(t, current.DataStorage.Grades)
+}
+
+func TestChildren(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	router := gin.Default()
+	router.POST("/login", LoginHandler)
+	api := router.Group("/api")
+	api.Use(authMiddleware())
+	registerAPIRoutes(api)
+
+	request := func(path, token string, header http.Header) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	data := url.Values{"username": {fake.ParentUsername}, "password": {fake.ParentPassword}}
+	req, _ := http.NewRequest("POST", "/login", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+		return
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+
+	var children apimodel.ChildrenResponse
+	w = request("/api/children", login.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &children))
+	assert.True(t, children.Parent)
+	assert.Equal(t, edupagetest.StudentID, children.Active)
+	assert.Len(t, children.Children, 2)
+
+	w = request("/api/children?child="+edupagetest.SiblingID, login.Token, nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &children))
+	assert.Equal(t, edupagetest.SiblingID, children.Active)
+	assert.Equal(t, edupagetest.SiblingID, fake.ActiveChild())
+
+	assert.Equal(t, http.StatusOK, request("/api/timetable/recent", login.Token, http.Header{childHeader: {edupagetest.StudentID}}).Code)
+	assert.Equal(t, edupagetest.StudentID, fake.ActiveChild())
+	assert.Equal(t, http.StatusNotFound, request("/api/timetable/recent", login.Token, http.Header{childHeader: {"1002"}}).Code)
+
+	// Students have no children to select
+	token := getAuthToken(t)
+	w = request("/api/children", token, nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &children))
+	assert.False(t, children.Parent)
+	assert.Empty(t, children.Children)
+	assert.Equal(t, http.StatusBadRequest, request("/api/timetable/recent", token, http.Header{childHeader: {edupagetest.SiblingID}}).Code)
+}
+
+func TestThreads(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	db := useTestDatabase(t)
+	t.Cleanup(func() { util.ThreadReads = util.NewReadMarks() })
+
+	// An old message, only reachable by paging to the second window
+	timeline := fake.Timeline
+	t.Cleanup(func() { fake.Timeline = timeline })
+	old := time.Now().AddDate(0, 0, -45).Format("2006-01-02 15:04:05")
+	fake.Timeline = append(append([]map[string]interface{}{}, timeline...), map[string]interface{}{
+		"timelineid":    "100099",
+		"timestamp":     old,
+		"typ":           "sprava",
+		"user":          edupagetest.UserID,
+		"user_meno":     fake.Name(),
+		"text":          "Třídní schůzky",
+		"cas_pridania":  old,
+		"cas_udalosti":  old,
+		"data":          `{"messageContent": "Třídní schůzky"}`,
+		"vlastnik":      "Ucitel202",
+		"vlastnik_meno": "Petr Dvořák",
+		"removed":       "0",
+	})
+
+	_, do := newAPITestRouter(t)
+	request := func(method, path string) *httptest.ResponseRecorder {
+		return do(method, path, nil)
+	}
+
+	// The payloads are interfaces, the responses are decoded to the fields the test needs
+	type threadMessage struct {
+		ID      string          `json:"timelineid"`
+		Unread  bool            `json:"unread"`
+		Replies []threadMessage `json:"replies"`
+	}
+	type threadResponse struct {
+		ID           string        `json:"id"`
+		MessageCount int           `json:"message_count"`
+		UnreadCount  int           `json:"unread_count"`
+		ReadUntil    *time.Time    `json:"read_until"`
+		Participants []interface{} `json:"participants"`
+		Root         threadMessage `json:"root"`
+	}
+
+	// pageThreads walks all pages of one thread each
+	pageThreads := func() []threadResponse {
+		var pages []threadResponse
+		var threads struct {
+			Threads    []threadResponse `json:"threads"`
+			NextCursor string           `json:"next_cursor"`
+		}
+		path := "/api/threads?limit=1"
+		for range 20 {
+			w := request("GET", path)
+			if !assert.Equal(t, http.StatusOK, w.Code, w.Body.String()) {
+				return nil
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &threads))
+			assert.LessOrEqual(t, len(threads.Threads), 1)
+			pages = append(pages, threads.Threads...)
+			if threads.NextCursor == "" {
+				break
+			}
+			path = "/api/threads?limit=1&cursor=" + threads.NextCursor
+		}
+		assert.Empty(t, threads.NextCursor)
+		return pages
+	}
+	threadIDs := func(threads []threadResponse) []string {
+		ids := make([]string, 0, len(threads))
+		for _, thread := range threads {
+			ids = append(ids, thread.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"100005", "100001", "100099"}, threadIDs(pageThreads()))
+
+	var thread threadResponse
+	w := request("GET", "/api/threads/100001")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &thread))
+	assert.Equal(t, 3, thread.MessageCount)
+	// The reply of the student is their own
+	assert.Equal(t, 2, thread.UnreadCount)
+	assert.Len(t, thread.Participants, 2)
+	if assert.Len(t, thread.Root.Replies, 1) && assert.Len(t, thread.Root.Replies[0].Replies, 1) {
+		assert.False(t, thread.Root.Replies[0].Unread)
+		assert.True(t, thread.Root.Replies[0].Replies[0].Unread)
+	}
+
+	w = request("POST", "/api/threads/100001/read")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &thread))
+	assert.Equal(t, 0, thread.UnreadCount)
+	assert.NotNil(t, thread.ReadUntil)
+
+	// The read state survives a restart
+	util.ThreadReads = util.NewReadMarks()
+	var count int64
+	db.Model(&dbmodel.ThreadRead{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+	w = request("GET", "/api/threads/100001")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &thread))
+	assert.Equal(t, 0, thread.UnreadCount)
+
+	w = request("DELETE", "/api/threads/100001/read")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &thread))
+	assert.Equal(t, 2, thread.UnreadCount)
+	assert.Nil(t, thread.ReadUntil)
+
+	assert.Equal(t, http.StatusNotFound, request("GET", "/api/threads/999").Code)
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/api/threads?cursor=invalid").Code)
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/api/threads?limit=1000").Code)
+
+	var item threadMessage
+	w = request("GET", "/api/timelineitem/100001")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &item))
+	if assert.Len(t, item.Replies, 1) {
+		assert.Len(t, item.Replies[0].Replies, 1)
+	}
+
+	// A recent reply to the old message, the thread spans both windows and is returned once, together with its root
+	recent := time.Now().Add(-time.Hour).Format("2006-01-02 15:04:05")
+	fake.Timeline = append(fake.Timeline, map[string]interface{}{
+		"timelineid":    "100100",
+		"timestamp":     recent,
+		"typ":           "sprava",
+		"user":          "Ucitel202",
+		"user_meno":     "Petr Dvořák",
+		"text":          "Přijdu",
+		"cas_pridania":  recent,
+		"cas_udalosti":  recent,
+		"data":          `{"messageContent": "Přijdu"}`,
+		"vlastnik":      edupagetest.UserID,
+		"vlastnik_meno": fake.Name(),
+		"removed":       "0",
+		"reakcia_na":    "100099",
+	})
+	threads := pageThreads()
+	assert.Equal(t, []string{"100099", "100005", "100001"}, threadIDs(threads))
+	if assert.NotEmpty(t, threads) {
+		assert.Equal(t, 2, threads[0].MessageCount)
+		assert.Len(t, threads[0].Root.Replies, 1)
+	}
+}
+
+func TestReactions(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	// The grade has been removed in the meantime, edupage refuses to react to it
+	timeline := fake.Timeline
+	t.Cleanup(func() { fake.Timeline = timeline })
+	fake.Timeline = nil
+	for _, item := range timeline {
+		if item["timelineid"] == "100004" {
+			removed := make(map[string]interface{}, len(item))
+			for key, value := range item {
+				removed[key] = value
+			}
+			removed["removed"] = "1"
+			item = removed
+		}
+		fake.Timeline = append(fake.Timeline, item)
+	}
+
+	_, do := newAPITestRouter(t)
+	request := func(path string, form url.Values) *httptest.ResponseRecorder {
+		return do("POST", path, strings.NewReader(form.Encode()))
+	}
+
+	var reply apimodel.ReplyResponse
+	w := request("/api/timelineitem/100001/reply", url.Values{"text": {"Děkuji"}})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reply))
+	assert.True(t, reply.Success)
+	assert.NotEmpty(t, reply.TimelineID)
+	messages := fake.Messages()
+	assert.Equal(t, "100001", messages[len(messages)-1].Get("reakcia_na"))
+
+	assert.Equal(t, http.StatusBadRequest, request("/api/timelineitem/100001/reply", nil).Code)
+	assert.Equal(t, http.StatusNotFound, request("/api/timelineitem/999/reply", url.Values{"text": {"?"}}).Code)
+
+	assert.Equal(t, http.StatusBadRequest, request("/api/timelineitem/100001/receipt", nil).Code)
+	assert.Equal(t, http.StatusOK, request("/api/timelineitem/100005/receipt", nil).Code)
+	assert.Equal(t, http.StatusOK, request("/api/timelineitem/100003/like", nil).Code)
+
+	var refused apimodel.ReactionErrorResponse
+	w = request("/api/timelineitem/100004/like", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &refused))
+	assert.Contains(t, refused.Error, "item removed")
+
+	assert.Equal(t, http.StatusBadRequest, request("/api/timelineitem/100001/vote", url.Values{"answer": {"a1"}}).Code)
+	assert.Equal(t, http.StatusBadRequest, request("/api/timelineitem/100005/vote", url.Values{"answer": {"a1", "a2"}}).Code)
+	assert.Equal(t, http.StatusOK, request("/api/timelineitem/100005/vote", url.Values{"answer": {"a1"}}).Code)
+
+	confirmations := fake.Confirmations()
+	if assert.NotEmpty(t, confirmations) {
+		assert.Equal(t, `["a1"]`, confirmations[len(confirmations)-1].Get("answers"))
+	}
+}
+
+func TestSendMessageAttachments(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	limits := config.AppConfig.Attachments
+	t.Cleanup(func() { config.AppConfig.Attachments = limits })
+
+	router, _ := newAPITestRouter(t)
+	token := getAuthToken(t)
+	pdf := []byte("%PDF-1.4\n%fake document\n")
+	send := func(files map[string][]byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		_ = writer.WriteField("recipient", "Ucitel201")
+		_ = writer.WriteField("message", `{"text": "Posílám úkol"}`)
+		for name, content := range files {
+			part, _ := writer.CreateFormFile("attachments", name)
+			_, _ = part.Write(content)
+		}
+		_ = writer.Close()
+
+		req, _ := http.NewRequest("POST", "/api/message", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(map[string][]byte{"úkol.pdf": pdf})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	messages := fake.Messages()
+	var attachments map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(messages[len(messages)-1].Get("attachements")), &attachments))
+	for path, name := range attachments {
+		assert.Equal(t, "úkol.pdf", name)
+		uploaded, ok := fake.Upload(path)
+		assert.True(t, ok)
+		assert.Equal(t, pdf, uploaded)
+	}
+	assert.Len(t, attachments, 1)
+
+	assert.Equal(t, http.StatusOK, send(nil).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, send(map[string][]byte{"program.exe": []byte("MZ\x90\x00\x03\x00\x00\x00")}).Code)
+
+	config.AppConfig.Attachments.MaxCount = 1
+	assert.Equal(t, http.StatusBadRequest, send(map[string][]byte{"a.pdf": pdf, "b.pdf": pdf}).Code)
+
+	config.AppConfig.Attachments.MaxSize = 16
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(map[string][]byte{"úkol.pdf": pdf}).Code)
+	// The whole request is limited too, not only the single files
+	assert.Equal(t, http.StatusRequestEntityTooLarge, send(map[string][]byte{"úkol.pdf": bytes.Repeat(pdf, 1<<16)}).Code)
+}
+
+func TestAttachmentProxy(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	cache := config.AppConfig.Attachments.Cache
+	files := fake.Files
+	t.Cleanup(func() {
+		config.AppConfig.Attachments.Cache = cache
+		fake.Files = files
+		util.AttachmentCache = nil
+	})
+
+	router, _ := newAPITestRouter(t)
+	token := getAuthToken(t)
+	link := "/elearning/?cmd=EtestCreator&akcia=download&id=1"
+	content := files[link]
+	download := func(link string, header http.Header) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/attachment?url="+url.QueryEscape(link), nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := download(link, nil)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, content, w.Body.Bytes())
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = download(link, http.Header{"Range": {"bytes=0-7"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "%PDF-1.4", w.Body.String())
+	assert.Equal(t, fmt.Sprintf("bytes 0-7/%d", len(content)), w.Header().Get("Content-Range"))
+
+	assert.Equal(t, http.StatusNotModified, download(link, http.Header{"If-None-Match": {etag}}).Code)
+	assert.Equal(t, http.StatusNotFound, download("/cloud/missing/file.pdf", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, download("https://example.com/file.pdf", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, download("", nil).Code)
+
+	// Larger files are streamed, edupage handles the range itself
+	config.AppConfig.Attachments.Cache.MaxSize = 16
+	w = download(link, http.Header{"Range": {"bytes=9-"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, content[9:], w.Body.Bytes())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	config.AppConfig.Attachments.Cache.MaxSize = 0
+
+	store, err := util.NewDiskAttachmentStore(t.TempDir(), time.Hour)
+	assert.NoError(t, err)
+	util.AttachmentCache = store
+	assert.Equal(t, http.StatusOK, download(link, nil).Code)
+
+	// The cached file is served even after it has been removed from edupage
+	fake.Files = map[string][]byte{}
+	w = download(link, http.Header{"Range": {"bytes=0-7"}})
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "%PDF-1.4", w.Body.String())
+	assert.Equal(t, http.StatusNotModified, download(link, http.Header{"If-None-Match": {etag}}).Code)
+}
+
+func TestHomework(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	homeworks := fake.Homeworks
+	t.Cleanup(func() { fake.Homeworks = homeworks })
+
+	_, do := newAPITestRouter(t)
+	request := func(method, path string) *httptest.ResponseRecorder {
+		return do(method, path, nil)
+	}
+	list := func(query string) apimodel.HomeworkResponse {
+		w := request("GET", "/api/homework?"+query)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response apimodel.HomeworkResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	response := list("")
+	assert.Len(t, response.Homework, 1)
+	assert.Equal(t, 1, response.Counts["pending"])
+	homework := response.Homework[0]
+	assert.Equal(t, "hwk5001", homework.ID)
+	assert.Equal(t, "100003", homework.TimelineID)
+	assert.Equal(t, "pending", homework.Status)
+	if assert.NotNil(t, homework.Subject) {
+		assert.Equal(t, "303", homework.Subject.ID)
+	}
+	if assert.NotNil(t, homework.Due) {
+		// The local time of the school is the instant in the time zone of the school
+		location, err := util.SchoolLocation()
+		assert.NoError(t, err)
+		assert.Equal(t, homeworks[0]["datetimeto"], homework.Due.In(location).Format("2006-01-02 15:04:05"))
+	}
+
+	due := *homework.Due
+	assert.Len(t, list("subject=303").Homework, 1)
+	assert.Empty(t, list("subject=301").Homework)
+	assert.Len(t, list("due_before="+url.QueryEscape(due.Add(time.Minute).Format(time.RFC3339))).Homework, 1)
+	assert.Empty(t, list("due_after="+url.QueryEscape(due.Add(time.Minute).Format(time.RFC3339))).Homework)
+	assert.Empty(t, list("status=done,overdue").Homework)
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/api/homework?status=finished").Code)
+
+	assert.Equal(t, http.StatusNotFound, request("POST", "/api/homework/hwk9999/done").Code)
+	w := request("POST", "/api/homework/hwk5001/done")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	response = list("status=done")
+	assert.Len(t, response.Homework, 1)
+	assert.True(t, response.Homework[0].Done)
+	assert.Equal(t, 1, response.Homework[0].DoneCount)
+	assert.Equal(t, 0, response.Counts["pending"])
+}
+
+func TestGradesSummary(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	_, do := newAPITestRouter(t)
+	request := func(query string) *httptest.ResponseRecorder {
+		return do("GET", "/api/grades/summary?"+query, nil)
+	}
+
+	w := request("target=2")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response apimodel.GradesSummaryResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	assert.Equal(t, 2.0, response.Average)
+	assert.Equal(t, 2, response.Count)
+	if assert.Len(t, response.Subjects, 2) {
+		math, czech := response.Subjects[0], response.Subjects[1]
+		assert.Equal(t, "301", math.SubjectID)
+		assert.Equal(t, 1.0, math.Average)
+		assert.Len(t, math.Grades, 1)
+		assert.NotNil(t, math.Subject)
+
+		assert.Equal(t, 3.0, czech.Average)
+		if assert.NotNil(t, czech.Needed) {
+			assert.Equal(t, 1.0, czech.Needed.Mark)
+			assert.True(t, czech.Needed.Reachable)
+		}
+	}
+
+	assert.NoError(t, json.Unmarshal(request("target=1.5").Body.Bytes(), &response))
+	assert.False(t, response.Subjects[1].Needed.Reachable)
+
+	assert.Equal(t, http.StatusBadRequest, request("target=6").Code)
+	assert.Equal(t, http.StatusBadRequest, request("target=2&weight=0").Code)
+}
+
+func TestGradeChanges(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	useTestDatabase(t)
+
+	_, do := newAPITestRouter(t)
+	request := func(query string) *httptest.ResponseRecorder {
+		return do("GET", "/api/grades/changes?"+query, nil)
+	}
+
+	// The history is only kept for the users who have opted in
+	assert.Equal(t, http.StatusForbidden, request("").Code)
+
+	session, ok := util.Clients.Get(util.SessionKey("login1", username))
+	if !assert.True(t, ok) {
+		return
+	}
+	storage := session.DataStorage
+	t.Cleanup(func() { session.DataStorage = storage })
+	session.DataStorage = &util.DataStorageConfig{Enabled: true, Grades: true}
+
+	// The first request only stores the baseline
+	w := request("")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response apimodel.GradeChangesResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Empty(t, response.Changes)
+	checked := response.CheckedAt
+
+	// One grade is changed, one removed and one added
+	results := fake.Results
+	t.Cleanup(func() { fake.Results = results })
+	changed := maps.Clone(results)
+	events := maps.Clone(results["vsetkyUdalosti"].(map[string]interface{})["edupage"].(map[string]interface{}))
+	added := maps.Clone(events["60001"].(map[string]interface{}))
+	added["udalostID"] = "60003"
+	events["60003"] = added
+	changed["vsetkyUdalosti"] = map[string]interface{}{"edupage": events}
+
+	var graded []interface{}
+	for _, grade := range results["vsetkyZnamky"].([]interface{}) {
+		grade := maps.Clone(grade.(map[string]interface{}))
+		switch grade["udalostid"] {
+		case "60001":
+			grade["data"] = "2"
+		case "60002":
+			continue
+		}
+		graded = append(graded, grade)
+	}
+	newGrade := maps.Clone(graded[0].(map[string]interface{}))
+	newGrade["znamkaid"], newGrade["udalostid"], newGrade["data"] = "70003", "60003", "4"
+	changed["vsetkyZnamky"] = append(graded, newGrade)
+	fake.Results = changed
+
+	w = request("since=" + checked.Format(time.RFC3339Nano))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.Len(t, response.Changes, 3) {
+		modified, removed, addition := response.Changes[0], response.Changes[1], response.Changes[2]
+		assert.Equal(t, "modified", modified.Kind)
+		assert.Equal(t, "60001", modified.EventID)
+		assert.Equal(t, "1", modified.Before.Data)
+		assert.Equal(t, "2", modified.After.Data)
+
+		assert.Equal(t, "removed", removed.Kind)
+		assert.Equal(t, "302", removed.SubjectID)
+		assert.Nil(t, removed.After)
+
+		assert.Equal(t, "added", addition.Kind)
+		assert.Equal(t, "60003", addition.EventID)
+		assert.Nil(t, addition.Before)
+	}
+
+	// The changes are only detected once
+	w = request("since=" + response.CheckedAt.Format(time.RFC3339Nano))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Empty(t, response.Changes)
+
+	assert.Equal(t, http.StatusBadRequest, request("since=yesterday").Code)
+}
+
+func TestNotes(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	// A reprimand without a subject next to the praise of the fixtures
+	results := fake.Results
+	t.Cleanup(func() { fake.Results = results })
+	changed := maps.Clone(results)
+	changed["vsetkyVcelicky"] = append(append([]interface{}{}, results["vsetkyVcelicky"].([]interface{})...), map[string]interface{}{
+		"VcelickaID": "80002",
+		"p_datum":    time.Now().AddDate(0, 0, -5).Format("2006-01-02"),
+		"p_text":     "Zapomenuté pomůcky",
+		"p_typ":      "poznamka",
+		"PredmetID":  "",
+	})
+	fake.Results = changed
+
+	_, do := newAPITestRouter(t)
+	request := func(query string) *httptest.ResponseRecorder {
+		return do("GET", "/api/notes?"+query, nil)
+	}
+
+	w := request("")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response apimodel.NotesResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	if assert.Len(t, response.Notes, 2) {
+		reprimand, praise := response.Notes[0], response.Notes[1]
+		assert.Equal(t, "reprimand", reprimand.Kind)
+		assert.Nil(t, reprimand.Subject)
+		assert.Equal(t, "praise", praise.Kind)
+		if assert.NotNil(t, praise.Subject) {
+			assert.Equal(t, "301", praise.Subject.ID)
+		}
+		assert.NotNil(t, praise.Date)
+	}
+	total := 0
+	for _, count := range response.Counts {
+		total += count.Total
+		assert.Equal(t, count.Total, count.Praise+count.Reprimand+count.Other)
+	}
+	assert.Equal(t, 2, total)
+
+	assert.NoError(t, json.Unmarshal(request("type=praise").Body.Bytes(), &response))
+	if assert.Len(t, response.Notes, 1) {
+		assert.Equal(t, "80001", response.Notes[0].ID)
+	}
+
+	after := time.Now().AddDate(0, 0, -10).Format(time.RFC3339)
+	assert.NoError(t, json.Unmarshal(request("after="+url.QueryEscape(after)).Body.Bytes(), &response))
+	if assert.Len(t, response.Notes, 1) {
+		assert.Equal(t, "80002", response.Notes[0].ID)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request("type=detention").Code)
+	assert.Equal(t, http.StatusBadRequest, request("before=tomorrow").Code)
+}
+
+func TestAttendance(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	_, do := newAPITestRouter(t)
+	request := func(path string) *httptest.ResponseRecorder {
+		return do("GET", path, nil)
+	}
+
+	// The school year of the absences of the fixtures
+	date, _ := time.Parse("2006-01-02", fake.Absences[0]["date"].(string))
+	year, half := model.SchoolHalf(date)
+
+	w := request("/api/attendance?year=" + year)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response apimodel.AttendanceResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	if assert.Len(t, response.Absences, 3) {
+		excused := response.Absences[0]
+		assert.Equal(t, "excused", excused.Status)
+		if assert.NotNil(t, excused.Subject) && assert.NotNil(t, excused.Period) && assert.NotNil(t, excused.Type) {
+			assert.Equal(t, "301", excused.Subject.ID)
+			assert.Equal(t, "08:00", excused.Period.StartTime)
+			assert.Equal(t, "Omluvená", excused.Type.Name)
+		}
+		assert.Equal(t, 10, response.Absences[2].LateMinutes)
+	}
+
+	var totals *apimodel.AttendanceTotals
+	for i := range response.Halves {
+		if response.Halves[i].Half == half {
+			totals = &response.Halves[i]
+		}
+	}
+	if assert.NotNil(t, totals) {
+		assert.Equal(t, 2, totals.Absent)
+		assert.Equal(t, 1, totals.Excused)
+		assert.Equal(t, 1, totals.Unexcused)
+		assert.Equal(t, 1, totals.Late)
+		assert.Greater(t, totals.Lessons, 0)
+		for _, subject := range totals.Subjects {
+			if subject.Subject.ID == "301" {
+				assert.Equal(t, 1, subject.Absent)
+				assert.InDelta(t, 100/float64(subject.Lessons), subject.Percent, 0.01)
+			}
+		}
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request("/api/attendance?year=last").Code)
+}
+
+func TestTimetableChanges(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	_, do := newAPITestRouter(t)
+	request := func(query string) *httptest.ResponseRecorder {
+		return do("GET", "/api/timetable/changes?"+query, nil)
+	}
+
+	to := time.Now().AddDate(0, 0, 14).Format(time.RFC3339)
+	w := request("to=" + url.QueryEscape(to))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response apimodel.TimetableChangesResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+	if assert.Len(t, response.Changes, 4) {
+		substituted, moved, cancelled, added := response.Changes[0], response.Changes[1], response.Changes[2], response.Changes[3]
+		assert.Equal(t, []string{"substituted"}, substituted.Kinds)
+		if assert.Len(t, substituted.Teachers, 1) && assert.NotNil(t, substituted.Original) {
+			assert.Equal(t, "Dvořák", substituted.Teachers[0].Lastname)
+			assert.Equal(t, "Svobodová", substituted.Original.Teachers[0].Lastname)
+		}
+		assert.Equal(t, "Suplování", substituted.Type.Name)
+
+		assert.Equal(t, []string{"moved"}, moved.Kinds)
+		if assert.Len(t, moved.Classrooms, 1) {
+			assert.Equal(t, "401", moved.Classrooms[0].ID)
+		}
+		assert.Equal(t, "303", moved.Subject.ID)
+
+		assert.Equal(t, []string{"cancelled"}, cancelled.Kinds)
+		assert.Equal(t, []string{"added"}, added.Kinds)
+		assert.Nil(t, added.Original)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request("from=today").Code)
+}
+
+func TestSchoolTimetable(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	_, do := newAPITestRouter(t)
+	request := func(path string) *httptest.ResponseRecorder {
+		return do("GET", path, nil)
+	}
+
+	w := request("/api/timetable/teacher/202")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var timetable apimodel.CompleteTimetable
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &timetable))
+	assert.NotEmpty(t, timetable.Days)
+	for _, items := range timetable.Days {
+		for _, item := range items {
+			assert.Equal(t, "Fyzika", item.Subject.Name)
+			if assert.Len(t, item.Teachers, 1) {
+				assert.Equal(t, "Dvořák", item.Teachers[0].Lastname)
+			}
+		}
+	}
+
+	w = request("/api/timetable/class/" + edupagetest.ClassID)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = request("/api/timetable/classroom/401")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, request("/api/timetable/classroom/999").Code)
+	assert.Equal(t, http.StatusBadRequest, request("/api/timetable/class/"+edupagetest.ClassID+"?from=today").Code)
+}
+
+func TestFreeFinder(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	_, do := newAPITestRouter(t)
+	request := func(path string) *httptest.ResponseRecorder {
+		return do("GET", path, nil)
+	}
+
+	now := time.Now()
+	monday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 7-int(now.Weekday()+6)%7)
+	date := url.QueryEscape(monday.Format(time.RFC3339))
+
+	w := request("/api/free/classrooms?period=1&date=" + date)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var classrooms apimodel.FreeClassroomsResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &classrooms))
+	assert.Equal(t, monday.Format("2006-01-02"), classrooms.Date)
+	if assert.Len(t, classrooms.Periods, 1) && assert.Len(t, classrooms.Periods[0].Classrooms, 1) {
+		assert.Equal(t, "Laboratoř", classrooms.Periods[0].Classrooms[0].Name)
+	}
+
+	w = request("/api/free/teachers?date=" + date)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var teachers apimodel.FreeTeachersResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &teachers))
+	if assert.Len(t, teachers.Periods, 6) {
+		assert.Len(t, teachers.Periods[0].Teachers, 1)
+		assert.Len(t, teachers.Periods[5].Teachers, 2)
+	}
+
+	// The occupancy of the week is kept in memory without Redis too
+	fetched := fake.Requests("/timetable/server/currenttt.js")
+	assert.Equal(t, http.StatusOK, request("/api/free/classrooms?date="+date).Code)
+	assert.Equal(t, fetched, fake.Requests("/timetable/server/currenttt.js"))
+
+	to := url.QueryEscape(monday.AddDate(0, 0, 6).Format(time.RFC3339))
+	w = request("/api/free/teachers/202?from=" + date + "&to=" + to)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var free apimodel.TeacherFreeTimeResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &free))
+	assert.Equal(t, "Dvořák", free.Teacher.Lastname)
+	if assert.Len(t, free.Days, 5) {
+		assert.Len(t, free.Days[0].Periods, 5)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request("/api/free/classrooms?period=99").Code)
+	assert.Equal(t, http.StatusNotFound, request("/api/free/teachers/999").Code)
+	far := url.QueryEscape(monday.AddDate(0, 2, 0).Format(time.RFC3339))
+	assert.Equal(t, http.StatusBadRequest, request("/api/free/teachers/202?from="+date+"&to="+far).Code)
+}
+
+func TestSchoolCache(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	schools := util.Schools
+	util.Schools = util.NewSchoolCache()
+	t.Cleanup(func() { util.Schools = schools })
+
+	gin.SetMode(gin.TestMode)
+	_, do := newAPITestRouter(t)
+	request := func(path string) *httptest.ResponseRecorder {
+		return do("GET", path, nil)
+	}
+
+	w := request("/api/teacher/201")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "Svobodová")
+	assert.Equal(t, http.StatusNotFound, request("/api/teacher/203").Code)
+	assert.Equal(t, http.StatusNotFound, request("/api/subject/999").Code)
+
+	// The DBI stored by another user of the school is shared
+	session, ok := util.Clients.Get(util.SessionKey("login1", username))
+	if !assert.True(t, ok) {
+		return
+	}
+	user, err := session.Client.GetUser(false)
+	assert.NoError(t, err)
+	shared := util.NewSchoolDBI(&user.DBI)
+	shared.Teachers = maps.Clone(shared.Teachers)
+	shared.Teachers["203"] = model.Teacher{ID: "203", Firstname: "Jana", Lastname: "Nová"}
+	assert.NoError(t, util.Schools.Store(session.Client, shared))
+
+	w = request("/api/teacher/203")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, request("/api/recipients").Body.String(), "Jana Nová")
+
+	// A fresh DBI which differs from the cached one replaces it
+	assert.NoError(t, util.Schools.Refresh(session.Client))
+	assert.Equal(t, http.StatusNotFound, request("/api/teacher/203").Code)
+	assert.Equal(t, http.StatusOK, request("/api/periods").Code)
+}
+
+func TestCachedResponses(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	_, do := newAPITestRouter(t)
+	request := func(path string) *httptest.ResponseRecorder {
+		return do("GET", path, nil)
+	}
+	// concurrently sends the requests at the same time
+	concurrently := func(path string, n int) []*httptest.ResponseRecorder {
+		var wg sync.WaitGroup
+		responses := make([]*httptest.ResponseRecorder, n)
+		for i := range responses {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				responses[i] = request(path)
+			}()
+		}
+		wg.Wait()
+		return responses
+	}
+
+	// Without a cache store, the data is always retrieved from edupage
+	for _, path := range []string{"/api/timeline/recent", "/api/timetable/recent", "/api/grades"} {
+		w := request(path)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Equal(t, "0", w.Header().Get("Age"))
+	}
+
+	// Concurrent requests for the same data share the retrieval
+	fake.Latency = 100 * time.Millisecond
+	t.Cleanup(func() { fake.Latency = 0 })
+	fetched := fake.Requests("/znamky/")
+	responses := concurrently("/api/grades", 4)
+	for _, w := range responses {
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Equal(t, responses[0].Body.String(), w.Body.String())
+	}
+	assert.Equal(t, fetched+1, fake.Requests("/znamky/"))
+	fake.Latency = 0
+
+	store, staleAfter := util.UserCacheStore, config.AppConfig.Redis.StaleAfter
+	util.UserCacheStore = util.NewMemoryCacheStore()
+	config.AppConfig.Redis.StaleAfter = 1
+	t.Cleanup(func() { util.UserCacheStore, config.AppConfig.Redis.StaleAfter = store, staleAfter })
+
+	fetched = fake.Requests("/znamky/")
+	w := request("/api/grades")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, fetched+1, fake.Requests("/znamky/"))
+
+	w = request("/api/grades")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "0", w.Header().Get("Age"))
+	assert.Equal(t, fetched+1, fake.Requests("/znamky/"), "fresh data isn't retrieved again")
+
+	// Stale data is returned at once and refreshed in the background, only once for concurrent requests
+	time.Sleep(1100 * time.Millisecond)
+	fake.Latency = 100 * time.Millisecond
+	for _, w := range concurrently("/api/grades", 4) {
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+		assert.Equal(t, "1", w.Header().Get("Age"))
+	}
+	assert.Eventually(t, func() bool {
+		return request("/api/grades").Header().Get("X-Cache") == "HIT"
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Equal(t, fetched+2, fake.Requests("/znamky/"))
+}
+
+func TestCalendarFeed(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, database := range []bool{false, true} {
+		t.Run(fmt.Sprintf("database=%v", database), func(t *testing.T) {
+			if database {
+				useTestDatabase(t)
+			}
+
+			router, do := newAPITestRouter(t)
+			router.GET("/calendar/:token", routes.CalendarFeedHandler)
+			request := func(method, path string) *httptest.ResponseRecorder {
+				return do(method, path, nil)
+			}
+
+			w := request("POST", "/api/calendar/token")
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var created apimodel.CalendarTokenResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+			assert.NotEmpty(t, created.Token)
+			assert.True(t, strings.HasSuffix(created.URL, "/calendar/"+created.Token+".ics"), created.URL)
+
+			feedPath := "/calendar/" + created.Token + ".ics"
+			req, _ := http.NewRequest("GET", feedPath, nil)
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.True(t, strings.HasPrefix(w.Body.String(), "BEGIN:VCALENDAR\r\n"))
+			assert.Contains(t, w.Body.String(), "SUMMARY:Matematika\r\n")
+
+			// A new token replaces the previous one
+			w = request("POST", "/api/calendar/token")
+			assert.Equal(t, http.StatusOK, w.Code)
+			var renewed apimodel.CalendarTokenResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &renewed))
+			req, _ = http.NewRequest("GET", feedPath, nil)
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+
+			w = request("DELETE", "/api/calendar/token")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `{"revoked":true}`, w.Body.String())
+
+			req, _ = http.NewRequest("GET", "/calendar/"+renewed.Token+".ics", nil)
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		})
+	}
+}
+
+func TestQRLogin(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	router := gin.Default()
+	router.GET("/validate-token", ValidateTokenHandler)
+	router.GET("/qrlogin", QRLoginHandler)
+	router.POST("/qrlogin/:code", ApproveQRLoginHandler)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/qrlogin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+
+	// readEvent returns the next event of the stream, skipping the keep-alive pings
+	readEvent := func() (string, string) {
+		var event, data string
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				event = strings.TrimPrefix(line, "event:")
+			case strings.HasPrefix(line, "data:"):
+				data = strings.TrimPrefix(line, "data:")
+			case line == "" && event != "" && event != "ping":
+				return event, data
+			}
+		}
+	}
+
+	event, data := readEvent()
+	assert.Equal(t, "code", event)
+	var code struct {
+		Code    string `json:"code"`
+		Expires int64  `json:"expires"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(data), &code))
+	assert.Len(t, code.Code, 16)
+	assert.Greater(t, code.Expires, time.Now().Unix())
+
+	approve := func(token string) int {
+		req, _ := http.NewRequest("POST", srv.URL+"/qrlogin/"+code.Code, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, approve("invalid"))
+	token := getAuthToken(t)
+	assert.Equal(t, http.StatusOK, approve(token))
+	assert.Equal(t, http.StatusNotFound, approve(token), "the code can only be approved once")
+
+	event, data = readEvent()
+	assert.Equal(t, "token", event)
+	var result qrLoginResult
+	assert.NoError(t, json.Unmarshal([]byte(data), &result))
+	assert.Equal(t, fake.Name(), result.Name)
+	assert.NotEqual(t, token, result.Token)
+
+	req, _ := http.NewRequest("GET", srv.URL+"/validate-token", nil)
+	req.Header.Set("Authorization", "Bearer "+result.Token)
+	validate, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validate.Body.Close()
+	assert.Equal(t, http.StatusOK, validate.StatusCode, "the new device should be logged in")
+}
+
+func TestJWKS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	algorithm, dir, secret := config.AppConfig.JWT.Algorithm, config.AppConfig.JWT.KeysDir, config.AppConfig.JWT.Secret
+	legacy := config.AppConfig.JWT.AcceptLegacyUntil
+	keys, until := signingKeys, legacyUntil
+	t.Cleanup(func() {
+		config.AppConfig.JWT.Algorithm, config.AppConfig.JWT.KeysDir, config.AppConfig.JWT.Secret = algorithm, dir, secret
+		config.AppConfig.JWT.AcceptLegacyUntil = legacy
+		signingKeys, legacyUntil = keys, until
+	})
+
+	router := gin.Default()
+	router.GET("/.well-known/jwks.json", JWKSHandler)
+
+	fetchJWKS := func() jwtkeys.JWKS {
+		req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var set jwtkeys.JWKS
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+		return set
+	}
+
+	// publicKey decodes the JWK the way another service would
+	publicKey := func(jwk jwtkeys.JWK) interface{} {
+		switch jwk.KeyType {
+		case "RSA":
+			n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+			return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "OKP":
+			x, _ := base64.RawURLEncoding.DecodeString(jwk.X)
+			return ed25519.PublicKey(x)
+		}
+		return nil
+	}
+
+	verifyWithJWKS := func(token string, set jwtkeys.JWKS) error {
+		_, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+			for _, jwk := range set.Keys {
+				if jwk.ID == token.Header["kid"] {
+					return publicKey(jwk), nil
+				}
+			}
+			return nil, errors.New("key not found")
+		})
+		return err
+	}
+
+	for _, alg := range []string{jwtkeys.AlgorithmEdDSA, jwtkeys.AlgorithmRS256} {
+		t.Run(alg, func(t *testing.T) {
+			config.AppConfig.JWT.Algorithm = alg
+			config.AppConfig.JWT.KeysDir = t.TempDir()
+			config.AppConfig.JWT.Secret = ""
+			assert.NoError(t, initSigningKeys())
+
+			first, _, err := generateJWT("school", "user", "")
+			assert.NoError(t, err)
+			set := fetchJWKS()
+			assert.Len(t, set.Keys, 1)
+			assert.Equal(t, alg, set.Keys[0].Algorithm)
+			assert.NoError(t, verifyWithJWKS(first, set))
+
+			assert.NoError(t, signingKeys.Rotate())
+			second, _, err := generateJWT("school", "user", "")
+			assert.NoError(t, err)
+			set = fetchJWKS()
+			assert.Len(t, set.Keys, 2)
+			assert.NoError(t, verifyWithJWKS(first, set))
+			assert.NoError(t, verifyWithJWKS(second, set))
+
+			// The keys survive a restart
+			assert.NoError(t, initSigningKeys())
+			_, err = parseAccessToken(first)
+			assert.NoError(t, err)
+			_, err = parseAccessToken(second)
+			assert.NoError(t, err)
+			assert.Len(t, fetchJWKS().Keys, 2)
+
+			// HS256 tokens are rejected, even when the secret is still configured
+			config.AppConfig.JWT.Secret = "legacy"
+			hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+				"server":   "school",
+				"username": "user",
+				"exp":      time.Now().Add(time.Minute).Unix(),
+			}).SignedString(getSecretKey())
+			assert.NoError(t, err)
+			_, err = parseAccessToken(hs256)
+			assert.Error(t, err)
+
+			// Until jwt.accept_legacy_until, which is limited to the lifetime of the legacy tokens
+			config.AppConfig.JWT.AcceptLegacyUntil = time.Now().Add(time.Hour).Format(time.RFC3339)
+			assert.NoError(t, initSigningKeys())
+			_, err = parseAccessToken(hs256)
+			assert.NoError(t, err)
+
+			config.AppConfig.JWT.AcceptLegacyUntil = time.Now().Add(30 * 24 * time.Hour).Format(time.RFC3339)
+			assert.NoError(t, initSigningKeys())
+			assert.WithinDuration(t, time.Now().Add(legacyTokenLifetime), legacyUntil, time.Minute)
+
+			config.AppConfig.JWT.AcceptLegacyUntil = time.Now().Add(-time.Minute).Format(time.RFC3339)
+			assert.NoError(t, initSigningKeys())
+			_, err = parseAccessToken(hs256)
+			assert.Error(t, err)
+
+			config.AppConfig.JWT.AcceptLegacyUntil = ""
+			config.AppConfig.JWT.Secret = ""
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/jwtkeys"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/DislikesSchool/EduPage2-server/config"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+const algorithmHS256 = "HS256"
+
+// legacyTokenLifetime is the lifetime of the HS256 tokens issued before the signing keys were introduced,
+// the legacy tokens are accepted at most this long after the switch.
+const legacyTokenLifetime = 6 * time.Hour
+
+// signingKeys signs the tokens, nil when the tokens are signed with the HS256 secret.
+var signingKeys *jwtkeys.KeySet
+
+// legacyUntil is the time until which HS256 tokens are still accepted with EdDSA or RS256 signing, zero rejects them.
+var legacyUntil time.Time
+
+func signingAlgorithm() string {
+	if algorithm := config.AppConfig.JWT.Algorithm; algorithm != "" {
+		return algorithm
+	}
+	return jwtkeys.AlgorithmEdDSA
+}
+
+// initSigningKeys loads or creates the signing keys of the configured algorithm.
+func initSigningKeys() error {
+	algorithm := signingAlgorithm()
+	if algorithm == algorithmHS256 {
+		signingKeys = nil
+		legacyUntil = time.Time{}
+		return nil
+	}
+
+	until, err := acceptLegacyUntil()
+	if err != nil {
+		return err
+	}
+
+	keys, err := jwtkeys.New(jwtkeys.Options{
+		Algorithm: algorithm,
+		Dir:       config.AppConfig.JWT.KeysDir,
+		Rotation:  time.Duration(config.AppConfig.JWT.RotationInterval) * time.Second,
+		Retention: accessTokenTTL(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	signingKeys = keys
+	legacyUntil = until
+	return nil
+}
+
+// acceptLegacyUntil parses jwt.accept_legacy_until, it is limited to legacyTokenLifetime from now.
+func acceptLegacyUntil() (time.Time, error) {
+	value := config.AppConfig.JWT.AcceptLegacyUntil
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid jwt.accept_legacy_until: %w", err)
+	}
+	if limit := time.Now().Add(legacyTokenLifetime); until.After(limit) {
+		// The loggers aren't initialized yet at startup
+		fmt.Printf("\033[0;33mWARNING\033[0m: jwt.accept_legacy_until is more than %v away, HS256 tokens are accepted until %s\n", legacyTokenLifetime, limit.Format(time.RFC3339))
+		until = limit
+	}
+	return until, nil
+}
+
+// rotateSigningKeys creates a new signing key when the rotation interval has passed.
+func rotateSigningKeys() {
+	if signingKeys == nil {
+		return
+	}
+
+	rotated, err := signingKeys.RotateIfDue()
+	if err != nil {
+		util.ErrorLogger.Printf("Failed to rotate signing keys: %v", err)
+		return
+	}
+	if rotated {
+		util.InfoLogger.Printf("Rotated signing keys, new key %s", signingKeys.SigningKey().ID)
+	}
+}
+
+// signToken signs the claims with the current signing key.
+func signToken(claims jwt.MapClaims) (string, error) {
+	if signingKeys == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(getSecretKey())
+	}
+	return signingKeys.Sign(claims)
+}
+
+// verificationKey returns the key to verify the token with.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		// HS256 tokens are accepted until jwt.accept_legacy_until, to not log out users right after switching algorithms
+		if signingKeys == nil || (config.AppConfig.JWT.Secret != "" && time.Now().Before(legacyUntil)) {
+			return getSecretKey(), nil
+		}
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	if signingKeys == nil {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return signingKeys.Keyfunc(token)
+}
+
+// JWKSHandler godoc
+// @Summary Get the token signing keys
+// @Schemes
+// @Description Returns the public keys used to sign the tokens as a JSON Web Key Set (RFC 7517).
+// @Description The key set is empty when the tokens are signed using HS256.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} jwtkeys.JWKS
+// @Router /.well-known/jwks.json [get]
+func JWKSHandler(c *gin.Context) {
+	set := jwtkeys.JWKS{Keys: []jwtkeys.JWK{}}
+	if signingKeys != nil {
+		set = signingKeys.JWKS()
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/dbmodel"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/util"
+	"github.com/DislikesSchool/EduPage2-server/config"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	// defaultSessionTokenTTL is the lifetime of access tokens without refresh tokens, they can't be renewed
+	defaultSessionTokenTTL = 6 * time.Hour
+)
+
+var (
+	errRefreshTokensDisabled = errors.New("refresh tokens require the database to be enabled")
+	errRefreshTokenInvalid   = errors.New("invalid refresh token")
+	errRefreshTokenExpired   = errors.New("refresh token expired")
+	errRefreshTokenRevoked   = errors.New("refresh token revoked")
+	errRefreshTokenReused    = errors.New("refresh token reuse detected, all tokens of this login were revoked")
+	errClientNotFound        = errors.New("client not found")
+	errTokenRevoked          = errors.New("token has been revoked")
+)
+
+// accessTokenTTL returns the configured lifetime of access tokens. By default, the tokens are short-lived
+// only when they are issued together with a refresh token.
+func accessTokenTTL() time.Duration {
+	if ttl := config.AppConfig.JWT.AccessTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	if !refreshTokensEnabled() {
+		return defaultSessionTokenTTL
+	}
+	return defaultAccessTokenTTL
+}
+
+func refreshTokenTTL() time.Duration {
+	if ttl := config.AppConfig.JWT.RefreshTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultRefreshTokenTTL
+}
+
+// refreshTokensEnabled reports whether refresh tokens can be issued, they are stored in the database.
+func refreshTokensEnabled() bool {
+	return util.ShouldStore && util.Db != nil
+}
+
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// issueTokens issues an access token for the user, together with a refresh token
+// starting a new token family when refresh tokens are enabled.
+func issueTokens(server, username string) (tokenPair, error) {
+	if !refreshTokensEnabled() {
+		accessToken, expiresAt, err := generateJWT(server, username, "")
+		if err != nil {
+			return tokenPair{}, err
+		}
+		return tokenPair{AccessToken: accessToken, ExpiresAt: expiresAt}, nil
+	}
+
+	familyID, err := randomToken(16)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	refreshToken, err := createRefreshToken(util.Db, server, username, familyID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	accessToken, expiresAt, err := generateJWT(server, username, familyID)
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	return tokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// rotateRefreshToken invalidates the refresh token and issues a new token pair in its family.
+// Using an already rotated token revokes the whole family, as the token has most likely leaked.
+func rotateRefreshToken(token string) (tokenPair, error) {
+	if !refreshTokensEnabled() {
+		return tokenPair{}, errRefreshTokensDisabled
+	}
+
+	var stored dbmodel.RefreshToken
+	var pair tokenPair
+	reused := false
+
+	err := util.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&stored, "token_hash = ?", hashToken(token)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errRefreshTokenInvalid
+			}
+			return err
+		}
+
+		if stored.RevokedAt != nil {
+			return errRefreshTokenRevoked
+		}
+		if stored.UsedAt != nil {
+			reused = true
+			return revokeTokenFamily(tx, stored.FamilyID)
+		}
+		if time.Now().After(stored.ExpiresAt) {
+			return errRefreshTokenExpired
+		}
+		if _, ok := util.Clients.Get(util.SessionKey(stored.Server, stored.Username)); !ok {
+			return errClientNotFound
+		}
+
+		// Concurrent refreshes with the same token are reuse as well, only one of them may win
+		result := tx.Model(&dbmodel.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return revokeTokenFamily(tx, stored.FamilyID)
+		}
+
+		refreshToken, err := createRefreshToken(tx, stored.Server, stored.Username, stored.FamilyID)
+		if err != nil {
+			return err
+		}
+
+		accessToken, expiresAt, err := generateJWT(stored.Server, stored.Username, stored.FamilyID)
+		if err != nil {
+			return err
+		}
+
+		pair = tokenPair{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			ExpiresAt:    expiresAt,
+		}
+		return nil
+	})
+	if err != nil {
+		return tokenPair{}, err
+	}
+
+	if reused {
+		util.LogUserSession("refresh token rotation", stored.Username, stored.Server, errRefreshTokenReused)
+		return tokenPair{}, errRefreshTokenReused
+	}
+	return pair, nil
+}
+
+// revokeRefreshToken revokes the family of the refresh token. Unknown tokens are ignored.
+func revokeRefreshToken(token string) error {
+	if !refreshTokensEnabled() {
+		return errRefreshTokensDisabled
+	}
+
+	var stored dbmodel.RefreshToken
+	if err := util.Db.First(&stored, "token_hash = ?", hashToken(token)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return revokeTokenFamily(util.Db, stored.FamilyID)
+}
+
+// revokeUserRefreshTokens revokes every refresh token of the user.
+func revokeUserRefreshTokens(server, username string) error {
+	if !refreshTokensEnabled() {
+		return nil
+	}
+
+	return util.Db.Model(&dbmodel.RefreshToken{}).
+		Where("server = ? AND username = ? AND revoked_at IS NULL", server, username).
+		Update("revoked_at", time.Now()).Error
+}
+
+// hasActiveRefreshTokens reports whether a login of the user can still refresh its token.
+func hasActiveRefreshTokens(server, username string) (bool, error) {
+	var count int64
+	err := util.Db.Model(&dbmodel.RefreshToken{}).
+		Where("server = ? AND username = ? AND revoked_at IS NULL AND used_at IS NULL AND expires_at > ?", server, username, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func revokeTokenFamily(db *gorm.DB, familyID string) error {
+	return db.Model(&dbmodel.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func createRefreshToken(db *gorm.DB, server, username, familyID string) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = db.Create(&dbmodel.RefreshToken{
+		TokenHash: hashToken(token),
+		FamilyID:  familyID,
+		Server:    server,
+		Username:  username,
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	}).Error
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// deleteExpiredRefreshTokens removes the refresh tokens which can not be used anymore.
+func deleteExpiredRefreshTokens() {
+	if !refreshTokensEnabled() {
+		return
+	}
+
+	result := util.Db.Where("expires_at < ?", time.Now()).Delete(&dbmodel.RefreshToken{})
+	if result.Error != nil {
+		util.ErrorLogger.Printf("Failed to delete expired refresh tokens: %v", result.Error)
+		return
+	}
+	util.InfoLogger.Printf("Deleted %d expired refresh tokens", result.RowsAffected)
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RefreshTokenHandler godoc
+// @Summary Refresh your token
+// @Schemes
+// @Description Exchanges a refresh token for a new access token and a new refresh token.
+// @Description The refresh token can only be used once, using it again revokes every token issued since the login.
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Param refreshToken formData string true "Refresh token"
+// @Produce json
+// @Success 200 {object} apimodel.RefreshTokenSuccessResponse
+// @Failure 400 {object} apimodel.RefreshTokenErrorResponse
+// @Failure 401 {object} apimodel.RefreshTokenErrorResponse
+// @Failure 500 {object} apimodel.RefreshTokenErrorResponse
+// @Failure 501 {object} apimodel.RefreshTokenErrorResponse
+// @Router /token/refresh [post]
+func RefreshTokenHandler(c *gin.Context) {
+	refreshToken := c.PostForm("refreshToken")
+	if refreshToken == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "refreshToken field is missing", "success": false})
+		return
+	}
+
+	pair, err := rotateRefreshToken(refreshToken)
+	if err != nil {
+		c.AbortWithStatusJSON(refreshTokenErrorStatus(err), gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"error":        "",
+		"success":      true,
+		"token":        pair.AccessToken,
+		"refreshToken": pair.RefreshToken,
+		"expires":      pair.ExpiresAt.Unix(),
+	})
+}
+
+// RevokeTokenHandler godoc
+// @Summary Revoke a refresh token
+// @Schemes
+// @Description Revokes the refresh token, together with every token issued since the same login.
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Param refreshToken formData string true "Refresh token"
+// @Produce json
+// @Success 200 {object} apimodel.RevokeTokenSuccessResponse
+// @Failure 400 {object} apimodel.RefreshTokenErrorResponse
+// @Failure 500 {object} apimodel.RefreshTokenErrorResponse
+// @Failure 501 {object} apimodel.RefreshTokenErrorResponse
+// @Router /token/revoke [post]
+func RevokeTokenHandler(c *gin.Context) {
+	refreshToken := c.PostForm("refreshToken")
+	if refreshToken == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "refreshToken field is missing", "success": false})
+		return
+	}
+
+	if err := revokeRefreshToken(refreshToken); err != nil {
+		c.AbortWithStatusJSON(refreshTokenErrorStatus(err), gin.H{"error": err.Error(), "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"error": "", "success": true})
+}
+
+func refreshTokenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errRefreshTokensDisabled):
+		return http.StatusNotImplemented
+	case errors.Is(err, errRefreshTokenInvalid),
+		errors.Is(err, errRefreshTokenExpired),
+		errors.Is(err, errRefreshTokenRevoked),
+		errors.Is(err, errRefreshTokenReused),
+		errors.Is(err, errClientNotFound),
+		errors.Is(err, errTokenRevoked):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
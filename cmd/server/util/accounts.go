@@ -0,0 +1,138 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/dbmodel"
+)
+
+// Account is an edupage account of an EduPage2 identity.
+type Account struct {
+	ID       string
+	Server   string
+	Username string
+}
+
+// AccountID returns the stable ID of the account, used to select it in requests.
+func AccountID(server, username string) string {
+	sum := sha256.Sum256([]byte(server + "\x00" + username))
+	return hex.EncodeToString(sum[:6])
+}
+
+// NewAccount creates the account of the user on the server.
+func NewAccount(server, username string) Account {
+	return Account{
+		ID:       AccountID(server, username),
+		Server:   server,
+		Username: username,
+	}
+}
+
+// Key returns the session registry key of the account.
+func (a Account) Key() string {
+	return SessionKey(a.Server, a.Username)
+}
+
+// AccountLinks stores the accounts linked to every identity, it is safe for concurrent use.
+// The links are stored in the database when it is enabled.
+type AccountLinks struct {
+	mu    sync.RWMutex
+	links map[string][]Account
+}
+
+// NewAccountLinks creates an empty account link store.
+func NewAccountLinks() *AccountLinks {
+	return &AccountLinks{links: make(map[string][]Account)}
+}
+
+// List returns the accounts linked to the identity.
+func (a *AccountLinks) List(identity string) []Account {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Account(nil), a.links[identity]...)
+}
+
+// Find looks up the linked account by its ID.
+func (a *AccountLinks) Find(identity, id string) (Account, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, account := range a.links[identity] {
+		if account.ID == id {
+			return account, true
+		}
+	}
+	return Account{}, false
+}
+
+// Link links the account to the identity, linking an already linked account does nothing.
+func (a *AccountLinks) Link(identity string, account Account) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, linked := range a.links[identity] {
+		if linked.ID == account.ID {
+			return nil
+		}
+	}
+
+	if ShouldStore {
+		link := dbmodel.LinkedAccount{Identity: identity, Server: account.Server, Username: account.Username}
+		if err := Db.Where(link).FirstOrCreate(&link).Error; err != nil {
+			return fmt.Errorf("failed to store linked account: %w", err)
+		}
+	}
+
+	a.links[identity] = append(a.links[identity], account)
+	return nil
+}
+
+// Unlink removes the linked account from the identity, returns false if it was not linked.
+func (a *AccountLinks) Unlink(identity, id string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	accounts := a.links[identity]
+	for i, account := range accounts {
+		if account.ID != id {
+			continue
+		}
+
+		if ShouldStore {
+			err := Db.Where("identity = ? AND server = ? AND username = ?", identity, account.Server, account.Username).
+				Delete(&dbmodel.LinkedAccount{}).Error
+			if err != nil {
+				return false, fmt.Errorf("failed to delete linked account: %w", err)
+			}
+		}
+
+		a.links[identity] = append(accounts[:i:i], accounts[i+1:]...)
+		if len(a.links[identity]) == 0 {
+			delete(a.links, identity)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Load reads the linked accounts from the database.
+func (a *AccountLinks) Load() error {
+	if !ShouldStore {
+		return nil
+	}
+
+	var records []dbmodel.LinkedAccount
+	if err := Db.Order("id").Find(&records).Error; err != nil {
+		return fmt.Errorf("failed to load linked accounts: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.links = make(map[string][]Account)
+	for _, record := range records {
+		a.links[record.Identity] = append(a.links[record.Identity], NewAccount(record.Server, record.Username))
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/config"
+)
+
+// DefaultAttachmentCacheTTL is used when the time-to-live of the cached attachments isn't configured.
+const DefaultAttachmentCacheTTL = 24 * time.Hour
+
+// CachedAttachment is a small attachment kept in the cache, so it isn't downloaded from edupage on every request.
+type CachedAttachment struct {
+	ContentType string    `json:"contentType"`
+	Disposition string    `json:"disposition,omitempty"`
+	ETag        string    `json:"etag"`
+	ModTime     time.Time `json:"modTime"`
+	Content     []byte    `json:"content"`
+}
+
+// AttachmentStore caches the attachments by key, see DiskAttachmentStore and RedisAttachmentStore.
+type AttachmentStore interface {
+	// Get returns the cached attachment, false if it isn't cached or has expired.
+	Get(key string) (CachedAttachment, bool, error)
+	Set(key string, attachment CachedAttachment) error
+}
+
+// AttachmentCacheTTL returns the configured time-to-live of the cached attachments.
+func AttachmentCacheTTL() time.Duration {
+	if ttl := config.AppConfig.Attachments.Cache.TTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return DefaultAttachmentCacheTTL
+}
+
+// DiskAttachmentStore keeps the attachments in files of a directory, the files expire after the TTL since they were written.
+type DiskAttachmentStore struct {
+	dir string
+	ttl time.Duration
+}
+
+// NewDiskAttachmentStore creates the store in the directory, creating the directory if it doesn't exist.
+func NewDiskAttachmentStore(dir string, ttl time.Duration) (*DiskAttachmentStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating attachment cache directory: %w", err)
+	}
+	return &DiskAttachmentStore{dir: dir, ttl: ttl}, nil
+}
+
+// path returns the file of the key, the keys are hashed so they can't escape the directory.
+func (s *DiskAttachmentStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *DiskAttachmentStore) Get(key string) (CachedAttachment, bool, error) {
+	p := s.path(key)
+	info, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return CachedAttachment{}, false, nil
+	} else if err != nil {
+		return CachedAttachment{}, false, fmt.Errorf("error reading cached attachment: %w", err)
+	}
+	if time.Since(info.ModTime()) > s.ttl {
+		_ = os.Remove(p)
+		return CachedAttachment{}, false, nil
+	}
+
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return CachedAttachment{}, false, nil
+	} else if err != nil {
+		return CachedAttachment{}, false, fmt.Errorf("error reading cached attachment: %w", err)
+	}
+
+	var attachment CachedAttachment
+	if err := json.Unmarshal(data, &attachment); err != nil {
+		return CachedAttachment{}, false, fmt.Errorf("error unmarshalling cached attachment: %w", err)
+	}
+	return attachment, true, nil
+}
+
+// Set writes the attachment to a temporary file first, so concurrent readers never see a partial file.
+func (s *DiskAttachmentStore) Set(key string, attachment CachedAttachment) error {
+	data, err := json.Marshal(attachment)
+	if err != nil {
+		return fmt.Errorf("error marshalling attachment: %w", err)
+	}
+
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error caching attachment: %w", err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("error caching attachment: %w", err)
+	}
+	return nil
+}
+
+// Prune removes the expired attachments, which weren't requested again since they expired.
+func (s *DiskAttachmentStore) Prune() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		ErrorLogger.Printf("Failed to prune the attachment cache: %v", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || (!strings.HasSuffix(entry.Name(), ".json") && !strings.HasPrefix(entry.Name(), ".tmp-")) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) <= s.ttl {
+			continue
+		}
+		_ = os.Remove(filepath.Join(s.dir, entry.Name()))
+	}
+}
+
+// RedisAttachmentStore keeps the attachments in redis, next to the other cached data.
+type RedisAttachmentStore struct {
+	ttl time.Duration
+}
+
+func NewRedisAttachmentStore(ttl time.Duration) *RedisAttachmentStore {
+	return &RedisAttachmentStore{ttl: ttl}
+}
+
+func (s *RedisAttachmentStore) Get(key string) (CachedAttachment, bool, error) {
+	var attachment CachedAttachment
+	read, err := ReadCache(key, &attachment)
+	return attachment, read, err
+}
+
+func (s *RedisAttachmentStore) Set(key string, attachment CachedAttachment) error {
+	return CacheData(key, attachment, s.ttl)
+}
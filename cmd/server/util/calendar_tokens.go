@@ -0,0 +1,171 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/dbmodel"
+	"github.com/DislikesSchool/EduPage2-server/config"
+	"gorm.io/gorm"
+)
+
+// The defaults of the calendar configuration.
+const (
+	DefaultCalendarDaysBefore = 7
+	DefaultCalendarDaysAfter  = 28
+)
+
+// CalendarFeed is the calendar of an account, or of a child of a parent account.
+type CalendarFeed struct {
+	Server   string
+	Username string
+	// Child is the selected child of a parent account, empty for students
+	Child string
+}
+
+// Key returns the session registry key of the account of the feed.
+func (f CalendarFeed) Key() string {
+	return SessionKey(f.Server, f.Username)
+}
+
+// FeedTokens stores the read-only tokens of the calendar feeds, it is safe for concurrent use.
+// The tokens are stored in the database when it is enabled, and only kept in memory otherwise.
+// Only the hashes of the tokens are kept, a feed has at most one token.
+type FeedTokens struct {
+	mu    sync.Mutex
+	feeds map[string]CalendarFeed
+}
+
+// NewFeedTokens creates an empty calendar token store.
+func NewFeedTokens() *FeedTokens {
+	return &FeedTokens{feeds: make(map[string]CalendarFeed)}
+}
+
+// Issue creates a new token of the feed, the previous token of the feed is revoked.
+func (t *FeedTokens) Issue(feed CalendarFeed) (string, error) {
+	token, err := calendarToken()
+	if err != nil {
+		return "", err
+	}
+	hash := hashCalendarToken(token)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ShouldStore {
+		err := Db.Transaction(func(tx *gorm.DB) error {
+			if err := revokeCalendarFeed(tx, feed); err != nil {
+				return err
+			}
+			return tx.Create(&dbmodel.CalendarToken{TokenHash: hash, Server: feed.Server, Username: feed.Username, Child: feed.Child}).Error
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to store calendar token: %w", err)
+		}
+		return token, nil
+	}
+
+	t.revoke(func(f CalendarFeed) bool { return f == feed })
+	t.feeds[hash] = feed
+	return token, nil
+}
+
+// Lookup returns the feed of the token, false if the token is unknown or has been revoked.
+func (t *FeedTokens) Lookup(token string) (CalendarFeed, bool, error) {
+	hash := hashCalendarToken(token)
+
+	if ShouldStore {
+		var record dbmodel.CalendarToken
+		err := Db.Where("token_hash = ?", hash).First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return CalendarFeed{}, false, nil
+		} else if err != nil {
+			return CalendarFeed{}, false, fmt.Errorf("failed to load calendar token: %w", err)
+		}
+		return CalendarFeed{Server: record.Server, Username: record.Username, Child: record.Child}, true, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	feed, ok := t.feeds[hash]
+	return feed, ok, nil
+}
+
+// Revoke revokes the token of the feed, returns false if the feed has no token.
+func (t *FeedTokens) Revoke(feed CalendarFeed) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ShouldStore {
+		result := Db.Where("server = ? AND username = ? AND child = ?", feed.Server, feed.Username, feed.Child).Delete(&dbmodel.CalendarToken{})
+		if result.Error != nil {
+			return false, fmt.Errorf("failed to revoke calendar token: %w", result.Error)
+		}
+		return result.RowsAffected > 0, nil
+	}
+
+	return t.revoke(func(f CalendarFeed) bool { return f == feed }) > 0, nil
+}
+
+// RevokeUser revokes the tokens of all feeds of the user, including the feeds of their children.
+func (t *FeedTokens) RevokeUser(server, username string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ShouldStore {
+		err := Db.Where("server = ? AND username = ?", server, username).Delete(&dbmodel.CalendarToken{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to revoke calendar tokens: %w", err)
+		}
+		return nil
+	}
+
+	t.revoke(func(f CalendarFeed) bool { return f.Server == server && f.Username == username })
+	return nil
+}
+
+// revoke removes the in-memory tokens of the matching feeds, the lock must be held.
+func (t *FeedTokens) revoke(matches func(CalendarFeed) bool) int {
+	revoked := 0
+	for hash, feed := range t.feeds {
+		if matches(feed) {
+			delete(t.feeds, hash)
+			revoked++
+		}
+	}
+	return revoked
+}
+
+func revokeCalendarFeed(tx *gorm.DB, feed CalendarFeed) error {
+	return tx.Where("server = ? AND username = ? AND child = ?", feed.Server, feed.Username, feed.Child).Delete(&dbmodel.CalendarToken{}).Error
+}
+
+func calendarToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CalendarDays returns how many days before and after today the calendar feeds contain.
+func CalendarDays() (before int, after int) {
+	before, after = DefaultCalendarDaysBefore, DefaultCalendarDaysAfter
+	if days := config.AppConfig.Calendar.DaysBefore; days > 0 {
+		before = days
+	}
+	if days := config.AppConfig.Calendar.DaysAfter; days > 0 {
+		after = days
+	}
+	return before, after
+}
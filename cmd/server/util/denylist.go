@@ -0,0 +1,127 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	denylistTokenPrefix = "denylist:jti:"
+	denylistUserPrefix  = "denylist:user:"
+)
+
+// memoryDenylist is used when redis is not enabled, its entries are lost on restart.
+var memoryDenylist = struct {
+	sync.Mutex
+	tokens map[string]time.Time
+	users  map[string]denylistCutoff
+}{
+	tokens: make(map[string]time.Time),
+	users:  make(map[string]denylistCutoff),
+}
+
+type denylistCutoff struct {
+	before    time.Time
+	expiresAt time.Time
+}
+
+// RevokeToken adds the token ID to the denylist. The entry is kept until the token expires.
+func RevokeToken(jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if ShouldCache {
+		if err := Rdb.Set(Ctx, denylistTokenPrefix+jti, 1, ttl).Err(); err != nil {
+			return fmt.Errorf("error adding token to denylist: %w", err)
+		}
+		return nil
+	}
+
+	memoryDenylist.Lock()
+	defer memoryDenylist.Unlock()
+	pruneMemoryDenylist()
+	memoryDenylist.tokens[jti] = expiresAt
+	return nil
+}
+
+// IsTokenRevoked reports whether the token ID is on the denylist.
+func IsTokenRevoked(jti string) (bool, error) {
+	if ShouldCache {
+		exists, err := Rdb.Exists(Ctx, denylistTokenPrefix+jti).Result()
+		if err != nil {
+			return false, fmt.Errorf("error checking token denylist: %w", err)
+		}
+		return exists == 1, nil
+	}
+
+	memoryDenylist.Lock()
+	defer memoryDenylist.Unlock()
+	expiresAt, ok := memoryDenylist.tokens[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+// RevokeTokensIssuedBefore revokes every token of the session issued before the time.
+// The entry is kept for ttl, the longest lifetime of a token.
+func RevokeTokensIssuedBefore(key string, before time.Time, ttl time.Duration) error {
+	if ShouldCache {
+		err := Rdb.Set(Ctx, denylistUserPrefix+key, before.UnixMilli(), ttl).Err()
+		if err != nil {
+			return fmt.Errorf("error adding session to denylist: %w", err)
+		}
+		return nil
+	}
+
+	memoryDenylist.Lock()
+	defer memoryDenylist.Unlock()
+	pruneMemoryDenylist()
+	// Tokens are issued with millisecond precision, the same as in redis
+	memoryDenylist.users[key] = denylistCutoff{before: before.Truncate(time.Millisecond), expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// TokensRevokedBefore returns the time before which the tokens of the session were revoked,
+// the zero time if they were not.
+func TokensRevokedBefore(key string) (time.Time, error) {
+	if ShouldCache {
+		value, err := Rdb.Get(Ctx, denylistUserPrefix+key).Result()
+		if err == redis.Nil {
+			return time.Time{}, nil
+		} else if err != nil {
+			return time.Time{}, fmt.Errorf("error checking session denylist: %w", err)
+		}
+		before, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid session denylist entry: %w", err)
+		}
+		return time.UnixMilli(before), nil
+	}
+
+	memoryDenylist.Lock()
+	defer memoryDenylist.Unlock()
+	cutoff, ok := memoryDenylist.users[key]
+	if !ok || time.Now().After(cutoff.expiresAt) {
+		return time.Time{}, nil
+	}
+	return cutoff.before, nil
+}
+
+// pruneMemoryDenylist removes the expired entries, the lock must be held.
+func pruneMemoryDenylist() {
+	now := time.Now()
+	for jti, expiresAt := range memoryDenylist.tokens {
+		if now.After(expiresAt) {
+			delete(memoryDenylist.tokens, jti)
+		}
+	}
+	for key, cutoff := range memoryDenylist.users {
+		if now.After(cutoff.expiresAt) {
+			delete(memoryDenylist.users, key)
+		}
+	}
+}
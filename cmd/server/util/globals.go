@@ -11,16 +11,34 @@ import (
 	"gorm.io/gorm"
 )
 
-type ClientData struct {
-	CrJobId     cron.EntryID
-	Client      *edupage.EdupageClient
-	DataStorage *DataStorageConfig
-}
+var Clients = NewSessionRegistry()
 
-var Clients = make(map[string]*ClientData)
+// Accounts are the edupage accounts linked to the identities of the users.
+var Accounts = NewAccountLinks()
+
+// ThreadReads are the read marks of the message threads.
+var ThreadReads = NewReadMarks()
+
+// AttachmentCache caches the small attachments downloaded through the server, it is nil when the cache is disabled.
+var AttachmentCache AttachmentStore
+
+// UserCacheStore keeps the cached data of the users, it is nil when the cache is disabled.
+var UserCacheStore CacheStore
+
+// Grades is the history of the grades of the users who have opted in.
+var Grades = NewGradeHistory()
+
+// Schools caches the data shared by all users of a school.
+var Schools = NewSchoolCache()
+
+// CalendarTokens are the read-only tokens of the subscribable calendar feeds.
+var CalendarTokens = NewFeedTokens()
 
 var Ctx = context.Background()
 
+// EdupageOptions are used for every login to edupage, tests point them to a fake server.
+var EdupageOptions edupage.LoginOptions
+
 var Cr *cron.Cron
 
 var Rdb redis.Client
@@ -0,0 +1,127 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/dbmodel"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/grades"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"gorm.io/gorm"
+)
+
+// GradeHistory stores the snapshots of the results in the database and the changes between them, it is safe for concurrent use.
+// The history is only kept for the users who have opted in, see DataStorageConfig#StoresGrades.
+type GradeHistory struct {
+	// mu serializes the recording, so concurrent refreshes don't detect the same changes twice
+	mu sync.Mutex
+}
+
+// NewGradeHistory creates the history, it requires the database.
+func NewGradeHistory() *GradeHistory {
+	return &GradeHistory{}
+}
+
+// StoresGrades reports whether the grade history of the user is kept.
+func (d *DataStorageConfig) StoresGrades() bool {
+	return ShouldStore && d != nil && d.Enabled && d.Grades
+}
+
+// Record compares the results with the last snapshot of the owner in the period, stores the changes and replaces the snapshot.
+// The first snapshot has no changes, its grades are the baseline for the later ones.
+func (h *GradeHistory) Record(owner, period string, results model.Results, at time.Time) ([]dbmodel.GradeChange, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	encoded, err := json.Marshal(results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode results: %w", err)
+	}
+
+	var records []dbmodel.GradeChange
+	err = Db.Transaction(func(tx *gorm.DB) error {
+		var snapshot dbmodel.GradeSnapshot
+		err := tx.Where("owner = ? AND period = ?", owner, period).First(&snapshot).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&dbmodel.GradeSnapshot{Owner: owner, Period: period, Results: string(encoded)}).Error
+		} else if err != nil {
+			return err
+		}
+
+		var previous model.Results
+		if err := json.Unmarshal([]byte(snapshot.Results), &previous); err != nil {
+			return fmt.Errorf("failed to decode the snapshot: %w", err)
+		}
+
+		for _, change := range grades.Diff(previous, results) {
+			records = append(records, dbmodel.GradeChange{
+				DetectedAt: at,
+				Owner:      owner,
+				Period:     period,
+				Kind:       change.Kind,
+				EventID:    change.EventID,
+				Before:     encodeEvent(change.Before),
+				After:      encodeEvent(change.After),
+			})
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		if err := tx.Create(&records).Error; err != nil {
+			return err
+		}
+		snapshot.Results = string(encoded)
+		return tx.Save(&snapshot).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record grades: %w", err)
+	}
+	return records, nil
+}
+
+// Changes returns the changes of the owner in the period detected after the time, from the oldest.
+func (h *GradeHistory) Changes(owner, period string, since time.Time) ([]dbmodel.GradeChange, error) {
+	var records []dbmodel.GradeChange
+	err := Db.Where("owner = ? AND period = ? AND detected_at > ?", owner, period, since).Order("detected_at, id").Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load grade changes: %w", err)
+	}
+	return records, nil
+}
+
+// Delete removes the grade history of the user of the client, together with the history of all their children.
+func (h *GradeHistory) Delete(client *edupage.EdupageClient) error {
+	user, err := client.GetUser(false)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	// The owners start like the cache keys, see CacheKeyFromEPClient
+	prefix := fmt.Sprintf("%s:%s:%%", strings.Split(client.Credentials.Server, ".")[0], user.UserRow.UserID)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner LIKE ?", prefix).Delete(&dbmodel.GradeSnapshot{}).Error; err != nil {
+			return fmt.Errorf("failed to delete grade snapshots: %w", err)
+		}
+		if err := tx.Where("owner LIKE ?", prefix).Delete(&dbmodel.GradeChange{}).Error; err != nil {
+			return fmt.Errorf("failed to delete grade changes: %w", err)
+		}
+		return nil
+	})
+}
+
+func encodeEvent(event *model.Event) string {
+	if event == nil {
+		return ""
+	}
+	encoded, _ := json.Marshal(event)
+	return string(encoded)
+}
@@ -0,0 +1,106 @@
+package util
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/dbmodel"
+	"gorm.io/gorm/clause"
+)
+
+// ReadMarks stores until when the users have read their threads, it is safe for concurrent use.
+// The marks are stored in the database when it is enabled, and loaded for every owner on first use.
+type ReadMarks struct {
+	mu    sync.Mutex
+	marks map[string]map[string]time.Time
+}
+
+// NewReadMarks creates an empty read state store.
+func NewReadMarks() *ReadMarks {
+	return &ReadMarks{marks: make(map[string]map[string]time.Time)}
+}
+
+// Get returns until when the owner has read the threads, by thread ID.
+func (r *ReadMarks) Get(owner string) (map[string]time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	marks, err := r.load(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := make(map[string]time.Time, len(marks))
+	for thread, at := range marks {
+		copied[thread] = at
+	}
+	return copied, nil
+}
+
+// MarkRead marks the messages of the thread added until the time as read.
+func (r *ReadMarks) MarkRead(owner, thread string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	marks, err := r.load(owner)
+	if err != nil {
+		return err
+	}
+
+	if ShouldStore {
+		record := dbmodel.ThreadRead{Owner: owner, ThreadID: thread, ReadAt: at}
+		err := Db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "owner"}, {Name: "thread_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"read_at", "updated_at"}),
+		}).Create(&record).Error
+		if err != nil {
+			return fmt.Errorf("failed to store thread read state: %w", err)
+		}
+	}
+
+	marks[thread] = at
+	return nil
+}
+
+// MarkUnread removes the read mark of the thread, all its messages are unread again.
+func (r *ReadMarks) MarkUnread(owner, thread string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	marks, err := r.load(owner)
+	if err != nil {
+		return err
+	}
+
+	if ShouldStore {
+		err := Db.Where("owner = ? AND thread_id = ?", owner, thread).Delete(&dbmodel.ThreadRead{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete thread read state: %w", err)
+		}
+	}
+
+	delete(marks, thread)
+	return nil
+}
+
+// load returns the marks of the owner, reading them from the database on first use. The lock must be held.
+func (r *ReadMarks) load(owner string) (map[string]time.Time, error) {
+	if marks, ok := r.marks[owner]; ok {
+		return marks, nil
+	}
+
+	marks := make(map[string]time.Time)
+	if ShouldStore {
+		var records []dbmodel.ThreadRead
+		if err := Db.Where("owner = ?", owner).Find(&records).Error; err != nil {
+			return nil, fmt.Errorf("failed to load thread read state: %w", err)
+		}
+		for _, record := range records {
+			marks[record.ThreadID] = record.ReadAt
+		}
+	}
+
+	r.marks[owner] = marks
+	return marks, nil
+}
@@ -0,0 +1,232 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/config"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+// The defaults of the school cache configuration.
+const (
+	DefaultSchoolDBITTL    = 24 * time.Hour
+	DefaultSchoolMemoryTTL = time.Minute
+)
+
+// SchoolDBI is the part of the DBI which is the same for all users of a school.
+type SchoolDBI struct {
+	Teachers   map[string]model.Teacher     `json:"teachers"`
+	Subjects   map[string]model.Subject     `json:"subjects"`
+	Classrooms map[string]model.Classroom   `json:"classrooms"`
+	Classes    map[string]model.Class       `json:"classes"`
+	Periods    map[json.Number]model.Period `json:"periods"`
+}
+
+// NewSchoolDBI takes the school-wide part of the DBI of a user. The maps are shared with the DBI, they mustn't be modified.
+func NewSchoolDBI(dbi *model.DBI) SchoolDBI {
+	return SchoolDBI{
+		Teachers:   dbi.Teachers,
+		Subjects:   dbi.Subjects,
+		Classrooms: dbi.Classrooms,
+		Classes:    dbi.Classes,
+		Periods:    dbi.Periods,
+	}
+}
+
+// SchoolCache keeps the data shared by all users of a school, it is safe for concurrent use.
+// The data is kept in memory for a short time, and in Redis when it is enabled, so the instances share it.
+// Without Redis, the memory is the only tier and the data is kept for the whole TTL.
+type SchoolCache struct {
+	mu      sync.Mutex
+	schools map[string]schoolEntry
+}
+
+type schoolEntry struct {
+	dbi     SchoolDBI
+	expires time.Time
+}
+
+// NewSchoolCache creates an empty school cache.
+func NewSchoolCache() *SchoolCache {
+	return &SchoolCache{schools: make(map[string]schoolEntry)}
+}
+
+// DBI returns the school-wide DBI of the school of the client. It is loaded from the DBI of the client when it isn't cached.
+func (s *SchoolCache) DBI(ctx context.Context, client *edupage.EdupageClient) (SchoolDBI, error) {
+	dbi, ok, err := s.cached(client)
+	if err != nil || ok {
+		return dbi, err
+	}
+
+	user, err := client.GetUserContext(ctx, false)
+	if err != nil {
+		return SchoolDBI{}, err
+	}
+	dbi = NewSchoolDBI(&user.DBI)
+	if err := s.Store(client, dbi); err != nil {
+		return SchoolDBI{}, err
+	}
+	return dbi, nil
+}
+
+// Refresh stores the DBI of the client, which has just been loaded from edupage.
+// When it differs from the cached DBI, all data of the school is invalidated first, e.g. the occupancy of the classrooms.
+func (s *SchoolCache) Refresh(client *edupage.EdupageClient) error {
+	user, err := client.GetUser(false)
+	if err != nil {
+		return err
+	}
+	fresh := NewSchoolDBI(&user.DBI)
+
+	cached, ok, err := s.cached(client)
+	if err != nil {
+		return err
+	}
+	if ok && !reflect.DeepEqual(cached, fresh) {
+		if err := s.Invalidate(SchoolName(client)); err != nil {
+			return err
+		}
+	}
+	return s.Store(client, fresh)
+}
+
+// cached returns the DBI from the memory, or from Redis when it is enabled.
+func (s *SchoolCache) cached(client *edupage.EdupageClient) (SchoolDBI, bool, error) {
+	school := SchoolName(client)
+
+	s.mu.Lock()
+	entry, ok := s.schools[school]
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.dbi, true, nil
+	}
+
+	if ShouldCache {
+		var dbi SchoolDBI
+		read, err := ReadCache(SchoolCacheKey(client, "dbi"), &dbi)
+		if err != nil {
+			return SchoolDBI{}, false, err
+		}
+		if read {
+			s.remember(school, dbi)
+			return dbi, true, nil
+		}
+	}
+	return SchoolDBI{}, false, nil
+}
+
+// Store replaces the school-wide DBI of the school of the client, e.g. with the DBI of a user who has just logged in.
+func (s *SchoolCache) Store(client *edupage.EdupageClient, dbi SchoolDBI) error {
+	s.remember(SchoolName(client), dbi)
+	if ShouldCache {
+		if err := CacheData(SchoolCacheKey(client, "dbi"), dbi, SchoolDBITTL()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Invalidate removes all cached data of the school, including the data cached by other instances.
+func (s *SchoolCache) Invalidate(school string) error {
+	s.mu.Lock()
+	delete(s.schools, school)
+	s.mu.Unlock()
+	schoolData.DeletePrefix(school + ":school:")
+
+	if !ShouldCache {
+		return nil
+	}
+	// SCAN doesn't block redis while the keys are listed
+	iter := Rdb.Scan(Ctx, 0, school+":school:*", 100).Iterator()
+	for iter.Next(Ctx) {
+		if err := Rdb.Del(Ctx, iter.Val()).Err(); err != nil {
+			return fmt.Errorf("error deleting the school cache: %w", err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("error scanning the school cache: %w", err)
+	}
+	return nil
+}
+
+func (s *SchoolCache) remember(school string, dbi SchoolDBI) {
+	ttl := SchoolDBITTL()
+	if ShouldCache {
+		ttl = min(ttl, SchoolMemoryTTL())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schools[school] = schoolEntry{dbi: dbi, expires: time.Now().Add(ttl)}
+}
+
+// schoolData keeps the data of the schools cached by SchoolData in memory.
+var schoolData = NewMemoryCacheStore()
+
+// SchoolData returns the data shared by all users of the school of the client, e.g. the occupancy of a week, cached under SchoolCacheKey.
+// The data is kept in memory, and in Redis when it is enabled, in the same way as the DBI of the school.
+// Concurrent retrievals of the same data are shared, so edupage is asked only once.
+func SchoolData[T any](ctx context.Context, client *edupage.EdupageClient, key string, ttl time.Duration, fetch func(ctx context.Context) (T, error)) (T, error) {
+	key = SchoolCacheKey(client, key)
+	memoryTTL := ttl
+	if ShouldCache {
+		memoryTTL = min(ttl, SchoolMemoryTTL())
+	}
+
+	var data T
+	if read, err := schoolData.Read(key, &data); err != nil || read {
+		return data, err
+	}
+	if ShouldCache {
+		read, err := ReadCache(key, &data)
+		if err != nil {
+			return data, err
+		}
+		if read {
+			_ = schoolData.Write(key, data, memoryTTL)
+			return data, nil
+		}
+	}
+
+	return shareFetch(ctx, key, func(ctx context.Context) (T, error) {
+		data, err := fetch(ctx)
+		if err != nil {
+			return data, err
+		}
+		if ShouldCache {
+			if err := CacheData(key, data, ttl); err != nil {
+				return data, err
+			}
+		}
+		_ = schoolData.Write(key, data, memoryTTL)
+		return data, nil
+	})
+}
+
+// SchoolName returns the name of the school of the client, which prefixes its cache keys.
+func SchoolName(client *edupage.EdupageClient) string {
+	return strings.Split(client.Credentials.Server, ".")[0]
+}
+
+// SchoolDBITTL returns the configured time-to-live of the school-wide DBI.
+func SchoolDBITTL() time.Duration {
+	if ttl := config.AppConfig.SchoolCache.DBI; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return DefaultSchoolDBITTL
+}
+
+// SchoolMemoryTTL returns how long the instances keep the school data in memory before reading it from Redis again.
+func SchoolMemoryTTL() time.Duration {
+	if ttl := config.AppConfig.SchoolCache.Memory; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return DefaultSchoolMemoryTTL
+}
@@ -0,0 +1,242 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/crypto"
+	"github.com/DislikesSchool/EduPage2-server/cmd/server/dbmodel"
+	"github.com/DislikesSchool/EduPage2-server/config"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionStorePrefix = "session:"
+	// SessionStoreTTL is how long a persisted session is kept without being restored or refreshed.
+	SessionStoreTTL = 7 * 24 * time.Hour
+)
+
+// storedSession is the persisted form of a session in the registry.
+type storedSession struct {
+	Key         string            `json:"key"`
+	Session     edupage.Session   `json:"session"`
+	DataStorage DataStorageConfig `json:"dataStorage"`
+}
+
+// ShouldPersistSessions reports whether there is a store for the upstream sessions.
+// Redis is preferred, the database is used otherwise.
+func ShouldPersistSessions() bool {
+	return ShouldCache || ShouldStore
+}
+
+// PersistSession stores the session cookies and the gsechash of the session,
+// encrypted when encryption is enabled, so the session survives a restart of the server.
+func PersistSession(key string, session *ClientData) error {
+	if !ShouldPersistSessions() {
+		return nil
+	}
+
+	exported, err := session.Client.ExportSession()
+	if err != nil {
+		return fmt.Errorf("failed to export session: %w", err)
+	}
+
+	stored := storedSession{
+		Key:     key,
+		Session: exported,
+	}
+	if session.DataStorage != nil {
+		stored.DataStorage = *session.DataStorage
+	}
+
+	data, err := encodeStoredSession(stored)
+	if err != nil {
+		return err
+	}
+
+	if ShouldCache {
+		if err := Rdb.Set(Ctx, sessionStorePrefix+key, data, SessionStoreTTL).Err(); err != nil {
+			return fmt.Errorf("error setting session in Redis: %w", err)
+		}
+		return nil
+	}
+
+	var record dbmodel.Session
+	result := Db.Where(dbmodel.Session{SessionKey: key}).Assign(dbmodel.Session{Data: data}).FirstOrCreate(&record)
+	if result.Error != nil {
+		return fmt.Errorf("failed to store session: %w", result.Error)
+	}
+	return nil
+}
+
+// DeletePersistedSession removes the persisted copy of the session, if there is one.
+func DeletePersistedSession(key string) error {
+	if !ShouldPersistSessions() {
+		return nil
+	}
+
+	if ShouldCache {
+		if err := Rdb.Del(Ctx, sessionStorePrefix+key).Err(); err != nil {
+			return fmt.Errorf("error deleting session from Redis: %w", err)
+		}
+		return nil
+	}
+
+	if err := Db.Where("session_key = ?", key).Delete(&dbmodel.Session{}).Error; err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// RestoreSessions rehydrates the persisted sessions into the session registry,
+// without logging in to edupage again. Expired sessions are deleted,
+// their users are left to LoadStoredUsers. Returns the number of restored sessions.
+func RestoreSessions() int {
+	if !ShouldPersistSessions() {
+		return 0
+	}
+
+	sessions, err := loadPersistedSessions()
+	if err != nil {
+		LogUserSession("session restore", "all", "all", err)
+		return 0
+	}
+
+	InfoLogger.Printf("Restoring %d persisted sessions...", len(sessions))
+
+	workerCount := 5
+	jobs := make(chan string, len(sessions))
+	var restored sync.WaitGroup
+	var mu sync.Mutex
+	successCount := 0
+
+	for w := 0; w < workerCount; w++ {
+		restored.Add(1)
+		go func() {
+			defer restored.Done()
+			for data := range jobs {
+				if restoreSession(data) {
+					mu.Lock()
+					successCount++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, data := range sessions {
+		jobs <- data
+	}
+	close(jobs)
+	restored.Wait()
+
+	InfoLogger.Printf("Successfully restored %d/%d sessions", successCount, len(sessions))
+	return successCount
+}
+
+func restoreSession(data string) bool {
+	stored, err := decodeStoredSession(data)
+	if err != nil {
+		LogUserSession("session restore", "unknown", "unknown", err)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(Ctx, RefreshTimeout)
+	defer cancel()
+
+	client, err := edupage.RestoreClient(ctx, stored.Session, EdupageOptions)
+	if err != nil {
+		LogUserSession("session restore", stored.Session.Username, stored.Session.Server, err)
+		if errors.Is(err, edupage.ErrorUnauthorized) {
+			DeletePersistedSession(stored.Key)
+		}
+		return false
+	}
+
+	dataStorage := stored.DataStorage
+	session := NewClientData(client, &dataStorage)
+	if err := Clients.SchedulePing(stored.Key, session); err != nil {
+		ErrorLogger.Printf("Failed to schedule session ping for %s: %v", stored.Key, err)
+	}
+	Clients.Set(stored.Key, session)
+
+	// Store the refreshed gsechash and extend the lifetime of the session
+	if err := PersistSession(stored.Key, session); err != nil {
+		ErrorLogger.Printf("Failed to persist session %s: %v", stored.Key, err)
+	}
+
+	LogUserSession("session restore", stored.Session.Username, stored.Session.Server, nil)
+	return true
+}
+
+func loadPersistedSessions() ([]string, error) {
+	var sessions []string
+
+	if ShouldCache {
+		iter := Rdb.Scan(Ctx, 0, sessionStorePrefix+"*", 100).Iterator()
+		for iter.Next(Ctx) {
+			data, err := Rdb.Get(Ctx, iter.Val()).Result()
+			if err == redis.Nil {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("error getting session from Redis: %w", err)
+			}
+			sessions = append(sessions, data)
+		}
+		if err := iter.Err(); err != nil {
+			return nil, fmt.Errorf("error scanning sessions in Redis: %w", err)
+		}
+		return sessions, nil
+	}
+
+	// Sessions that were not refreshed in a while have expired upstream anyway
+	if err := Db.Where("updated_at < ?", time.Now().Add(-SessionStoreTTL)).Delete(&dbmodel.Session{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	var records []dbmodel.Session
+	if err := Db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load sessions: %w", err)
+	}
+	for _, record := range records {
+		sessions = append(sessions, record.Data)
+	}
+	return sessions, nil
+}
+
+func encodeStoredSession(stored storedSession) (string, error) {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling session to JSON: %w", err)
+	}
+
+	if config.AppConfig.Encryption.Enabled {
+		encrypted, err := crypto.Encrypt(string(data))
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt session: %w", err)
+		}
+		return encrypted, nil
+	}
+	return string(data), nil
+}
+
+func decodeStoredSession(data string) (storedSession, error) {
+	if config.AppConfig.Encryption.Enabled {
+		decrypted, err := crypto.Decrypt(data)
+		if err != nil {
+			return storedSession{}, fmt.Errorf("failed to decrypt session: %w", err)
+		}
+		data = decrypted
+	}
+
+	var stored storedSession
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return storedSession{}, fmt.Errorf("error unmarshalling session JSON: %w", err)
+	}
+	return stored, nil
+}
@@ -0,0 +1,232 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+	"github.com/robfig/cron/v3"
+)
+
+const sessionShardCount = 32
+
+var ErrSessionExpired = errors.New("session expired")
+
+// ClientData is a logged in edupage session, stored in the session registry.
+type ClientData struct {
+	CrJobId     cron.EntryID
+	Client      *edupage.EdupageClient
+	DataStorage *DataStorageConfig
+
+	CreatedAt time.Time
+	lastUsed  atomic.Int64
+	lastPing  atomic.Int64
+}
+
+// NewClientData creates a new session for the client, created and last used now.
+func NewClientData(client *edupage.EdupageClient, dataStorage *DataStorageConfig) *ClientData {
+	session := &ClientData{
+		Client:      client,
+		DataStorage: dataStorage,
+		CreatedAt:   time.Now(),
+	}
+	session.Touch()
+	return session
+}
+
+// Touch marks the session as used now.
+func (d *ClientData) Touch() {
+	d.lastUsed.Store(time.Now().UnixNano())
+}
+
+// LastUsed returns the last time the session was used by a request.
+func (d *ClientData) LastUsed() time.Time {
+	return unixNanoTime(d.lastUsed.Load())
+}
+
+// MarkPinged marks the last successful ping of the upstream session.
+func (d *ClientData) MarkPinged() {
+	d.lastPing.Store(time.Now().UnixNano())
+}
+
+// LastPing returns the time of the last successful ping, zero if the session was never pinged.
+func (d *ClientData) LastPing() time.Time {
+	return unixNanoTime(d.lastPing.Load())
+}
+
+func unixNanoTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+type sessionShard struct {
+	mu       sync.RWMutex
+	sessions map[string]*ClientData
+}
+
+// SessionRegistry stores the logged in sessions and is safe for concurrent use.
+// The sessions are split into shards by their key, so requests of different
+// users rarely wait for each other.
+type SessionRegistry struct {
+	shards [sessionShardCount]sessionShard
+}
+
+// NewSessionRegistry creates an empty session registry.
+func NewSessionRegistry() *SessionRegistry {
+	r := &SessionRegistry{}
+	for i := range r.shards {
+		r.shards[i].sessions = make(map[string]*ClientData)
+	}
+	return r
+}
+
+// SessionKey returns the registry key of the user on the server.
+func SessionKey(server, username string) string {
+	return server + username
+}
+
+func (r *SessionRegistry) shard(key string) *sessionShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &r.shards[h.Sum32()%sessionShardCount]
+}
+
+// Get looks up the session stored under the key.
+func (r *SessionRegistry) Get(key string) (*ClientData, bool) {
+	s := r.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	session, ok := s.sessions[key]
+	return session, ok
+}
+
+// Set stores the session under the key, replacing and returning the previous session.
+// The ping job of the replaced session is stopped.
+func (r *SessionRegistry) Set(key string, session *ClientData) *ClientData {
+	s := r.shard(key)
+	s.mu.Lock()
+	previous := s.sessions[key]
+	s.sessions[key] = session
+	s.mu.Unlock()
+
+	if previous != nil && previous != session {
+		stopPing(previous)
+	}
+	return previous
+}
+
+// Evict removes the session stored under the key and stops its ping job.
+func (r *SessionRegistry) Evict(key string) (*ClientData, bool) {
+	s := r.shard(key)
+	s.mu.Lock()
+	session, ok := s.sessions[key]
+	delete(s.sessions, key)
+	s.mu.Unlock()
+
+	if ok {
+		stopPing(session)
+	}
+	return session, ok
+}
+
+// EvictIf removes the session stored under the key, but only if it is still the specified session.
+// This keeps stale jobs from evicting a session that was created by a newer login.
+func (r *SessionRegistry) EvictIf(key string, session *ClientData) bool {
+	s := r.shard(key)
+	s.mu.Lock()
+	current, ok := s.sessions[key]
+	if !ok || current != session {
+		s.mu.Unlock()
+		return false
+	}
+	delete(s.sessions, key)
+	s.mu.Unlock()
+
+	stopPing(session)
+	return true
+}
+
+// Range calls fn for every stored session, until fn returns false.
+// The sessions are iterated over a snapshot, so fn may modify the registry.
+func (r *SessionRegistry) Range(fn func(key string, session *ClientData) bool) {
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.RLock()
+		snapshot := make(map[string]*ClientData, len(s.sessions))
+		for k, v := range s.sessions {
+			snapshot[k] = v
+		}
+		s.mu.RUnlock()
+
+		for k, v := range snapshot {
+			if !fn(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of stored sessions.
+func (r *SessionRegistry) Len() int {
+	n := 0
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.RLock()
+		n += len(s.sessions)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// SchedulePing pings the upstream session every 10 minutes to keep it alive,
+// the session is evicted from the registry once a ping fails. Every successful ping refreshes the persisted copy.
+// It must be called before the session is stored with Set, so the job is stopped when the session is replaced or evicted.
+func (r *SessionRegistry) SchedulePing(key string, session *ClientData) error {
+	// The cron is kinda broken when run from the go test command
+	if Cr == nil || os.Getenv("CI") != "" {
+		return nil
+	}
+
+	jobId, err := Cr.AddFunc("@every 10m", func() {
+		ctx, cancel := context.WithTimeout(Ctx, RefreshTimeout)
+		defer cancel()
+
+		success, err := session.Client.PingSessionContext(ctx)
+		if err == nil && !success {
+			err = ErrSessionExpired
+		}
+		if err != nil {
+			LogUserSession("session ping", session.Client.Credentials.Username, session.Client.Credentials.Server, err)
+			if r.EvictIf(key, session) {
+				DeletePersistedSession(key)
+			}
+			return
+		}
+		session.MarkPinged()
+
+		// The persisted copy expires unless it is refreshed, the session may stay alive for longer
+		if current, ok := r.Get(key); ok && current == session {
+			if err := PersistSession(key, session); err != nil {
+				LogUserSession("session persist", session.Client.Credentials.Username, session.Client.Credentials.Server, err)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	session.CrJobId = jobId
+	return nil
+}
+
+func stopPing(session *ClientData) {
+	if Cr != nil && session.CrJobId != 0 {
+		Cr.Remove(session.CrJobId)
+	}
+}
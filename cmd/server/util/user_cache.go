@@ -0,0 +1,272 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/config"
+	"github.com/DislikesSchool/EduPage2-server/edupage"
+)
+
+// DefaultStaleAfter is used when the age after which the cached data is refreshed isn't configured.
+const DefaultStaleAfter = time.Minute
+
+// CacheStatus tells where the data of a response came from, it is sent in the X-Cache header.
+type CacheStatus string
+
+const (
+	// CacheHit is data from the cache which doesn't need to be refreshed yet.
+	CacheHit CacheStatus = "HIT"
+	// CacheStale is data from the cache which is refreshed after the response has been sent.
+	CacheStale CacheStatus = "STALE"
+	// CacheMiss is data which has just been retrieved from edupage.
+	CacheMiss CacheStatus = "MISS"
+)
+
+var errFetchPanicked = errors.New("the retrieval of the cached data panicked")
+
+// CacheStore keeps the entries of the user caches, see RedisCacheStore and MemoryCacheStore.
+type CacheStore interface {
+	// Read decodes the entry into the target, false if it isn't cached or has expired.
+	Read(key string, target any) (bool, error)
+	Write(key string, data any, ttl time.Duration) error
+}
+
+// RedisCacheStore keeps the entries in redis, so all instances share them.
+type RedisCacheStore struct{}
+
+func (RedisCacheStore) Read(key string, target any) (bool, error) {
+	return ReadCache(key, target)
+}
+
+func (RedisCacheStore) Write(key string, data any, ttl time.Duration) error {
+	return CacheData(key, data, ttl)
+}
+
+// MemoryCacheStore keeps the entries encoded in memory, it is safe for concurrent use.
+type MemoryCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+// NewMemoryCacheStore creates an empty memory store.
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{entries: make(map[string]memoryCacheEntry)}
+}
+
+func (s *MemoryCacheStore) Read(key string, target any) (bool, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	s.mu.Unlock()
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		return false, nil
+	}
+	if err := json.Unmarshal(entry.data, target); err != nil {
+		return false, fmt.Errorf("error unmarshalling cached data: %w", err)
+	}
+	return true, nil
+}
+
+// Write keeps the entry for the ttl, forever when it is zero as in redis.
+func (s *MemoryCacheStore) Write(key string, data any, ttl time.Duration) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error marshalling data to JSON: %w", err)
+	}
+
+	entry := memoryCacheEntry{data: encoded}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	s.entries[key] = entry
+	return nil
+}
+
+// DeletePrefix removes the entries whose keys start with the prefix.
+func (s *MemoryCacheStore) DeletePrefix(prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// prune removes the expired entries, the lock must be held.
+func (s *MemoryCacheStore) prune() {
+	now := time.Now()
+	for key, entry := range s.entries {
+		if !entry.expires.IsZero() && now.After(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// Cached is data read from a UserCache.
+type Cached[T any] struct {
+	Data   T
+	Status CacheStatus
+	// Age is the time since the data was retrieved from edupage
+	Age time.Duration
+}
+
+// cacheEntry is the data stored in Redis, with the time it was retrieved from edupage.
+type cacheEntry[T any] struct {
+	Data     T         `json:"data"`
+	StoredAt time.Time `json:"storedAt"`
+}
+
+// UserCache caches the data of the users in UserCacheStore, it is safe for concurrent use.
+// Cached data older than StaleAfter is returned at once and refreshed in the background (stale-while-revalidate).
+// Concurrent retrievals of the same data are shared, so edupage is asked only once.
+type UserCache[T any] struct {
+	// Name prefixes the cache keys and selects the TTL, see TTLFromType
+	Name string
+}
+
+// NewUserCache creates the cache of the type of data.
+func NewUserCache[T any](name string) *UserCache[T] {
+	return &UserCache[T]{Name: name}
+}
+
+// Get returns the data of the user of the client, the params tell apart the variants of the data, e.g. the school year.
+// The child is the child of a parent account the data is retrieved for in the background.
+// Without a store, the data is always retrieved by fetch.
+func (u *UserCache[T]) Get(ctx context.Context, client *edupage.EdupageClient, child string, fetch func(ctx context.Context) (T, error), params ...string) (Cached[T], error) {
+	store := UserCacheStore
+	if store == nil {
+		data, err := shareFetch(ctx, u.flightKey(client, child, params), fetch)
+		return Cached[T]{Data: data, Status: CacheMiss}, err
+	}
+
+	key, err := CacheKeyFromEPClient(client, strings.Join(append([]string{u.Name}, params...), ":"))
+	if err != nil {
+		return Cached[T]{}, err
+	}
+
+	var entry cacheEntry[T]
+	read, err := store.Read(key, &entry)
+	if err != nil {
+		return Cached[T]{}, err
+	}
+	// The entries cached before the time was stored are retrieved again
+	if read && !entry.StoredAt.IsZero() {
+		age := time.Since(entry.StoredAt)
+		if age < StaleAfter() {
+			return Cached[T]{Data: entry.Data, Status: CacheHit, Age: age}, nil
+		}
+		u.refresh(store, client, child, key, fetch)
+		return Cached[T]{Data: entry.Data, Status: CacheStale, Age: age}, nil
+	}
+
+	data, err := shareFetch(ctx, key, func(ctx context.Context) (T, error) {
+		data, err := fetch(ctx)
+		if err != nil {
+			return data, err
+		}
+		_ = u.store(store, key, data)
+		return data, nil
+	})
+	return Cached[T]{Data: data, Status: CacheMiss}, err
+}
+
+// refresh retrieves the data again after the response has already been sent, unless it is already being refreshed.
+func (u *UserCache[T]) refresh(store CacheStore, client *edupage.EdupageClient, child, key string, fetch func(ctx context.Context) (T, error)) {
+	if _, running := refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	go func() {
+		// The key is released even when the refresh doesn't run, e.g. when the child can't be selected
+		defer refreshing.Delete(key)
+
+		_ = RefreshForChild(client, child, func(ctx context.Context) {
+			data, err := fetch(ctx)
+			if err != nil {
+				return
+			}
+			_ = u.store(store, key, data)
+		})
+	}()
+}
+
+func (u *UserCache[T]) store(store CacheStore, key string, data T) error {
+	return store.Write(key, cacheEntry[T]{Data: data, StoredAt: time.Now()}, TTLFromType(u.Name))
+}
+
+// flightKey identifies the data when it isn't cached, the client is unique for every session.
+func (u *UserCache[T]) flightKey(client *edupage.EdupageClient, child string, params []string) string {
+	return strings.Join(append([]string{client.Credentials.Server, client.Credentials.Username, child, u.Name}, params...), ":")
+}
+
+// StaleAfter returns the configured age after which the cached data is refreshed.
+func StaleAfter() time.Duration {
+	if age := config.AppConfig.Redis.StaleAfter; age > 0 {
+		return time.Duration(age) * time.Second
+	}
+	return DefaultStaleAfter
+}
+
+// refreshing are the keys of the data being refreshed in the background.
+var refreshing sync.Map
+
+// fetches are the retrievals of data in progress by key, so the concurrent requests for the same data share them.
+var fetches = flightGroup{calls: make(map[string]*flightCall)}
+
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+// do runs fn, or waits for the call of fn with the same key which is already running and returns its result.
+func (g *flightGroup) do(key string, fn func() (any, error)) (any, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-call.done
+		return call.value, call.err
+	}
+	call := &flightCall{done: make(chan struct{}), err: errFetchPanicked}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.value, call.err = fn()
+	return call.value, call.err
+}
+
+// shareFetch runs fetch once for all concurrent requests of the key. The retrieval isn't cancelled when the request
+// which started it is, the others still wait for it, but it is limited by RefreshTimeout.
+func shareFetch[T any](ctx context.Context, key string, fetch func(ctx context.Context) (T, error)) (T, error) {
+	value, err := fetches.do(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), RefreshTimeout)
+		defer cancel()
+		return fetch(ctx)
+	})
+	data, _ := value.(T)
+	return data, err
+}
@@ -2,7 +2,6 @@ package util
 
 import (
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
@@ -65,6 +64,10 @@ func LoadStoredUsers() {
 		if user.LastOnline.Before(time.Now().AddDate(0, 0, -7)) {
 			continue
 		}
+		// Skip users whose session was already restored by RestoreSessions
+		if _, ok := Clients.Get(SessionKey(user.Server, user.Username)); ok {
+			continue
+		}
 		jobs <- user
 		activeUserCount++
 	}
@@ -111,7 +114,7 @@ func loadAndAuthenticateUser(user *dbmodel.User) error {
 	}
 
 	// Try to authenticate with Edupage
-	cred, err := edupage.Login(user.Username, password, user.Server)
+	cred, err := edupage.LoginWithOptions(user.Username, password, user.Server, EdupageOptions)
 	if err != nil {
 		return fmt.Errorf("failed to authenticate: %w", err)
 	}
@@ -128,30 +131,21 @@ func loadAndAuthenticateUser(user *dbmodel.User) error {
 		Credentials: true,
 		Messages:    user.StoreMessages,
 		Timeline:    user.StoreTimeline,
+		Grades:      user.StoreGrades,
 	}
 
-	// Add the client to the clients map
-	clientKey := user.Server + user.Username
-	Clients[clientKey] = &ClientData{
-		Client:      client,
-		DataStorage: dataStorage,
-	}
+	// Add the client to the session registry
+	clientKey := SessionKey(user.Server, user.Username)
+	session := NewClientData(client, dataStorage)
 
 	// Set up periodic session pinging
-	if Cr != nil && os.Getenv("CI") == "" {
-		jobId, err := Cr.AddFunc("@every 10m", func() {
-			fmt.Println("Pinging", user.Username, user.Server)
-			success, err := client.PingSession()
-			if err != nil || !success {
-				fmt.Println("Session ping failed for", user.Username)
-				Cr.Remove(Clients[clientKey].CrJobId)
-				delete(Clients, clientKey)
-			}
-		})
-		if err != nil {
-			return fmt.Errorf("failed to add cron job: %w", err)
-		}
-		Clients[clientKey].CrJobId = jobId
+	if err := Clients.SchedulePing(clientKey, session); err != nil {
+		return fmt.Errorf("failed to add cron job: %w", err)
+	}
+	Clients.Set(clientKey, session)
+
+	if err := PersistSession(clientKey, session); err != nil {
+		LogUserSession("session persist", user.Username, user.Server, err)
 	}
 
 	return nil
@@ -248,8 +242,7 @@ func LoadMessagesAndUpdateMeilisearch(user *dbmodel.User) {
 	ownerID := fmt.Sprintf("%s@%s", user.Username, user.Server)
 
 	// Get client for this user
-	clientKey := user.Server + user.Username
-	clientData, exists := Clients[clientKey]
+	clientData, exists := Clients.Get(SessionKey(user.Server, user.Username))
 	if !exists {
 		InfoLogger.Printf("Cannot load messages for %s: client not found", ownerID)
 		return
@@ -1,9 +1,9 @@
 package util
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/DislikesSchool/EduPage2-server/config"
@@ -11,11 +11,32 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// RefreshTimeout limits the cache refreshes which run after the response has already been sent,
+// and the retrievals of uncached data shared by concurrent requests.
+const RefreshTimeout = 30 * time.Second
+
+// DefaultOccupancyTTL is used when neither the occupancy nor the timetable TTL is configured.
+const DefaultOccupancyTTL = 6 * time.Hour
+
+// DefaultSchoolTimeZone is used when the time zone of the schools isn't configured.
+const DefaultSchoolTimeZone = "Europe/Prague"
+
 type DataStorageConfig struct {
 	Enabled     bool `json:"enabled"`
 	Credentials bool `json:"credentials"`
 	Messages    bool `json:"messages"`
 	Timeline    bool `json:"timeline"`
+	// Grades keeps the history of the grades, so the changes can be listed
+	Grades bool `json:"grades"`
+}
+
+// SchoolLocation returns the configured time zone of the schools, the times of edupage are local times in it.
+func SchoolLocation() (*time.Location, error) {
+	name := config.AppConfig.Schools.TimeZone
+	if name == "" {
+		name = DefaultSchoolTimeZone
+	}
+	return time.LoadLocation(name)
 }
 
 func TTLFromType(ttlType string) time.Duration {
@@ -28,6 +49,14 @@ func TTLFromType(ttlType string) time.Duration {
 		return time.Duration(config.AppConfig.Redis.TTL.Results) * time.Second
 	case "dbi":
 		return time.Duration(config.AppConfig.Redis.TTL.DBI) * time.Second
+	case "occupancy":
+		if ttl := config.AppConfig.Redis.TTL.Occupancy; ttl > 0 {
+			return time.Duration(ttl) * time.Second
+		}
+		if ttl := TTLFromType("timetable"); ttl > 0 {
+			return ttl
+		}
+		return DefaultOccupancyTTL
 	default:
 		return 0
 	}
@@ -38,7 +67,39 @@ func CacheKeyFromEPClient(client *edupage.EdupageClient, key string) (string, er
 	if err != nil {
 		return "", fmt.Errorf("error getting user: %w", err)
 	}
-	return fmt.Sprintf("%s:%s:%s", strings.Split(client.Credentials.Server, ".")[0], user.UserRow.UserID, key), nil
+	userID := user.UserRow.UserID
+	// Parents see the data of the active child
+	if client.IsParent() {
+		child, err := client.GetStudentID()
+		if err != nil {
+			return "", fmt.Errorf("error getting active child: %w", err)
+		}
+		userID += ":" + child
+	}
+	return fmt.Sprintf("%s:%s:%s", SchoolName(client), userID, key), nil
+}
+
+// SchoolCacheKey returns the key of the data shared by all users of the school of the client, see SchoolCache.
+func SchoolCacheKey(client *edupage.EdupageClient, key string) string {
+	return fmt.Sprintf("%s:school:%s", SchoolName(client), key)
+}
+
+// RefreshInBackground runs the cache refresh after the response has already been sent.
+// For parent accounts, the refresh runs for the child the request was made for.
+func RefreshInBackground(client *edupage.EdupageClient, child string, refresh func(ctx context.Context)) {
+	go RefreshForChild(client, child, refresh)
+}
+
+// RefreshForChild runs the cache refresh for the child of a parent account, limited by RefreshTimeout.
+// The refresh doesn't run when the child can't be selected, the error is returned.
+func RefreshForChild(client *edupage.EdupageClient, child string, refresh func(ctx context.Context)) error {
+	ctx, cancel := context.WithTimeout(Ctx, RefreshTimeout)
+	defer cancel()
+
+	return client.WithChild(ctx, child, func() error {
+		refresh(ctx)
+		return nil
+	})
 }
 
 func CacheData(key string, data interface{}, ttl time.Duration) error {
@@ -13,6 +13,8 @@ type Config struct {
 	Schools struct {
 		Whitelist   []string `yaml:"whitelist"`
 		IsBlacklist bool     `yaml:"blacklist" mapstructure:"blacklist"`
+		// TimeZone is the time zone of the schools, the times of edupage are local times
+		TimeZone string `yaml:"time_zone" mapstructure:"time_zone"`
 	} `yaml:"schools"`
 	Server struct {
 		Host string `yaml:"host"`
@@ -30,7 +32,11 @@ type Config struct {
 			Timetable int `yaml:"timetable"`
 			Results   int `yaml:"results"`
 			DBI       int `yaml:"dbi"`
+			// Occupancy is shared by all users of a school, the timetable TTL is used when unset
+			Occupancy int `yaml:"occupancy"`
 		} `yaml:"ttl"`
+		// StaleAfter is the age after which the cached data is refreshed in the background
+		StaleAfter int `mapstructure:"stale_after" yaml:"stale_after"`
 	} `yaml:"redis"`
 	Database struct {
 		Enabled bool   `yaml:"enabled"`
@@ -50,8 +56,34 @@ type Config struct {
 			PrimaryKey string `mapstructure:"primary_key" yaml:"primary_key"`
 		} `yaml:"messages"`
 	} `yaml:"meilisearch"`
+	Attachments struct {
+		MaxSize      int64    `mapstructure:"max_size" yaml:"max_size"`
+		MaxCount     int      `mapstructure:"max_count" yaml:"max_count"`
+		AllowedTypes []string `mapstructure:"allowed_types" yaml:"allowed_types"`
+		Cache        struct {
+			Type    string `yaml:"type"`
+			Dir     string `yaml:"dir"`
+			MaxSize int64  `mapstructure:"max_size" yaml:"max_size"`
+			TTL     int    `yaml:"ttl"`
+		} `yaml:"cache"`
+	} `yaml:"attachments"`
+	SchoolCache struct {
+		DBI    int `yaml:"dbi"`
+		Memory int `yaml:"memory"`
+	} `mapstructure:"school_cache" yaml:"school_cache"`
+	Calendar struct {
+		DaysBefore int `mapstructure:"days_before" yaml:"days_before"`
+		DaysAfter  int `mapstructure:"days_after" yaml:"days_after"`
+	} `yaml:"calendar"`
 	JWT struct {
-		Secret string `yaml:"secret"`
+		Secret           string `yaml:"secret"`
+		Algorithm        string `yaml:"algorithm"`
+		KeysDir          string `mapstructure:"keys_dir" yaml:"keys_dir"`
+		RotationInterval int    `mapstructure:"rotation_interval" yaml:"rotation_interval"`
+		AccessTTL        int    `mapstructure:"access_ttl" yaml:"access_ttl"`
+		RefreshTTL       int    `mapstructure:"refresh_ttl" yaml:"refresh_ttl"`
+		// AcceptLegacyUntil is the time (RFC 3339) until which HS256 tokens are accepted with EdDSA or RS256
+		AcceptLegacyUntil string `mapstructure:"accept_legacy_until" yaml:"accept_legacy_until"`
 	} `yaml:"jwt"`
 }
 
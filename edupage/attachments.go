@@ -0,0 +1,164 @@
+package edupage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrorInvalidAttachmentURL is returned for attachment urls which don't point to edupage.
+var ErrorInvalidAttachmentURL = errors.New("invalid attachment url")
+
+// attachmentHeaders are forwarded to edupage when downloading attachments, so partial and conditional requests work.
+var attachmentHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+// Attachment is a file uploaded to edupage, it can be attached to messages.
+type Attachment struct {
+	CloudID   string `json:"cloudid"`
+	Extension string `json:"extension"`
+	// Type is the MIME type of the file
+	Type string `json:"type"`
+	// Path is the url of the file, relative to the edupage server
+	Path string `json:"file"`
+	Name string `json:"name"`
+}
+
+// UploadAttachment uploads the file to edupage, the returned attachment can be sent with messages.
+// Returns *RefusedError if edupage refuses the file.
+func (client *EdupageClient) UploadAttachment(name string, content io.Reader) (Attachment, error) {
+	return client.UploadAttachmentContext(context.Background(), name, content)
+}
+
+// UploadAttachmentContext works like UploadAttachment, the request is cancelled together with the context.
+func (client *EdupageClient) UploadAttachmentContext(ctx context.Context, name string, content io.Reader) (Attachment, error) {
+	if client.Credentials.httpClient == nil {
+		return Attachment{}, errors.New("invalid credentials")
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("att", name)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to create form file: %s", err)
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return Attachment{}, fmt.Errorf("failed to read attachment: %s", err)
+	}
+	if err := writer.Close(); err != nil {
+		return Attachment{}, fmt.Errorf("failed to create form: %s", err)
+	}
+
+	resp, err := client.Credentials.post(ctx, "/timeline/?akcia=uploadAtt", writer.FormDataContentType(), &body)
+	if err != nil {
+		return Attachment{}, requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Attachment{}, fmt.Errorf("server returned code: %d", resp.StatusCode)
+	}
+
+	response, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to read response body: %s", err)
+	}
+
+	var res struct {
+		Status string     `json:"status"`
+		Error  string     `json:"error"`
+		Data   Attachment `json:"data"`
+	}
+	if err := json.Unmarshal(response, &res); err != nil {
+		return Attachment{}, fmt.Errorf("failed to parse response body: %s", err)
+	}
+
+	switch {
+	case res.Status == "notlogged":
+		return Attachment{}, ErrorUnauthorized
+	case res.Status != "ok":
+		return Attachment{}, &RefusedError{Action: "upload attachment", Status: res.Status, Reason: res.Error}
+	case res.Data.Path == "":
+		return Attachment{}, &RefusedError{Action: "upload attachment", Status: res.Status, Reason: "no file in the response"}
+	}
+	return res.Data, nil
+}
+
+// encodeAttachments encodes the attachments like edupage expects them in messages, mapping the paths to the file names.
+func encodeAttachments(attachments []Attachment) string {
+	files := make(map[string]string, len(attachments))
+	for _, attachment := range attachments {
+		files[attachment.Path] = attachment.Name
+	}
+	encoded, _ := json.Marshal(files)
+	return string(encoded)
+}
+
+// OpenAttachment downloads the attachment using the user's session, e.g. the urls returned by GetAttachments or FetchHomeworkAttachments.
+// The url is relative to the edupage server, absolute urls are only allowed on the edupage.org hosts.
+// The Range and conditional headers are forwarded, so the response may be partial (206) or not modified (304).
+// The caller must close the body of the response.
+// Returns ErrorInvalidAttachmentURL if the url doesn't point to edupage, ErrorNotFound if the attachment doesn't exist.
+func (client *EdupageClient) OpenAttachment(link string, header http.Header) (*http.Response, error) {
+	return client.OpenAttachmentContext(context.Background(), link, header)
+}
+
+// OpenAttachmentContext works like OpenAttachment, the request is cancelled together with the context.
+func (client *EdupageClient) OpenAttachmentContext(ctx context.Context, link string, header http.Header) (*http.Response, error) {
+	req, err := client.Credentials.attachmentRequest(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range attachmentHeaders {
+		if value := header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := client.Credentials.do(req)
+	if err != nil {
+		// Edupage redirects to the login page when the session has expired
+		return nil, requestError(ctx, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified, http.StatusRequestedRangeNotSatisfiable:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrorNotFound
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned code: %d", resp.StatusCode)
+	}
+}
+
+// attachmentRequest creates the request for the attachment url, refusing the urls outside of edupage.
+func (c *Credentials) attachmentRequest(ctx context.Context, link string) (*http.Request, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrorInvalidAttachmentURL, err)
+	}
+
+	if !u.IsAbs() && u.Host == "" {
+		if !strings.HasPrefix(u.Path, "/") {
+			return nil, ErrorInvalidAttachmentURL
+		}
+		return c.newRequest(ctx, http.MethodGet, u.RequestURI(), nil)
+	}
+
+	host := u.Hostname()
+	if u.Scheme != "https" || u.User != nil || u.Port() != "" || (host != "edupage.org" && !strings.HasSuffix(host, ".edupage.org")) {
+		return nil, ErrorInvalidAttachmentURL
+	}
+	if host == c.Server {
+		return c.newRequest(ctx, http.MethodGet, u.RequestURI(), nil)
+	}
+	return http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+}
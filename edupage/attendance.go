@@ -0,0 +1,129 @@
+package edupage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+// The RPCs of the attendance of the student and of the substitution board of the school.
+const (
+	attendancePath    = "/dashboard/server/attendance.js?__func=getStudentAttendance"
+	substitutionsPath = "/substitution/server/viewer.js?__func=getSubstViewerData"
+)
+
+// GetAttendance retrieves the absences and late arrivals of the student in the specified interval from edupage.
+// Return ErrorUnauthorized if an authorization error occcurs.
+func (client *EdupageClient) GetAttendance(from, to time.Time) (model.Attendance, error) {
+	return client.GetAttendanceContext(context.Background(), from, to)
+}
+
+// GetAttendanceContext works like GetAttendance, the request is cancelled together with the context.
+func (client *EdupageClient) GetAttendanceContext(ctx context.Context, from, to time.Time) (model.Attendance, error) {
+	id, err := client.GetStudentID()
+	if err != nil {
+		return model.Attendance{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	body, err := client.rpc(ctx, attendancePath, map[string]interface{}{
+		"studentid": id,
+		"datefrom":  from.Format(model.TimeFormatYearMonthDay),
+		"dateto":    to.Format(model.TimeFormatYearMonthDay),
+	})
+	if err != nil {
+		return model.Attendance{}, err
+	}
+
+	attendance, err := model.ParseAttendance(body)
+	if err != nil {
+		return model.Attendance{}, fmt.Errorf("failed to parse attendance json: %w", err)
+	}
+	return attendance, nil
+}
+
+// GetSubstitutions retrieves the substitutions of all classes of the school in the specified interval from edupage.
+// Use Timetable#Changes to get the changes of the student's lessons.
+// Return ErrorUnauthorized if an authorization error occcurs.
+func (client *EdupageClient) GetSubstitutions(from, to time.Time) ([]model.Substitution, error) {
+	return client.GetSubstitutionsContext(context.Background(), from, to)
+}
+
+// GetSubstitutionsContext works like GetSubstitutions, the request is cancelled together with the context.
+func (client *EdupageClient) GetSubstitutionsContext(ctx context.Context, from, to time.Time) ([]model.Substitution, error) {
+	body, err := client.rpc(ctx, substitutionsPath, map[string]interface{}{
+		"datefrom": from.Format(model.TimeFormatYearMonthDay),
+		"dateto":   to.Format(model.TimeFormatYearMonthDay),
+		"mode":     "classes",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	substitutions, err := model.ParseSubstitutions(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse substitutions json: %w", err)
+	}
+	return substitutions, nil
+}
+
+// GetTimetableChanges retrieves the changes of the student's lessons in the specified interval,
+// the substitutions compared with the timetable.
+// Return ErrorUnauthorized if an authorization error occcurs.
+func (client *EdupageClient) GetTimetableChanges(from, to time.Time) ([]model.TimetableChange, error) {
+	return client.GetTimetableChangesContext(context.Background(), from, to)
+}
+
+// GetTimetableChangesContext works like GetTimetableChanges, the requests are cancelled together with the context.
+func (client *EdupageClient) GetTimetableChangesContext(ctx context.Context, from, to time.Time) ([]model.TimetableChange, error) {
+	classID, err := client.GetClassID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the class: %w", err)
+	}
+
+	timetable, err := client.GetTimetableContext(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	substitutions, err := client.GetSubstitutionsContext(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return timetable.Changes(substitutions, classID), nil
+}
+
+// rpc calls the server function with the arguments, like the timetable does, and returns the response body.
+func (client *EdupageClient) rpc(ctx context.Context, path string, args map[string]interface{}) ([]byte, error) {
+	if client.Credentials.httpClient == nil {
+		return nil, errors.New("invalid credentials")
+	}
+
+	request, err := json.Marshal(map[string]interface{}{
+		"__args": []interface{}{nil, args},
+		"__gsh":  client.gsechash,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	response, err := client.Credentials.post(ctx, path, "application/json", bytes.NewBuffer(request))
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("server returned code: %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return body, nil
+}
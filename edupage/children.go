@@ -0,0 +1,208 @@
+package edupage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// parentUserPrefix is the prefix of the user IDs of parents, e.g. Rodic501.
+const parentUserPrefix = "Rodic"
+
+var ErrorNotParent = errors.New("not a parent account")
+
+// Child is a student whose data a parent can access.
+type Child struct {
+	ID        string `json:"id"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+	ClassID   string `json:"classid"`
+}
+
+// IsParent reports whether the client is logged in to a parent account.
+// Returns false if the user object hasn't been initialized.
+func (client *EdupageClient) IsParent() bool {
+	return client.user != nil && strings.HasPrefix(client.user.UserRow.UserID, parentUserPrefix)
+}
+
+// GetChildren returns the children of a parent account, ordered by their ID.
+// Returns ErrorNotParent if the client is not logged in to a parent account.
+// Returns ErrorUnitialized if the user object hasn't been initialized.
+func (client *EdupageClient) GetChildren() ([]Child, error) {
+	if client.user == nil {
+		return nil, ErrorUnitialized
+	}
+	if !client.IsParent() {
+		return nil, ErrorNotParent
+	}
+
+	parentID := strings.TrimPrefix(client.user.UserRow.UserID, parentUserPrefix)
+	children := []Child{}
+	for id, student := range client.user.DBI.Students {
+		if student.Parent1ID != parentID && student.Parent2ID != parentID && student.Parent3ID != parentID {
+			continue
+		}
+		children = append(children, Child{
+			ID:        id,
+			Firstname: student.Firstname,
+			Lastname:  student.Lastname,
+			ClassID:   student.ClassroomID,
+		})
+	}
+
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].ID < children[j].ID
+	})
+	return children, nil
+}
+
+// ActiveChild returns the ID of the child the data is retrieved for, an empty string for students.
+// Returns ErrorUnitialized if the user object hasn't been initialized.
+func (client *EdupageClient) ActiveChild() (string, error) {
+	if client.user == nil {
+		return "", ErrorUnitialized
+	}
+	if !client.IsParent() {
+		return "", nil
+	}
+
+	client.childMu.Lock()
+	defer client.childMu.Unlock()
+	return client.activeChild()
+}
+
+// SwitchChild makes edupage return the data of the child, e.g. its timeline, results, timetable and canteen.
+// The child stays active for the whole session, until another child is selected.
+// Returns ErrorNotParent if the client is not logged in to a parent account.
+// Returns ErrorNotFound if the parent has no child with the ID.
+func (client *EdupageClient) SwitchChild(id string) error {
+	return client.SwitchChildContext(context.Background(), id)
+}
+
+// SwitchChildContext works like SwitchChild, the request is cancelled together with the context.
+func (client *EdupageClient) SwitchChildContext(ctx context.Context, id string) error {
+	client.childUse.Lock()
+	defer client.childUse.Unlock()
+	return client.switchChild(ctx, id)
+}
+
+// WithChild runs fn while the child is active, no other child can be selected until fn returns.
+// The calls for the same child run concurrently, a call for another child waits for them to return.
+// An empty id runs fn for the currently active child.
+// Students can only use an empty id, otherwise ErrorNotParent is returned.
+func (client *EdupageClient) WithChild(ctx context.Context, id string, fn func() error) error {
+	if !client.IsParent() {
+		if id != "" {
+			return ErrorNotParent
+		}
+		return fn()
+	}
+
+	for {
+		client.childUse.RLock()
+		client.childMu.Lock()
+		selected := id == "" || id == client.child
+		client.childMu.Unlock()
+		if selected {
+			defer client.childUse.RUnlock()
+			return fn()
+		}
+		client.childUse.RUnlock()
+
+		client.childUse.Lock()
+		err := client.switchChild(ctx, id)
+		client.childUse.Unlock()
+		if err != nil {
+			return err
+		}
+		// Another child may have been selected before the switched one is used, it is selected again
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// activeChild returns the selected child, the one edupage selects by default when none was switched to.
+// childMu must be held.
+func (client *EdupageClient) activeChild() (string, error) {
+	if client.child != "" {
+		return client.child, nil
+	}
+	if client.user.UserRow.StudentID != "" {
+		return client.user.UserRow.StudentID, nil
+	}
+
+	children, err := client.GetChildren()
+	if err != nil {
+		return "", err
+	}
+	if len(children) == 0 {
+		return "", ErrorNotFound
+	}
+	return children[0].ID, nil
+}
+
+// switchChild selects the child on edupage, childUse must be held exclusively.
+func (client *EdupageClient) switchChild(ctx context.Context, id string) error {
+	children, err := client.GetChildren()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, child := range children {
+		if child.ID == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: child %s", ErrorNotFound, id)
+	}
+
+	client.childMu.Lock()
+	selected := client.child == id
+	client.childMu.Unlock()
+	if selected {
+		return nil
+	}
+
+	response, err := client.Credentials.get(ctx, "/login/switchchild?studid="+url.QueryEscape(id))
+	if err != nil {
+		return requestError(ctx, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return fmt.Errorf("server returned code: %d", response.StatusCode)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %s", err)
+	}
+	if strings.TrimSpace(string(body)) != "OK" {
+		return fmt.Errorf("failed to switch child: %s", body)
+	}
+
+	// The user model contains the data of the active child, e.g. its class and dayplan.
+	// Until it is retrieved, no child is recorded as selected, so the next switch is made again.
+	client.childMu.Lock()
+	client.child = ""
+	client.childMu.Unlock()
+
+	user, err := client.fetchUserModel(ctx)
+	if err != nil {
+		return err
+	}
+
+	client.childMu.Lock()
+	client.child = id
+	client.user = &user
+	client.childMu.Unlock()
+	return nil
+}
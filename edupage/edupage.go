@@ -2,6 +2,7 @@ package edupage
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -10,9 +11,9 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
-	"path"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/DislikesSchool/EduPage2-server/edupage/model"
@@ -32,6 +33,12 @@ type EdupageClient struct {
 
 	user    *model.User
 	canteen *Canteen
+
+	// childUse is held shared while edupage returns the data of the selected child, and exclusively to select another one.
+	// childMu guards the selected child and the user model replaced together with it, for parent accounts.
+	childUse sync.RWMutex
+	childMu  sync.Mutex
+	child    string
 	//timeline  *model.Timeline
 	//results   *model.Results
 	//timetable *model.Timetable
@@ -45,7 +52,7 @@ func CreateClient(credentials Credentials) (*EdupageClient, error) {
 	}
 	client.Credentials = credentials
 
-	user, err := client.fetchUserModel()
+	user, err := client.fetchUserModel(context.Background())
 	if err != nil {
 		return nil, err
 	}
@@ -59,16 +66,20 @@ type PortalPingResponse struct {
 	Status string `json:"status"`
 }
 
+// PingSession checks whether the session is still alive, keeping it from expiring.
 func (client *EdupageClient) PingSession() (bool, error) {
+	return client.PingSessionContext(context.Background())
+}
+
+// PingSessionContext works like PingSession, the request is cancelled together with the context.
+func (client *EdupageClient) PingSessionContext(ctx context.Context) (bool, error) {
 	if client.Credentials.httpClient == nil {
 		return false, errors.New("invalid credentials")
 	}
 
-	u := fmt.Sprintf("https://%s/login/eauth?portalping", client.Credentials.Server)
-
-	response, err := client.Credentials.httpClient.Post(u, "application/x-www-form-urlencoded", bytes.NewBuffer([]byte("gpids=")))
+	response, err := client.Credentials.post(ctx, "/login/eauth?portalping", "application/x-www-form-urlencoded", bytes.NewBuffer([]byte("gpids=")))
 	if err != nil {
-		return false, ErrorUnauthorized
+		return false, requestError(ctx, err)
 	}
 
 	defer response.Body.Close()
@@ -109,17 +120,13 @@ type PollOptions struct {
 	Multiple bool         `json:"multiple,omitempty"`
 }
 
-type Attachment struct {
-	// TODO
-}
-
 type MessageOptions struct {
 	Text                string       `json:"text"`
 	Important           bool         `json:"important,omitempty"`
 	Parents             bool         `json:"parents,omitempty"`
 	AllowReplies        *bool        `json:"allowReplies,omitempty"`
 	RepliesToAuthorOnly bool         `json:"repliesToAuthorOnly,omitempty"`
-	Attachments         []string     `json:"attachments,omitempty"`
+	Attachments         []Attachment `json:"attachments,omitempty"`
 	Poll                *PollOptions `json:"poll,omitempty"`
 }
 
@@ -141,28 +148,22 @@ func (m *MessageOptions) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// SendMessage creates a new message on the timeline, sent to the recipient.
 func (client *EdupageClient) SendMessage(recipient string, options MessageOptions) error {
+	return client.SendMessageContext(context.Background(), recipient, options)
+}
+
+// SendMessageContext works like SendMessage, the request is cancelled together with the context.
+func (client *EdupageClient) SendMessageContext(ctx context.Context, recipient string, options MessageOptions) error {
 	if client.Credentials.httpClient == nil {
 		return errors.New("invalid credentials")
 	}
 
-	u := fmt.Sprintf("https://%s/timeline/?akcia=createItem", client.Credentials.Server)
-
 	hasPoll := options.Poll != nil && options.Poll.Options != nil
 
-	// Convert attachments to JSON
-	attachmentsJson := make([]string, len(options.Attachments))
-	for i, attachment := range options.Attachments {
-		jsonAttachment, err := json.Marshal(attachment)
-		if err != nil {
-			return fmt.Errorf("failed to marshal attachment: %s", err)
-		}
-		attachmentsJson[i] = string(jsonAttachment)
-	}
-
 	// Prepare data for the API request
 	data := map[string]interface{}{
-		"attachments":          strings.Join(attachmentsJson, ","),
+		"attachements":         encodeAttachments(options.Attachments),
 		"receipt":              "0",
 		"repliesDisabled":      "0",
 		"repliesToAllDisabled": "0",
@@ -210,7 +211,7 @@ func (client *EdupageClient) SendMessage(recipient string, options MessageOption
 	}
 
 	// Create a new HTTP request
-	req, err := http.NewRequest("POST", u, strings.NewReader(values.Encode()))
+	req, err := client.Credentials.newRequest(ctx, "POST", "/timeline/?akcia=createItem", strings.NewReader(values.Encode()))
 	if err != nil {
 		return fmt.Errorf("failed to create new HTTP request: %s", err)
 	}
@@ -221,7 +222,7 @@ func (client *EdupageClient) SendMessage(recipient string, options MessageOption
 	req.Header.Set("X-Requested-With", "XMLHttpRequest")
 	req.Header.Set("Referer", fmt.Sprintf("https://%s.edupage.org/", client.Credentials.Server))
 
-	resp, err := client.Credentials.httpClient.Do(req)
+	resp, err := client.Credentials.do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send HTTP request: %s", err)
 	}
@@ -272,8 +273,13 @@ func (client *EdupageClient) UpdateCredentials(credentials Credentials) {
 // If update is set to true, user data wil explicitly update
 // Return ErrorUnauthorized if an authorization error occcurs.
 func (client *EdupageClient) GetUser(update bool) (model.User, error) {
+	return client.GetUserContext(context.Background(), update)
+}
+
+// GetUserContext works like GetUser, the request is cancelled together with the context.
+func (client *EdupageClient) GetUserContext(ctx context.Context, update bool) (model.User, error) {
 	if client.user == nil || update {
-		user, err := client.fetchUserModel()
+		user, err := client.fetchUserModel(ctx)
 		if err != nil {
 			return model.User{}, err
 		}
@@ -288,7 +294,12 @@ func (client *EdupageClient) GetUser(update bool) (model.User, error) {
 // GetRecentTimeline retrieves last 30 days of timeline from edupage.
 // Return ErrorUnauthorized if an authorization error occcurs.
 func (client *EdupageClient) GetRecentTimeline() (model.Timeline, error) {
-	timeline, err := client.fetchTimelineModel(time.Now().AddDate(0, 0, -30), time.Now())
+	return client.GetRecentTimelineContext(context.Background())
+}
+
+// GetRecentTimelineContext works like GetRecentTimeline, the request is cancelled together with the context.
+func (client *EdupageClient) GetRecentTimelineContext(ctx context.Context) (model.Timeline, error) {
+	timeline, err := client.fetchTimelineModel(ctx, time.Now().AddDate(0, 0, -30), time.Now())
 	if err != nil {
 		return model.Timeline{}, err
 	}
@@ -299,7 +310,12 @@ func (client *EdupageClient) GetRecentTimeline() (model.Timeline, error) {
 // GetUser retrieves the timeline in a specified time interval from edupage.
 // Return ErrorUnauthorized if an authorization error occcurs.
 func (client *EdupageClient) GetTimeline(from, to time.Time) (model.Timeline, error) {
-	tt, err := client.fetchTimelineModel(from, to)
+	return client.GetTimelineContext(context.Background(), from, to)
+}
+
+// GetTimelineContext works like GetTimeline, the request is cancelled together with the context.
+func (client *EdupageClient) GetTimelineContext(ctx context.Context, from, to time.Time) (model.Timeline, error) {
+	tt, err := client.fetchTimelineModel(ctx, from, to)
 	if err != nil {
 		return model.Timeline{}, err
 	}
@@ -309,6 +325,11 @@ func (client *EdupageClient) GetTimeline(from, to time.Time) (model.Timeline, er
 // GetRecentResults retrieves the results from the current year from edupage.
 // Return ErrorUnauthorized if an authorization error occcurs.
 func (client *EdupageClient) GetRecentResults() (model.Results, error) {
+	return client.GetRecentResultsContext(context.Background())
+}
+
+// GetRecentResultsContext works like GetRecentResults, the request is cancelled together with the context.
+func (client *EdupageClient) GetRecentResultsContext(ctx context.Context) (model.Results, error) {
 	year := time.Now()
 	var halfyear string
 	month := time.Now().Month()
@@ -322,14 +343,19 @@ func (client *EdupageClient) GetRecentResults() (model.Results, error) {
 	if month >= time.September && month <= time.December {
 		halfyear = "P1"
 	}
-	return client.fetchResultsModel(year.Format("2006"), halfyear)
+	return client.fetchResultsModel(ctx, year.Format("2006"), halfyear)
 }
 
 // GetResults retrieves the results in a specified interval from edupage.
 // Halfyears types are: P1 (first halfyear), P2 (second halfyear), RX (whole year)
 // Return ErrorUnauthorized if an authorization error occcurs.
 func (client *EdupageClient) GetResults(year, halfyear string) (model.Results, error) {
-	results, err := client.fetchResultsModel(year, halfyear)
+	return client.GetResultsContext(context.Background(), year, halfyear)
+}
+
+// GetResultsContext works like GetResults, the request is cancelled together with the context.
+func (client *EdupageClient) GetResultsContext(ctx context.Context, year, halfyear string) (model.Results, error) {
+	results, err := client.fetchResultsModel(ctx, year, halfyear)
 	if err != nil {
 		return model.Results{}, err
 	}
@@ -339,7 +365,12 @@ func (client *EdupageClient) GetResults(year, halfyear string) (model.Results, e
 
 // GetResults retrieves this week's timetable from edupage.
 func (client *EdupageClient) GetRecentTimetable() (model.Timetable, error) {
-	tt, err := client.fetchTimetableModel(time.Now().AddDate(0, 0, -2), time.Now().AddDate(0, 0, 7))
+	return client.GetRecentTimetableContext(context.Background())
+}
+
+// GetRecentTimetableContext works like GetRecentTimetable, the request is cancelled together with the context.
+func (client *EdupageClient) GetRecentTimetableContext(ctx context.Context) (model.Timetable, error) {
+	tt, err := client.fetchTimetableModel(ctx, time.Now().AddDate(0, 0, -2), time.Now().AddDate(0, 0, 7))
 	if err != nil {
 		return model.Timetable{}, err
 	}
@@ -350,7 +381,12 @@ func (client *EdupageClient) GetRecentTimetable() (model.Timetable, error) {
 // GetResults retrieves the timetable in the specified interval from edupage.
 // Return ErrorUnauthorized if an authorization error occcurs.
 func (client *EdupageClient) GetTimetable(from, to time.Time) (model.Timetable, error) {
-	tt, err := client.fetchTimetableModel(from, to)
+	return client.GetTimetableContext(context.Background(), from, to)
+}
+
+// GetTimetableContext works like GetTimetable, the request is cancelled together with the context.
+func (client *EdupageClient) GetTimetableContext(ctx context.Context, from, to time.Time) (model.Timetable, error) {
+	tt, err := client.fetchTimetableModel(ctx, from, to)
 	if err != nil {
 		return model.Timetable{}, err
 	}
@@ -361,7 +397,12 @@ func (client *EdupageClient) GetTimetable(from, to time.Time) (model.Timetable,
 // GetCanteen retrieves the whole week's canteen from the specified day.
 // Return ErrorUnauthorized if an authorization error occcurs.
 func (client *EdupageClient) GetCanteen(date time.Time) (Canteen, error) {
-	model, err := client.fetchCanteenModel(date)
+	return client.GetCanteenContext(context.Background(), date)
+}
+
+// GetCanteenContext works like GetCanteen, the request is cancelled together with the context.
+func (client *EdupageClient) GetCanteenContext(ctx context.Context, date time.Time) (Canteen, error) {
+	model, err := client.fetchCanteenModel(ctx, date)
 	if err != nil {
 		return Canteen{}, err
 	}
@@ -376,24 +417,75 @@ func (client *EdupageClient) GetCanteen(date time.Time) (Canteen, error) {
 // GetCanteen retrieves the current week's canteen menu.
 // Return ErrorUnauthorized if an authorization error occcurs.
 func (client *EdupageClient) GetRecentCanteen() (Canteen, error) {
+	return client.GetRecentCanteenContext(context.Background())
+}
+
+// GetRecentCanteenContext works like GetRecentCanteen, the request is cancelled together with the context.
+func (client *EdupageClient) GetRecentCanteenContext(ctx context.Context) (Canteen, error) {
 	day := time.Now().Weekday()
 	if day == time.Saturday {
-		return client.GetCanteen(time.Now().AddDate(0, 0, 2))
+		return client.GetCanteenContext(ctx, time.Now().AddDate(0, 0, 2))
 	} else if day == time.Sunday {
-		return client.GetCanteen(time.Now().AddDate(0, 0, 1))
+		return client.GetCanteenContext(ctx, time.Now().AddDate(0, 0, 1))
 	}
-	return client.GetCanteen(time.Now())
+	return client.GetCanteenContext(ctx, time.Now())
 }
 
 // GetStudentID is used to retrieve the client's student ID.
+// For parent accounts, the ID of the active child is returned, see WithChild.
 // Returns ErrorUnitialized if the user object hasn't been initialized.
 func (client *EdupageClient) GetStudentID() (string, error) {
 	if client.user == nil {
 		return "", ErrorUnitialized
 	}
+	if client.IsParent() {
+		client.childMu.Lock()
+		defer client.childMu.Unlock()
+		return client.activeChild()
+	}
 	return client.user.UserRow.StudentID, nil
 }
 
+// GetStudentIDs is used to retrieve the IDs of all students the client can access,
+// the children of parent accounts or the student itself.
+// Returns ErrorUnitialized if the user object hasn't been initialized.
+func (client *EdupageClient) GetStudentIDs() ([]string, error) {
+	if client.user == nil {
+		return nil, ErrorUnitialized
+	}
+	if !client.IsParent() {
+		return []string{client.user.UserRow.StudentID}, nil
+	}
+
+	children, err := client.GetChildren()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(children))
+	for i, child := range children {
+		ids[i] = child.ID
+	}
+	return ids, nil
+}
+
+// GetClassID is used to retrieve the ID of the student's class.
+// For parent accounts, the class of the active child is returned, see WithChild.
+// Returns ErrorUnitialized if the user object hasn't been initialized.
+func (client *EdupageClient) GetClassID() (string, error) {
+	id, err := client.GetStudentID()
+	if err != nil {
+		return "", err
+	}
+	// The classroomid of the students is the ID of their class
+	if student, ok := client.user.DBI.Students[id]; ok && student.ClassroomID != "" {
+		return student.ClassroomID, nil
+	}
+	if client.IsParent() {
+		return "", ErrorNotFound
+	}
+	return client.user.UserRow.ClassID, nil
+}
+
 // GetSubjectByID is used to retrieve the subject by it's specified ID.
 // Returns ErrorNotFound if the subject can't be found.
 // Returns ErrorUnitialized if the user object hasn't been initialized.
@@ -408,6 +500,20 @@ func (client *EdupageClient) GetSubjectByID(id string) (model.Subject, error) {
 	return model.Subject{}, ErrorNotFound
 }
 
+// GetClassByID is used to retrieve the class by it's specified ID.
+// Returns ErrorNotFound if the class can't be found.
+// Returns ErrorUnitialized if the user object hasn't been initialized.
+func (client *EdupageClient) GetClassByID(id string) (model.Class, error) {
+	if client.user == nil {
+		return model.Class{}, ErrorUnitialized
+	}
+
+	if class, ok := client.user.DBI.Classes[id]; ok {
+		return class, nil
+	}
+	return model.Class{}, ErrorNotFound
+}
+
 // GetTeacherByID is used to retrieve the teacher by their specified ID.
 // Returns ErrorNotFound if the teacher can't be found.
 // Returns ErrorUnitialized if the user object hasn't been initialized.
@@ -440,6 +546,11 @@ func (client *EdupageClient) GetClassroomByID(id string) (model.Classroom, error
 // Returns ErrUnobtainableAttachments in case the attachments are not present.
 // Retruns map, key is the resource name and value is the resource link
 func (client *EdupageClient) FetchHomeworkAttachments(i model.Homework) (map[string]string, error) {
+	return client.FetchHomeworkAttachmentsContext(context.Background(), i)
+}
+
+// FetchHomeworkAttachmentsContext works like FetchHomeworkAttachments, the request is cancelled together with the context.
+func (client *EdupageClient) FetchHomeworkAttachmentsContext(ctx context.Context, i model.Homework) (map[string]string, error) {
 	if len(i.ESuperID) == 0 || len(i.TestID) == 0 {
 		return nil, errors.New("required fields superid and testid not set")
 	}
@@ -451,13 +562,11 @@ func (client *EdupageClient) FetchHomeworkAttachments(i model.Homework) (map[str
 
 	payload := CreatePayload(data)
 
-	resp, err := client.Credentials.httpClient.PostForm(
-		"https://"+path.Join(client.Credentials.Server, "elearning", "?cmd=MaterialPlayer&akcia=getETestData"),
-		payload,
-	)
+	resp, err := client.Credentials.postForm(ctx, "/elearning/?cmd=MaterialPlayer&akcia=getETestData", payload)
 	if err != nil {
 		return nil, fmt.Errorf("homework request failed: %w", err)
 	}
+	defer resp.Body.Close()
 
 	response, err := io.ReadAll(resp.Body)
 
@@ -557,6 +666,11 @@ func (client *EdupageClient) FetchHomeworkAttachments(i model.Homework) (map[str
 // ChangeOrderStatus changed order status of a meal for the specified day
 // Return ErrorUnathorized, ErrorUnitialized, ErrorUnchangeable
 func (e *EdupageClient) ChangeOrderStatus(day Day, order bool) error {
+	return e.ChangeOrderStatusContext(context.Background(), day, order)
+}
+
+// ChangeOrderStatusContext works like ChangeOrderStatus, the request is cancelled together with the context.
+func (e *EdupageClient) ChangeOrderStatusContext(ctx context.Context, day Day, order bool) error {
 	if e.Credentials.httpClient == nil {
 		return ErrorUnitialized
 	}
@@ -595,10 +709,11 @@ func (e *EdupageClient) ChangeOrderStatus(day Day, order bool) error {
 		"jedlaStravnika": string(jedlaStravnika),
 	})
 
-	response, err := e.Credentials.httpClient.PostForm(fmt.Sprintf("https://%s/menu/", e.Credentials.Server), payload)
+	response, err := e.Credentials.postForm(ctx, "/menu/", payload)
 	if err != nil {
 		return err
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != 200 {
 		return errors.New("invalid response code")
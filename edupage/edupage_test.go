@@ -1,10 +1,24 @@
 package edupage
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/edupagetest"
+	"github.com/DislikesSchool/EduPage2-server/edupage/grades"
+	"github.com/DislikesSchool/EduPage2-server/edupage/ical"
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -15,6 +29,9 @@ var (
 	ic_username string
 	ic_password string
 	ic_server   string
+
+	fake        *edupagetest.Server
+	testOptions LoginOptions
 )
 
 func init() {
@@ -27,6 +44,29 @@ func init() {
 	flag.StringVar(&ic_server, "ic_server", "", "iCanteen server")
 }
 
+// TestMain runs the tests against the fake edupage server,
+// unless credentials for a live account are specified.
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	if len(username) == 0 && len(password) == 0 {
+		fake = edupagetest.NewServer()
+		username = fake.Username
+		password = fake.Password
+		server = fake.School
+		name = fake.Name()
+		testOptions = LoginOptions{BaseURL: fake.URL}
+		PasswordHashCost = bcrypt.MinCost
+	}
+
+	code := m.Run()
+
+	if fake != nil {
+		fake.Close()
+	}
+	os.Exit(code)
+}
+
 func checkCredentials() error {
 	if len(username) == 0 {
 		return errors.New("username parameter missing, (-username=?)")
@@ -52,7 +92,7 @@ func TestLoginAuto(t *testing.T) {
 		t.Error(errors.New("password parameter missing, (-password=?)"))
 	}
 
-	credentials, err := Login(username, password, "login1")
+	credentials, err := LoginWithOptions(username, password, "login1", testOptions)
 	if err != nil {
 		t.Error(err)
 		return
@@ -72,7 +112,7 @@ func TestEdupage(t *testing.T) {
 		return
 	}
 
-	credentials, err := Login(username, password, server)
+	credentials, err := LoginWithOptions(username, password, server, testOptions)
 	if err != nil {
 		t.Error(err)
 		return
@@ -137,7 +177,7 @@ func BenchmarkLogin(t *testing.B) {
 	}
 	t.ResetTimer()
 
-	_, err = Login(username, password, server)
+	_, err = LoginWithOptions(username, password, server, testOptions)
 
 	if err != nil {
 		t.Error(err)
@@ -152,7 +192,7 @@ func BenchmarkTimeline(t *testing.B) {
 		return
 	}
 
-	credentials, err := Login(username, password, server)
+	credentials, err := LoginWithOptions(username, password, server, testOptions)
 
 	if err != nil {
 		t.Error(err)
@@ -185,7 +225,7 @@ func BenchmarkResults(t *testing.B) {
 		return
 	}
 
-	credentials, err := Login(username, password, server)
+	credentials, err := LoginWithOptions(username, password, server, testOptions)
 
 	if err != nil {
 		t.Error(err)
@@ -218,7 +258,7 @@ func BenchmarkTimetable(t *testing.B) {
 		return
 	}
 
-	credentials, err := Login(username, password, server)
+	credentials, err := LoginWithOptions(username, password, server, testOptions)
 
 	if err != nil {
 		t.Error(err)
@@ -243,3 +283,1040 @@ func BenchmarkTimetable(t *testing.B) {
 		t.Log("Recieved timetable is empty")
 	}
 }
+
+// fakeClient logs in to the fake edupage server, the test is skipped when running against a live account.
+func TestDeprecatedServer(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	Server = fake.URL
+	t.Cleanup(func() { Server = "" })
+
+	credentials, err := Login(fake.Username, fake.Password, fake.School)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.Server != fake.Host() {
+		t.Errorf("expected the server %s, got %s", fake.Host(), credentials.Server)
+	}
+}
+
+func fakeClient(t *testing.T) *EdupageClient {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	credentials, err := LoginWithOptions(fake.Username, fake.Password, fake.School, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := CreateClient(credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestLoginInvalidPassword(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	_, err := LoginWithOptions(fake.Username, "wrong", fake.School, testOptions)
+	if !errors.Is(err, ErrAuthorization) {
+		t.Errorf("expected ErrAuthorization, got %v", err)
+	}
+}
+
+func TestFakeUser(t *testing.T) {
+	client := fakeClient(t)
+
+	user, err := client.GetUser(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.UserRow.StudentID != edupagetest.StudentID {
+		t.Errorf("expected student id %s, got %s", edupagetest.StudentID, user.UserRow.StudentID)
+	}
+
+	if client.gsechash != edupagetest.GSecHash {
+		t.Errorf("expected gsechash %s, got %s", edupagetest.GSecHash, client.gsechash)
+	}
+
+	if client.Credentials.Server != fake.Host() {
+		t.Errorf("expected server %s, got %s", fake.Host(), client.Credentials.Server)
+	}
+}
+
+func TestFakeTimeline(t *testing.T) {
+	client := fakeClient(t)
+
+	timeline, err := client.GetRecentTimeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(timeline.Items) != len(fake.Timeline) {
+		t.Errorf("expected %d timeline items, got %d", len(fake.Timeline), len(timeline.Items))
+	}
+
+	item, ok := timeline.Items["100001"]
+	if !ok {
+		t.Fatal("message 100001 is missing")
+	}
+
+	attachments, err := item.GetAttachments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 1 {
+		t.Errorf("expected 1 attachment, got %d", len(attachments))
+	}
+
+	data, err := item.TypedData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message, ok := data.(*model.MessageData); !ok || message.Text != item.Text || bool(message.Receipt) {
+		t.Errorf("expected a message without a receipt, got %#v", data)
+	}
+
+	poll := timeline.Items["100005"]
+	data, err = poll.TypedData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, ok := data.(*model.MessageData)
+	if !ok || !bool(message.Receipt) || message.Voting == nil || len(message.Voting.Answers) != 2 || len(message.Attachments) != 0 {
+		t.Errorf("expected a poll with a receipt, got %#v", data)
+	}
+
+	homework := timeline.Items["100003"]
+	if !homework.IsHomeworkWithAttachments() {
+		t.Error("expected a homework with attachments")
+	}
+
+	grade := timeline.Items["100004"]
+	data, err = grade.TypedData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gradeData, ok := data.(*model.GradeData); !ok || gradeData.Grade != "1" || gradeData.SubjectID != "301" {
+		t.Errorf("expected a grade, got %#v", data)
+	}
+
+	data, err = model.DecodeTimelineData("testpopup", model.StringJsonObject{Value: map[string]interface{}{"id": 1.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unknown, ok := data.(*model.UnknownData); !ok || unknown.ItemType() != "testpopup" {
+		t.Errorf("expected unknown data, got %#v", data)
+	}
+
+	old, err := client.GetTimeline(time.Now().AddDate(-1, 0, 0), time.Now().AddDate(0, -6, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(old.Items) != 0 {
+		t.Errorf("expected no timeline items, got %d", len(old.Items))
+	}
+}
+
+func TestFakeThreads(t *testing.T) {
+	client := fakeClient(t)
+
+	timeline, err := client.GetRecentTimeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := client.GetUser(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	threads := timeline.Threads()
+	if len(threads) != 2 || threads[0].ID != "100005" || threads[1].ID != "100001" {
+		t.Fatalf("expected the poll and the message threads, got %+v", threads)
+	}
+
+	thread := threads[1]
+	if thread.MessageCount != 3 || thread.Partial {
+		t.Errorf("expected a complete thread of 3 messages, got %d", thread.MessageCount)
+	}
+	if len(thread.Root.Replies) != 1 || len(thread.Root.Replies[0].Replies) != 1 || thread.Root.Replies[0].Replies[0].ID != "100006" {
+		t.Error("expected the answer to be nested under the reply")
+	}
+	if !thread.LastActivity.Equal(timeline.Items["100006"].TimeAdded.Time) {
+		t.Errorf("expected the last activity of the answer, got %s", thread.LastActivity)
+	}
+
+	participants := thread.Participants(&user.DBI)
+	if len(participants) != 2 || participants[0].Name != "Eva Svobodová" || participants[1].Type != model.ParticipantStudent {
+		t.Errorf("expected the teacher and the student, got %+v", participants)
+	}
+
+	reply, ok := timeline.Thread("100002")
+	if !ok || !reply.Partial || reply.MessageCount != 2 {
+		t.Errorf("expected a partial thread of the reply, got %+v", reply)
+	}
+}
+
+func TestFakeResults(t *testing.T) {
+	client := fakeClient(t)
+
+	results, err := client.GetRecentResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, ok := results.Events["60001"]
+	if !ok {
+		t.Fatal("event 60001 is missing")
+	}
+	if event.Data != "1" {
+		t.Errorf("expected grade 1, got %s", event.Data)
+	}
+
+	if len(results.Notes) != 1 {
+		t.Errorf("expected 1 note, got %d", len(results.Notes))
+	}
+}
+
+func TestFakeTimetable(t *testing.T) {
+	client := fakeClient(t)
+
+	monday := time.Date(2024, time.September, 2, 0, 0, 0, 0, time.UTC)
+	timetable, err := client.GetTimetable(monday, monday.AddDate(0, 0, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(timetable.Days) != 5 {
+		t.Errorf("expected 5 days, got %d", len(timetable.Days))
+	}
+
+	if len(timetable.Days["2024-09-02"]) != len(fake.Lessons[0]) {
+		t.Errorf("expected %d lessons on monday, got %d", len(fake.Lessons[0]), len(timetable.Days["2024-09-02"]))
+	}
+}
+
+func TestFakeCanteen(t *testing.T) {
+	client := fakeClient(t)
+
+	monday := time.Date(2024, time.September, 2, 0, 0, 0, 0, time.UTC)
+	canteen, err := client.GetCanteen(monday)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day, ok := canteen.GetMenuByDay(monday)
+	if !ok {
+		t.Fatal("menu for monday is missing")
+	}
+
+	if !day.Ordered {
+		t.Error("expected the meal to be ordered")
+	}
+}
+
+func TestFakeSendMessage(t *testing.T) {
+	client := fakeClient(t)
+
+	allowReplies := true
+	err := client.SendMessage("Ucitel201", MessageOptions{
+		Text:         "Dobrý den",
+		AllowReplies: &allowReplies,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := fake.Messages()
+	if len(messages) == 0 {
+		t.Fatal("no message arrived at the server")
+	}
+
+	last := messages[len(messages)-1]
+	if last.Get("text") != "Dobrý den" || last.Get("selectedUser") != "Ucitel201" {
+		t.Errorf("unexpected message %v", last)
+	}
+}
+
+func TestFakeUploadAttachment(t *testing.T) {
+	client := fakeClient(t)
+
+	content := []byte("%PDF-1.4\n%fake document\n")
+	attachment, err := client.UploadAttachment("úkol.pdf", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.Name != "úkol.pdf" || attachment.Type != "application/pdf" || attachment.Extension != "pdf" {
+		t.Errorf("unexpected attachment %+v", attachment)
+	}
+	if uploaded, ok := fake.Upload(attachment.Path); !ok || !bytes.Equal(uploaded, content) {
+		t.Error("the file didn't arrive at the server")
+	}
+
+	allowReplies := true
+	err = client.SendMessage("Ucitel201", MessageOptions{
+		Text:         "Posílám úkol",
+		AllowReplies: &allowReplies,
+		Attachments:  []Attachment{attachment},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := fake.Messages()
+	var attachments map[string]string
+	if err := json.Unmarshal([]byte(messages[len(messages)-1].Get("attachements")), &attachments); err != nil {
+		t.Fatal(err)
+	}
+	if attachments[attachment.Path] != attachment.Name {
+		t.Errorf("expected the attachment in the message, got %v", attachments)
+	}
+
+	var refused *RefusedError
+	if _, err := client.UploadAttachment("empty.txt", bytes.NewReader(nil)); !errors.As(err, &refused) {
+		t.Errorf("expected the empty file to be refused, got %v", err)
+	}
+}
+
+func TestFakeOpenAttachment(t *testing.T) {
+	client := fakeClient(t)
+
+	timeline, err := client.GetRecentTimeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := timeline.Items["100001"]
+	attachments, err := item.GetAttachments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := attachments["ucebnice.pdf"]
+
+	resp, err := client.OpenAttachment(link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(content, fake.Files[link]) {
+		t.Errorf("unexpected response %d %q", resp.StatusCode, content)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Error("expected an ETag")
+	}
+
+	resp, err = client.OpenAttachment(link, http.Header{"Range": {"bytes=0-7"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(content) != "%PDF-1.4" {
+		t.Errorf("unexpected partial response %d %q", resp.StatusCode, content)
+	}
+
+	resp, err = client.OpenAttachment(link, http.Header{"If-None-Match": {etag}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", resp.StatusCode)
+	}
+
+	if _, err := client.OpenAttachment("/cloud/missing/file.pdf", nil); !errors.Is(err, ErrorNotFound) {
+		t.Errorf("expected ErrorNotFound, got %v", err)
+	}
+	for _, link := range []string{"https://example.com/file.pdf", "//example.com/file.pdf", "http://fakeschool.edupage.org/file.pdf", "https://evil.com@example.com/", "file.pdf"} {
+		if _, err := client.OpenAttachment(link, nil); !errors.Is(err, ErrorInvalidAttachmentURL) {
+			t.Errorf("expected %q to be refused, got %v", link, err)
+		}
+	}
+
+	fake.ExpireSessions()
+	if _, err := client.OpenAttachment(link, nil); !errors.Is(err, ErrorUnauthorized) {
+		t.Errorf("expected ErrorUnauthorized, got %v", err)
+	}
+}
+
+func TestFakeHomework(t *testing.T) {
+	client := fakeClient(t)
+	homeworks := fake.Homeworks
+	t.Cleanup(func() { fake.Homeworks = homeworks })
+
+	timeline, err := client.GetRecentTimeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sorted := timeline.SortedHomeworks()
+	if len(sorted) != 1 {
+		t.Fatalf("expected 1 homework, got %d", len(sorted))
+	}
+	homework := sorted[0]
+
+	due, allDay, ok := homework.Due(time.Local)
+	if !ok || allDay || due.Format(model.TimeFormat) != homeworks[0]["datetimeto"] {
+		t.Errorf("unexpected due date %v (all day %v)", due, allDay)
+	}
+	if homework.SubjectID() != "303" {
+		t.Errorf("expected subject 303, got %s", homework.SubjectID())
+	}
+	if status := homework.Status(time.Now(), time.Local); status != model.HomeworkPending {
+		t.Errorf("expected a pending homework, got %s", status)
+	}
+	if status := homework.Status(due.Add(time.Minute), time.Local); status != model.HomeworkOverdue {
+		t.Errorf("expected an overdue homework, got %s", status)
+	}
+
+	item, ok := timeline.HomeworkItem(homework)
+	if !ok || item.ID != "100003" {
+		t.Fatalf("expected the homework item 100003, got %v", item.ID)
+	}
+	if err := client.MarkHomeworkDone(timeline.Items["100001"]); !errors.Is(err, ErrorNotHomework) {
+		t.Errorf("expected ErrorNotHomework, got %v", err)
+	}
+	if err := client.MarkHomeworkDone(item); err != nil {
+		t.Fatal(err)
+	}
+
+	timeline, err = client.GetRecentTimeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	homework = timeline.Homeworks[homework.ID]
+	if !homework.Done() || homework.Status(time.Now(), time.Local) != model.HomeworkDone || homework.DoneCount.String() != "1" {
+		t.Errorf("expected the homework to be done, got state %q and %s done", homework.State, homework.DoneCount)
+	}
+}
+
+func TestGradeValues(t *testing.T) {
+	for raw, expected := range map[string]grades.Value{
+		"1":    {Kind: grades.KindMark, Mark: 1},
+		"2-":   {Kind: grades.KindMark, Mark: 2.5},
+		"3+":   {Kind: grades.KindMark, Mark: 2.5},
+		"1+":   {Kind: grades.KindMark, Mark: 1},
+		"1,5":  {Kind: grades.KindMark, Mark: 1.5},
+		"b":    {Kind: grades.KindLetter, Mark: 2},
+		"85%":  {Kind: grades.KindPercent, Mark: 2, Percent: 85},
+		"7/10": {Kind: grades.KindPoints, Mark: 3, Percent: 70, Points: 7, MaxPoints: 10},
+	} {
+		value, ok := grades.ParseValue(raw)
+		expected.Raw = raw
+		if !ok || value != expected {
+			t.Errorf("expected %q to be %+v, got %+v", raw, expected, value)
+		}
+	}
+
+	for _, raw := range []string{"", "N", "-", "6", "x/0"} {
+		if value, ok := grades.ParseValue(raw); ok {
+			t.Errorf("expected %q not to be graded, got %+v", raw, value)
+		}
+	}
+}
+
+func TestGradesSummary(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	grade := func(id, subject, value string, weight float64, daysAgo int) grades.Grade {
+		parsed, _ := grades.ParseValue(value)
+		return grades.Grade{EventID: id, SubjectID: subject, Date: now.AddDate(0, 0, -daysAgo), Weight: weight, Value: parsed}
+	}
+
+	summary := grades.Summarize([]grades.Grade{
+		grade("1", "math", "3", 1, 60),
+		grade("2", "math", "1", 2, 40),
+		grade("3", "chem", "2", 1, 10),
+		grade("4", "math", "1", 1, 5),
+	}, now)
+
+	math := summary.Subjects["math"]
+	if math.Average != 1.5 || math.Count != 3 || math.Weight != 4 {
+		t.Errorf("unexpected math summary %+v", math)
+	}
+	if len(math.Trend) != 3 || math.Trend[0].Average != 3 || math.Trend[1].Average != 1.67 {
+		t.Errorf("unexpected math trend %+v", math.Trend)
+	}
+	if math.Change != -0.17 {
+		t.Errorf("expected the math average to improve by 0.17, got %v", math.Change)
+	}
+	if summary.Subjects["chem"].Change != 0 {
+		t.Errorf("expected no change without older grades, got %v", summary.Subjects["chem"].Change)
+	}
+	if summary.Average != 1.75 || summary.Count != 4 {
+		t.Errorf("expected the overall average 1.75 of 4 grades, got %v of %d", summary.Average, summary.Count)
+	}
+
+	if needed, ok := math.Needed(1.4, 1); !ok || needed != 1 {
+		t.Errorf("expected a 1 to be needed, got %v (%v)", needed, ok)
+	}
+	if needed, ok := math.Needed(1.4, 2); !ok || needed != 1.2 {
+		t.Errorf("expected a 1.2 to be needed, got %v (%v)", needed, ok)
+	}
+	if _, ok := math.Needed(1.1, 1); ok {
+		t.Error("expected 1.1 to be unreachable")
+	}
+	if needed, ok := math.Needed(3, 1); !ok || needed != grades.WorstMark {
+		t.Errorf("expected any grade to keep the average, got %v (%v)", needed, ok)
+	}
+}
+
+func TestFakeGrades(t *testing.T) {
+	client := fakeClient(t)
+
+	results, err := client.GetRecentResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graded := grades.FromResults(results)
+	if len(graded) != 2 || graded[0].EventID != "60002" || graded[1].Weight != 2 {
+		t.Fatalf("unexpected grades %+v", graded)
+	}
+
+	summary := grades.Summarize(graded, time.Now())
+	if summary.Subjects["301"].Average != 1 || summary.Subjects["302"].Average != 3 || summary.Average != 2 {
+		t.Errorf("unexpected averages %+v", summary)
+	}
+}
+
+func TestNotes(t *testing.T) {
+	results := model.Results{Notes: map[string]model.Note{
+		"1": {ID: "1", Date: "2024-10-01", Type: "pochvala"},
+		"2": {ID: "2", Date: "2024-11-05", Type: "Poznámka"},
+		"3": {ID: "3", Type: "jiná"},
+	}}
+
+	notes := results.SortedNotes()
+	if len(notes) != 3 || notes[0].ID != "2" || notes[1].ID != "1" || notes[2].ID != "3" {
+		t.Fatalf("unexpected order %+v", notes)
+	}
+	if notes[0].Kind() != model.NoteReprimand || notes[1].Kind() != model.NotePraise || notes[2].Kind() != model.NoteOther {
+		t.Errorf("unexpected kinds %s %s %s", notes[0].Kind(), notes[1].Kind(), notes[2].Kind())
+	}
+	if _, ok := notes[2].ParsedDate(); ok {
+		t.Errorf("expected no date for %+v", notes[2])
+	}
+}
+
+func TestSchoolHalf(t *testing.T) {
+	for day, expected := range map[string]string{
+		"2024-09-02": "2024 P1",
+		"2025-01-31": "2024 P1",
+		"2025-02-01": "2024 P2",
+		"2025-08-31": "2024 P2",
+	} {
+		date, _ := time.Parse("2006-01-02", day)
+		if year, half := model.SchoolHalf(date); year+" "+half != expected {
+			t.Errorf("expected %s for %s, got %s %s", expected, day, year, half)
+		}
+	}
+}
+
+func TestFakeAttendance(t *testing.T) {
+	client := fakeClient(t)
+
+	user, err := client.GetUser(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attendance, err := client.GetAttendance(time.Now().AddDate(0, 0, -14), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	absences := attendance.Sorted()
+	if len(absences) != 3 || absences[0].ID != "90001" {
+		t.Fatalf("unexpected absences %+v", absences)
+	}
+	var statuses []string
+	for _, absence := range absences {
+		statuses = append(statuses, absence.Status(&user.DBI))
+	}
+	if strings.Join(statuses, ",") != "excused,unexcused,late" {
+		t.Errorf("unexpected statuses %v", statuses)
+	}
+
+	if attendance, err := client.GetAttendance(time.Now().AddDate(0, 0, 1), time.Now().AddDate(0, 0, 7)); err != nil || len(attendance.Absences) != 0 {
+		t.Errorf("expected no absences in the future, got %+v %v", attendance, err)
+	}
+}
+
+func TestFakeSchoolTimetables(t *testing.T) {
+	client := fakeClient(t)
+	if _, err := client.GetUser(false); err != nil {
+		t.Fatal(err)
+	}
+	from, to := time.Now(), time.Now().AddDate(0, 0, 7)
+
+	own, err := client.GetTimetable(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	class, err := client.GetClassTimetable(edupagetest.ClassID, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(class.Days) != len(own.Days) {
+		t.Errorf("expected the lessons of the student's class, got %+v", class)
+	}
+
+	for _, table := range []struct {
+		name  string
+		id    string
+		fetch func(string, time.Time, time.Time) (model.Timetable, error)
+	}{
+		{"teacher", "202", client.GetTeacherTimetable},
+		{"classroom", "402", client.GetClassroomTimetable},
+	} {
+		tt, err := table.fetch(table.id, from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lessons := 0
+		for _, items := range tt.Days {
+			for _, item := range items {
+				lessons++
+				if item.SubjectID != "303" {
+					t.Errorf("unexpected lesson of the %s %+v", table.name, item)
+				}
+			}
+		}
+		if lessons == 0 {
+			t.Errorf("expected the lessons of the %s", table.name)
+		}
+
+		if _, err := table.fetch("999", from, to); !errors.Is(err, ErrorNotFound) {
+			t.Errorf("expected ErrorNotFound for an unknown %s, got %v", table.name, err)
+		}
+	}
+}
+
+func TestFakeOccupancy(t *testing.T) {
+	client := fakeClient(t)
+	user, err := client.GetUser(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	monday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 7-int(now.Weekday()+6)%7)
+	occupancy, err := client.GetOccupancy(monday, monday.AddDate(0, 0, 6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := monday.Format(model.TimeFormatYearMonthDay)
+
+	if free := occupancy.FreeClassrooms(&user.DBI, date, "1"); len(free) != 1 || free[0].ID != "402" {
+		t.Errorf("expected the laboratory to be free in the first period, got %+v", free)
+	}
+	if free := occupancy.FreeTeachers(&user.DBI, date, "3"); len(free) != 1 || free[0].ID != "201" {
+		t.Errorf("expected Svobodová to be free in the third period, got %+v", free)
+	}
+
+	var periods []string
+	for _, period := range occupancy.TeacherFreePeriods(&user.DBI, "202", date) {
+		periods = append(periods, period.ID)
+	}
+	if strings.Join(periods, ",") != "1,2,4,5,6" {
+		t.Errorf("unexpected free periods of Dvořák %v", periods)
+	}
+	if free := occupancy.TeacherFreePeriods(&user.DBI, "202", monday.AddDate(0, 0, 5).Format(model.TimeFormatYearMonthDay)); free != nil {
+		t.Errorf("expected no school on saturday, got %+v", free)
+	}
+
+	// A double lesson occupies both periods
+	occupancy.Add(model.Timetable{Days: map[string][]model.TimetableItem{
+		date: {{Type: "lesson", Period: "5", TeacherIDs: []string{"202"}, ClassroomIDs: []string{"402"}, Duration: "2"}},
+	}})
+	if free := occupancy.FreeClassrooms(&user.DBI, date, "6"); len(free) != 1 || free[0].ID != "401" {
+		t.Errorf("expected the double lesson in the laboratory, got %+v", free)
+	}
+}
+
+func TestFakeTimetableChanges(t *testing.T) {
+	client := fakeClient(t)
+
+	changes, err := client.GetTimetableChanges(time.Now(), time.Now().AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	for _, change := range changes {
+		kinds = append(kinds, change.Period+":"+strings.Join(change.Kinds, "+"))
+	}
+	if strings.Join(kinds, ",") != "1:substituted,3:moved,4:cancelled,5:added" {
+		t.Errorf("unexpected changes %v", kinds)
+	}
+	if changes[0].Original == nil || changes[0].Original.TeacherIDs[0] != "201" || changes[3].Original != nil {
+		t.Errorf("unexpected original lessons %+v", changes)
+	}
+}
+
+func TestFakeCalendar(t *testing.T) {
+	client := fakeClient(t)
+
+	user, err := client.GetUser(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().AddDate(0, 0, 7-int(time.Now().Weekday()+6)%7)
+	timetable, err := client.GetTimetable(start, start.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	location := time.FixedZone("CET", 3600)
+	events := ical.LessonEvents(timetable, &user.DBI, location)
+	if len(events) == 0 {
+		t.Fatal("expected the lessons of monday")
+	}
+	var first ical.Event
+	for _, event := range events {
+		if first.Start.IsZero() || event.Start.Before(first.Start) {
+			first = event
+		}
+	}
+	if first.Summary != "Matematika" || first.Start.Format("15:04") != "08:00" || first.End.Format("15:04") != "08:45" {
+		t.Errorf("unexpected first lesson %+v", first)
+	}
+
+	calendar := ical.Calendar{Name: "Rozvrh", Domain: fake.School + ".edupage.org", Stamp: time.Now(), Events: []ical.Event{
+		first,
+		{UID: "homework-1", Start: first.Start, AllDay: true, Summary: "Úkol; strana 12, cvičení " + strings.Repeat("a", 80), Category: ical.CategoryHomework},
+	}}
+	var b bytes.Buffer
+	if _, err := calendar.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	feed := b.String()
+
+	for _, line := range strings.Split(strings.TrimSuffix(feed, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(feed, "\r\n ", "")
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"DTSTART:" + first.Start.UTC().Format("20060102T150405Z") + "\r\n",
+		"DTSTART;VALUE=DATE:" + first.Start.Format("20060102") + "\r\n",
+		`SUMMARY:Úkol\; strana 12\, cvičení `,
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Errorf("expected %q in the feed:\n%s", want, feed)
+		}
+	}
+}
+
+func TestGradeDiff(t *testing.T) {
+	before := model.Results{Events: map[string]model.Event{
+		"1": {SubjectID: "301", Data: "1", Weight: "1"},
+		"2": {SubjectID: "302", Data: "3", Weight: "1"},
+		"3": {SubjectID: "303", Data: "2", Weight: "1"},
+		"4": {SubjectID: "303"},
+	}}
+	after := model.Results{Events: map[string]model.Event{
+		"1": {SubjectID: "301", Data: "1", Weight: "1", Signed: "1"},
+		"2": {SubjectID: "302", Data: "2", Weight: "1"},
+		"4": {SubjectID: "303", Data: "4", Weight: "1"},
+		"5": {SubjectID: "301"},
+	}}
+
+	changes := grades.Diff(before, after)
+	if len(changes) != 3 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if changes[0].Kind != grades.ChangeModified || changes[0].EventID != "2" || changes[0].Before.Data != "3" || changes[0].After.Data != "2" {
+		t.Errorf("unexpected modification %+v", changes[0])
+	}
+	if changes[1].Kind != grades.ChangeRemoved || changes[1].EventID != "3" || changes[1].After != nil {
+		t.Errorf("unexpected removal %+v", changes[1])
+	}
+	if changes[2].Kind != grades.ChangeAdded || changes[2].EventID != "4" || changes[2].Before != nil {
+		t.Errorf("unexpected addition %+v", changes[2])
+	}
+
+	if changes := grades.Diff(after, after); len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
+
+func TestFakeReactions(t *testing.T) {
+	client := fakeClient(t)
+
+	timeline, err := client.GetRecentTimeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, poll := timeline.Items["100001"], timeline.Items["100005"]
+
+	id, err := client.Reply(message, ReplyOptions{Text: "Děkuji"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := fake.Messages()
+	last := messages[len(messages)-1]
+	if id == "" || last.Get("reakcia_na") != "100001" || last.Get("text") != "Děkuji" {
+		t.Errorf("unexpected reply %s %v", id, last)
+	}
+
+	var refused *RefusedError
+	_, err = client.Reply(model.TimelineItem{ID: "999", Type: model.ItemTypeMessage}, ReplyOptions{Text: "?"})
+	if !errors.As(err, &refused) || refused.Action != "reply" {
+		t.Errorf("expected the reply to be refused, got %v", err)
+	}
+
+	disabled := model.TimelineItem{ID: "100001", Type: model.ItemTypeMessage, Data: model.StringJsonObject{Value: map[string]interface{}{"repliesDisabled": "1"}}}
+	if _, err := client.Reply(disabled, ReplyOptions{Text: "?"}); !errors.Is(err, ErrorRepliesDisabled) {
+		t.Errorf("expected ErrorRepliesDisabled, got %v", err)
+	}
+
+	if err := client.ConfirmReceipt(message); !errors.Is(err, ErrorNoReceipt) {
+		t.Errorf("expected ErrorNoReceipt, got %v", err)
+	}
+	if err := client.ConfirmReceipt(poll); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Like(timeline.Items["100003"]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Vote(message, []string{"a1"}); !errors.Is(err, ErrorNotPoll) {
+		t.Errorf("expected ErrorNotPoll, got %v", err)
+	}
+	for _, answers := range [][]string{nil, {"a1", "a2"}, {"a3"}} {
+		if err := client.Vote(poll, answers); !errors.Is(err, ErrorInvalidVote) {
+			t.Errorf("expected ErrorInvalidVote for %v, got %v", answers, err)
+		}
+	}
+	if err := client.Vote(poll, []string{"a2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	confirmations := fake.Confirmations()
+	if len(confirmations) < 3 {
+		t.Fatalf("expected 3 confirmations, got %d", len(confirmations))
+	}
+	vote := confirmations[len(confirmations)-1]
+	if vote.Get("confirmType") != "vote" || vote.Get("timelineid") != "100005" || vote.Get("answers") != `["a2"]` {
+		t.Errorf("unexpected vote %v", vote)
+	}
+
+	err = client.Like(model.TimelineItem{ID: "999"})
+	if !errors.As(err, &refused) || refused.Reason != "item not found" {
+		t.Errorf("expected the like to be refused, got %v", err)
+	}
+}
+
+func TestFakePingSession(t *testing.T) {
+	client := fakeClient(t)
+
+	ok, err := client.PingSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("expected the session to be alive")
+	}
+
+	fake.ExpireSessions()
+
+	ok, err = client.PingSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("expected the session to be expired")
+	}
+}
+
+func TestFakeContextCancelled(t *testing.T) {
+	client := fakeClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.GetRecentTimelineContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	_, err = client.GetTimetableContext(ctx, time.Now(), time.Now().AddDate(0, 0, 7))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	_, err = client.GetResultsContext(ctx, "2024", "P1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestFakeRestoreSession(t *testing.T) {
+	client := fakeClient(t)
+
+	session, err := client.ExportSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if session.GSecHash != edupagetest.GSecHash {
+		t.Errorf("expected gsechash %s, got %s", edupagetest.GSecHash, session.GSecHash)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Session
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := RestoreClient(context.Background(), decoded, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Credentials.PasswordHash != client.Credentials.PasswordHash {
+		t.Error("expected the password hash to be restored")
+	}
+
+	if _, err := restored.GetRecentTimeline(); err != nil {
+		t.Error(err)
+	}
+
+	fake.ExpireSessions()
+
+	_, err = RestoreClient(context.Background(), decoded, testOptions)
+	if !errors.Is(err, ErrorUnauthorized) {
+		t.Errorf("expected ErrorUnauthorized, got %v", err)
+	}
+}
+
+func TestFakeParentChildren(t *testing.T) {
+	if fake == nil {
+		t.Skip("Skipping test: only runs against the fake server")
+	}
+
+	credentials, err := LoginWithOptions(fake.ParentUsername, fake.ParentPassword, fake.School, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := CreateClient(credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !client.IsParent() {
+		t.Fatal("expected a parent account")
+	}
+
+	children, err := client.GetChildren()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 || children[0].ID != edupagetest.StudentID || children[1].ID != edupagetest.SiblingID {
+		t.Fatalf("expected children %v, got %+v", edupagetest.ChildIDs, children)
+	}
+
+	ids, err := client.GetStudentIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("expected 2 student IDs, got %v", ids)
+	}
+
+	monday := time.Date(2024, time.September, 2, 0, 0, 0, 0, time.UTC)
+	err = client.WithChild(context.Background(), edupagetest.SiblingID, func() error {
+		id, err := client.GetStudentID()
+		if err != nil {
+			return err
+		}
+		if id != edupagetest.SiblingID {
+			t.Errorf("expected student ID %s, got %s", edupagetest.SiblingID, id)
+		}
+
+		timetable, err := client.GetTimetable(monday, monday.AddDate(0, 0, 6))
+		if err != nil {
+			return err
+		}
+		if len(timetable.Days) != 5 {
+			t.Errorf("expected the timetable of the child, got %d days", len(timetable.Days))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.ActiveChild() != edupagetest.SiblingID {
+		t.Errorf("expected edupage to switch to %s, got %s", edupagetest.SiblingID, fake.ActiveChild())
+	}
+	if active, _ := client.ActiveChild(); active != edupagetest.SiblingID {
+		t.Errorf("expected the active child %s, got %s", edupagetest.SiblingID, active)
+	}
+
+	if err := client.SwitchChild("1002"); !errors.Is(err, ErrorNotFound) {
+		t.Errorf("expected ErrorNotFound for a student of another parent, got %v", err)
+	}
+
+	// The calls for the same child don't wait for each other
+	started := make(chan struct{})
+	err = client.WithChild(context.Background(), edupagetest.SiblingID, func() error {
+		go func() {
+			_ = client.WithChild(context.Background(), edupagetest.SiblingID, func() error {
+				close(started)
+				return nil
+			})
+		}()
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Error("expected the calls for the same child to run concurrently")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The user model of the child couldn't be retrieved, the child is switched to again
+	fake.Fail("/user/", 1)
+	if err := client.SwitchChild(edupagetest.StudentID); err == nil {
+		t.Error("expected the switch to fail")
+	}
+	switches := fake.Requests("/login/switchchild")
+	if err := client.SwitchChild(edupagetest.StudentID); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Requests("/login/switchchild") != switches+1 {
+		t.Error("expected the failed switch to be made again")
+	}
+	if active, _ := client.ActiveChild(); active != edupagetest.StudentID {
+		t.Errorf("expected the active child %s, got %s", edupagetest.StudentID, active)
+	}
+
+	student := fakeClient(t)
+	if _, err := student.GetChildren(); !errors.Is(err, ErrorNotParent) {
+		t.Errorf("expected ErrorNotParent, got %v", err)
+	}
+	if err := student.WithChild(context.Background(), edupagetest.SiblingID, func() error { return nil }); !errors.Is(err, ErrorNotParent) {
+		t.Errorf("expected ErrorNotParent, got %v", err)
+	}
+}
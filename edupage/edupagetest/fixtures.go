@@ -0,0 +1,517 @@
+package edupagetest
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// StudentID is the student ID of the fake user.
+	StudentID = "1001"
+	// UserID is the user ID of the fake user.
+	UserID = "Student1001"
+	// ClassID is the class of the fake user.
+	ClassID = "11"
+	// ParentID is the parent ID of the fake user's parent.
+	ParentID = "501"
+	// SiblingID is the student ID of the fake user's sibling, the second child of the parent.
+	SiblingID = "1003"
+)
+
+// ChildIDs are the student IDs of the parent's children.
+var ChildIDs = []string{StudentID, SiblingID}
+
+func stringed(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func timestamp(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func defaultUser(s *Server) map[string]interface{} {
+	periods := map[string]interface{}{}
+	for i, p := range [][2]string{
+		{"08:00", "08:45"},
+		{"08:55", "09:40"},
+		{"10:00", "10:45"},
+		{"10:55", "11:40"},
+		{"11:50", "12:35"},
+		{"12:45", "13:30"},
+	} {
+		id := string(rune('1' + i))
+		periods[id] = map[string]interface{}{
+			"id":        id,
+			"starttime": p[0],
+			"endtime":   p[1],
+			"name":      id + ".",
+			"short":     id,
+		}
+	}
+
+	return map[string]interface{}{
+		"_edubar": map[string]interface{}{
+			"selectedUser": UserID,
+		},
+		"items": []interface{}{},
+		"dbi": map[string]interface{}{
+			"teachers": map[string]interface{}{
+				"201": map[string]interface{}{"id": "201", "firstname": "Eva", "lastname": "Svobodová", "short": "SE", "gender": "F", "classroomid": "401"},
+				"202": map[string]interface{}{"id": "202", "firstname": "Petr", "lastname": "Dvořák", "short": "DP", "gender": "M", "classroomid": "402"},
+			},
+			"classes": map[string]interface{}{
+				ClassID: map[string]interface{}{"id": ClassID, "name": "4.A", "short": "4.A", "grade": "4", "teacherid": "201", "classroomid": "401"},
+			},
+			"subjects": map[string]interface{}{
+				"301": map[string]interface{}{"id": "301", "name": "Matematika", "short": "M"},
+				"302": map[string]interface{}{"id": "302", "name": "Český jazyk", "short": "ČJ"},
+				"303": map[string]interface{}{"id": "303", "name": "Fyzika", "short": "F"},
+			},
+			"classrooms": map[string]interface{}{
+				"401": map[string]interface{}{"id": "401", "name": "Učebna 12", "short": "12"},
+				"402": map[string]interface{}{"id": "402", "name": "Laboratoř", "short": "LAB"},
+			},
+			"students": map[string]interface{}{
+				StudentID: map[string]interface{}{"id": StudentID, "classroomid": ClassID, "firstname": s.Firstname, "lastname": s.Lastname, "parent1id": ParentID, "gender": "M", "numberinclass": "12"},
+				"1002":    map[string]interface{}{"id": "1002", "classroomid": ClassID, "firstname": "Marie", "lastname": "Černá", "gender": "F", "numberinclass": "3"},
+				SiblingID: map[string]interface{}{"id": SiblingID, "classroomid": ClassID, "firstname": "Tomáš", "lastname": s.Lastname, "parent2id": ParentID, "gender": "M", "numberinclass": "13"},
+			},
+			"parents": map[string]interface{}{
+				ParentID: map[string]interface{}{"id": ParentID, "firstname": "Pavel", "lastname": s.Lastname, "gender": "M"},
+			},
+			"periods": periods,
+			"absenttypes": map[string]interface{}{
+				"1": map[string]interface{}{"id": "1", "name": "Nemoc", "short": "N"},
+			},
+			"substitutiontypes": map[string]interface{}{
+				"1": map[string]interface{}{"id": "1", "name": "Suplování", "short": "S"},
+				"2": map[string]interface{}{"id": "2", "name": "Odpadá", "short": "O"},
+			},
+			"studentabsenttypes": map[string]interface{}{
+				"1": map[string]interface{}{"id": "1", "name": "Omluvená", "short": "O", "color": "#00ff00", "excusetype": "ok"},
+				"2": map[string]interface{}{"id": "2", "name": "Neomluvená", "short": "N", "color": "#ff0000", "excusetype": "no"},
+			},
+			"isstudentadult": false,
+		},
+		"userrow": map[string]interface{}{
+			"UserID":       UserID,
+			"StudentID":    StudentID,
+			"p_meno":       s.Firstname,
+			"p_priezvisko": s.Lastname,
+			"p_mail":       s.Username + "@example.com",
+			"TriedaID":     ClassID,
+		},
+		"eventtypes":   []interface{}{},
+		"usergroups":   []string{},
+		"dp":           map[string]interface{}{"dates": map[string]interface{}{}},
+		"meninyDnes":   "Jan",
+		"meninyZajtra": "Eva",
+	}
+}
+
+// defaultParent is the user of the parent, sharing the school data with the fake user.
+func defaultParent(s *Server) map[string]interface{} {
+	parent := defaultUser(s)
+	parent["_edubar"] = map[string]interface{}{
+		"selectedUser": "Rodic" + ParentID,
+	}
+	parent["userrow"] = map[string]interface{}{
+		"UserID":       "Rodic" + ParentID,
+		"StudentID":    StudentID,
+		"p_meno":       "Pavel",
+		"p_priezvisko": s.Lastname,
+		"p_mail":       s.ParentUsername + "@example.com",
+	}
+	return parent
+}
+
+func defaultTimeline() []map[string]interface{} {
+	now := time.Now()
+	message := now.AddDate(0, 0, -3)
+	reply := message.Add(2 * time.Hour)
+	answer := reply.Add(time.Hour)
+	homework := now.AddDate(0, 0, -1)
+	grade := now.AddDate(0, 0, -5)
+	poll := now.AddDate(0, 0, -2)
+
+	return []map[string]interface{}{
+		{
+			"timelineid":       "100001",
+			"timestamp":        timestamp(message),
+			"reakcia_na":       "",
+			"typ":              "sprava",
+			"user":             "Ucitel201",
+			"target_user":      UserID,
+			"user_meno":        "Eva Svobodová",
+			"ineid":            "",
+			"text":             "Zítra nezapomeňte učebnici.",
+			"cas_pridania":     timestamp(message),
+			"cas_udalosti":     timestamp(message),
+			"data":             stringed(map[string]interface{}{"messageContent": "Zítra nezapomeňte učebnici.", "attachements": map[string]interface{}{"/elearning/?cmd=EtestCreator&akcia=download&id=1": "ucebnice.pdf"}}),
+			"vlastnik":         "Ucitel201",
+			"vlastnik_meno":    "Eva Svobodová",
+			"poct_reakcii":     1,
+			"posledna_reakcia": timestamp(reply),
+			"pomocny_zaznam":   "",
+			"removed":          "0",
+			"cas_pridania_btc": timestamp(message),
+			"cas_udalosti_btc": timestamp(reply),
+		},
+		{
+			"timelineid":       "100002",
+			"timestamp":        timestamp(reply),
+			"reakcia_na":       "100001",
+			"typ":              "sprava",
+			"user":             "Ucitel201",
+			"target_user":      "Ucitel201",
+			"user_meno":        "Jan Novák",
+			"ineid":            "",
+			"text":             "Děkuji, nezapomenu.",
+			"cas_pridania":     timestamp(reply),
+			"cas_udalosti":     timestamp(reply),
+			"data":             stringed(map[string]interface{}{"messageContent": "Děkuji, nezapomenu."}),
+			"vlastnik":         UserID,
+			"vlastnik_meno":    "Jan Novák",
+			"poct_reakcii":     0,
+			"posledna_reakcia": "",
+			"pomocny_zaznam":   "",
+			"removed":          "0",
+			"cas_pridania_btc": timestamp(reply),
+			"cas_udalosti_btc": timestamp(reply),
+		},
+		{
+			"timelineid":       "100006",
+			"timestamp":        timestamp(answer),
+			"reakcia_na":       "100002",
+			"typ":              "sprava",
+			"user":             UserID,
+			"target_user":      UserID,
+			"user_meno":        "Eva Svobodová",
+			"ineid":            "",
+			"text":             "Výborně.",
+			"cas_pridania":     timestamp(answer),
+			"cas_udalosti":     timestamp(answer),
+			"data":             stringed(map[string]interface{}{"messageContent": "Výborně."}),
+			"vlastnik":         "Ucitel201",
+			"vlastnik_meno":    "Eva Svobodová",
+			"poct_reakcii":     0,
+			"posledna_reakcia": "",
+			"pomocny_zaznam":   "",
+			"removed":          "0",
+			"cas_pridania_btc": timestamp(answer),
+			"cas_udalosti_btc": timestamp(answer),
+		},
+		{
+			"timelineid":       "100003",
+			"timestamp":        timestamp(homework),
+			"reakcia_na":       "",
+			"typ":              "homework",
+			"user":             "StudentOnly" + StudentID,
+			"target_user":      "",
+			"user_meno":        "Petr Dvořák",
+			"ineid":            "",
+			"text":             "Pracovní list: pohyb",
+			"cas_pridania":     timestamp(homework),
+			"cas_udalosti":     timestamp(homework.AddDate(0, 0, 7)),
+			"data":             stringed(map[string]interface{}{"nazov": "Pracovní list: pohyb", "predmetid": "303", "superid": "5001", "etestCards": 1}),
+			"vlastnik":         "Ucitel202",
+			"vlastnik_meno":    "Petr Dvořák",
+			"poct_reakcii":     0,
+			"posledna_reakcia": "",
+			"pomocny_zaznam":   "",
+			"removed":          "0",
+			"cas_pridania_btc": timestamp(homework),
+			"cas_udalosti_btc": timestamp(homework),
+		},
+		{
+			"timelineid":       "100004",
+			"timestamp":        timestamp(grade),
+			"reakcia_na":       "",
+			"typ":              "znamka",
+			"user":             "Student" + StudentID,
+			"target_user":      "",
+			"user_meno":        "Eva Svobodová",
+			"ineid":            "",
+			"text":             "Matematika: 1",
+			"cas_pridania":     timestamp(grade),
+			"cas_udalosti":     timestamp(grade),
+			"data":             stringed(map[string]interface{}{"predmetid": "301", "znamka": "1", "udalostid": "60001"}),
+			"vlastnik":         "Ucitel201",
+			"vlastnik_meno":    "Eva Svobodová",
+			"poct_reakcii":     0,
+			"posledna_reakcia": "",
+			"pomocny_zaznam":   "",
+			"removed":          "0",
+			"cas_pridania_btc": timestamp(grade),
+			"cas_udalosti_btc": timestamp(grade),
+		},
+		{
+			"timelineid":   "100005",
+			"timestamp":    timestamp(poll),
+			"reakcia_na":   "",
+			"typ":          "sprava",
+			"user":         "Ucitel201",
+			"target_user":  UserID,
+			"user_meno":    "Eva Svobodová",
+			"ineid":        "",
+			"text":         "Kam pojedeme na výlet?",
+			"cas_pridania": timestamp(poll),
+			"cas_udalosti": timestamp(poll),
+			"data": stringed(map[string]interface{}{
+				"messageContent": "Kam pojedeme na výlet?",
+				"receipt":        "1",
+				"attachements":   []interface{}{},
+				"votingParams": stringed(map[string]interface{}{
+					"answers":  []map[string]string{{"id": "a1", "text": "Praha"}, {"id": "a2", "text": "Brno"}},
+					"multiple": false,
+				}),
+			}),
+			"vlastnik":         "Ucitel201",
+			"vlastnik_meno":    "Eva Svobodová",
+			"poct_reakcii":     0,
+			"posledna_reakcia": "",
+			"pomocny_zaznam":   "",
+			"removed":          "0",
+			"cas_pridania_btc": timestamp(poll),
+			"cas_udalosti_btc": timestamp(poll),
+		},
+	}
+}
+
+func defaultHomeworks() []map[string]interface{} {
+	created := time.Now().AddDate(0, 0, -1)
+	due := created.AddDate(0, 0, 7)
+
+	return []map[string]interface{}{
+		{
+			"hwkid":             "hwk5001",
+			"homeworkid":        "5001",
+			"e_superid":         "5001",
+			"userid":            "Ucitel202",
+			"predmetid":         "303",
+			"planid":            "",
+			"name":              "Pracovní list: pohyb",
+			"details":           "Vyplňte pracovní list do příští hodiny.",
+			"dateto":            due.Format("2006-01-02"),
+			"datefrom":          created.Format("2006-01-02"),
+			"datetimeto":        timestamp(due),
+			"datetimefrom":      timestamp(created),
+			"datecreated":       timestamp(created),
+			"period":            nil,
+			"timestamp":         timestamp(created),
+			"testid":            "7001",
+			"typ":               "etestHomework",
+			"pocet_like":        "0",
+			"pocet_reakcii":     "0",
+			"pocet_done":        "0",
+			"stav":              "",
+			"posledny_vysledok": "",
+			"skupiny":           []string{""},
+			"etestCards":        1,
+			"etestAnswerCards":  0,
+			"studyTopics":       nil,
+			"znamky_udalostid":  nil,
+			"students_hidden":   "",
+			"data":              stringed(map[string]interface{}{}),
+			"skoncil":           nil,
+			"missingNextLesson": false,
+			"attachements":      nil,
+			"autor_meno":        "Petr Dvořák",
+			"predmet_meno":      "Fyzika",
+		},
+	}
+}
+
+func defaultResults() map[string]interface{} {
+	first := time.Now().AddDate(0, 0, -20)
+	second := time.Now().AddDate(0, 0, -5)
+
+	event := func(id, subject, name, weight string, date time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"provider":          "edupage",
+			"udalostID":         id,
+			"predmetid":         subject,
+			"mesiac":            date.Format("2006-01"),
+			"datum":             date.Format("2006-01-02"),
+			"ucitelid":          "201",
+			"p_meno":            name,
+			"p_vaha":            weight,
+			"p_typ_udalosti":    "1",
+			"p_najskor_priemer": "",
+			"TriedaID":          ClassID,
+			"planid":            "",
+			"p_pocet_znamok":    "1",
+			"moredata":          nil,
+			"priemer":           "",
+		}
+	}
+
+	grade := func(id, event, subject, value string, date time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"provider":        "edupage",
+			"znamkaid":        id,
+			"udalostid":       event,
+			"studentid":       StudentID,
+			"predmetid":       subject,
+			"mesiac":          date.Format("2006-01"),
+			"data":            value,
+			"datum":           date.Format("2006-01-02"),
+			"ucitelid":        "201",
+			"podpisane":       "",
+			"podpisane_rodic": "",
+			"timestamp":       timestamp(date),
+			"stav":            "",
+		}
+	}
+
+	return map[string]interface{}{
+		"vsetkyUdalosti": map[string]interface{}{
+			"edupage": map[string]interface{}{
+				"60001": event("60001", "301", "Písemka: zlomky", "2", second),
+				"60002": event("60002", "302", "Diktát", "1", first),
+			},
+		},
+		"vsetkyZnamky": []interface{}{
+			grade("70001", "60001", "301", "1", second),
+			grade("70002", "60002", "302", "3", first),
+		},
+		"vsetkyVcelicky": []interface{}{
+			map[string]interface{}{
+				"VcelickaID": "80001",
+				"p_datum":    first.Format("2006-01-02"),
+				"p_text":     "Pomoc spolužákům",
+				"p_typ":      "pochvala",
+				"PredmetID":  "301",
+			},
+		},
+	}
+}
+
+func defaultLessons() [][]map[string]interface{} {
+	lesson := func(period, subject, teacher, classroom string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":            "lesson",
+			"uniperiod":       period,
+			"starttime":       "",
+			"endtime":         "",
+			"subjectid":       subject,
+			"classids":        []string{ClassID},
+			"groupnames":      []string{""},
+			"igroupid":        "",
+			"teacherids":      []string{teacher},
+			"classroomids":    []string{classroom},
+			"studentids":      []string{},
+			"colors":          []string{"#a0c4ff"},
+			"durationperiods": 1,
+		}
+	}
+
+	day := func(subjects ...string) []map[string]interface{} {
+		lessons := make([]map[string]interface{}, len(subjects))
+		for i, subject := range subjects {
+			teacher, classroom := "201", "401"
+			if subject == "303" {
+				teacher, classroom = "202", "402"
+			}
+			lessons[i] = lesson(string(rune('1'+i)), subject, teacher, classroom)
+		}
+		return lessons
+	}
+
+	return [][]map[string]interface{}{
+		day("301", "302", "303", "302"),
+		day("302", "301", "301", "303"),
+		day("303", "303", "302", "301"),
+		day("301", "302", "302"),
+		day("302", "301", "303"),
+	}
+}
+
+// monday returns the monday of the week of the day, shifted by the weeks.
+func monday(day time.Time, weeks int) time.Time {
+	return day.AddDate(0, 0, -int(day.Weekday()+6)%7+7*weeks)
+}
+
+// defaultAbsences are on the monday of the last week, an excused and an unexcused absence and a late arrival.
+func defaultAbsences() []map[string]interface{} {
+	day := monday(time.Now(), -1).Format("2006-01-02")
+
+	absence := func(id, period, subject, typeID string, late int) map[string]interface{} {
+		return map[string]interface{}{
+			"id":                   id,
+			"studentid":            StudentID,
+			"date":                 day,
+			"uniperiod":            period,
+			"subjectid":            subject,
+			"studentabsent_typeid": typeID,
+			"late_minutes":         late,
+			"note":                 "",
+		}
+	}
+
+	return []map[string]interface{}{
+		absence("90001", "1", "301", "1", 0),
+		absence("90002", "2", "302", "2", 0),
+		absence("90003", "3", "303", "", 10),
+	}
+}
+
+// defaultSubstitutions change the lessons of the monday of the next week, see defaultLessons.
+func defaultSubstitutions() []map[string]interface{} {
+	day := monday(time.Now(), 1).Format("2006-01-02")
+
+	substitution := func(id, period, subject, typeID string, teachers, classrooms []string, removed bool) map[string]interface{} {
+		return map[string]interface{}{
+			"id":                  id,
+			"date":                day,
+			"uniperiod":           period,
+			"classids":            []string{ClassID},
+			"subjectid":           subject,
+			"teacherids":          teachers,
+			"classroomids":        classrooms,
+			"substitution_typeid": typeID,
+			"removed":             removed,
+			"note":                "",
+		}
+	}
+
+	return []map[string]interface{}{
+		substitution("95001", "1", "301", "1", []string{"202"}, []string{}, false),
+		substitution("95002", "3", "303", "1", []string{}, []string{"401"}, false),
+		substitution("95003", "4", "302", "2", []string{}, []string{}, true),
+		substitution("95004", "5", "301", "1", []string{"201"}, []string{"401"}, false),
+		// Another class, the fake user's class isn't changed
+		map[string]interface{}{"id": "95005", "date": day, "uniperiod": "1", "classids": []string{"12"}, "removed": true},
+	}
+}
+
+func defaultMenu() map[string]interface{} {
+	return map[string]interface{}{
+		"vydaj_od":     "11:30",
+		"vydaj_do":     "14:00",
+		"drugov_jedal": "1",
+		"isCooking":    true,
+		"isChoosable":  false,
+		"rows": []interface{}{
+			map[string]interface{}{
+				"nazov":        "Polévka hovězí s nudlemi",
+				"alergenyStr":  "1, 3, 9",
+				"hmotnostiStr": "250",
+			},
+			map[string]interface{}{
+				"nazov":        "Kuřecí řízek, bramborová kaše",
+				"alergenyStr":  "1, 3, 7",
+				"hmotnostiStr": "150",
+			},
+		},
+		"evidencia": map[string]interface{}{"stav": "A"},
+	}
+}
+
+// defaultFiles contains the attachment of message 100001, a small pdf.
+func defaultFiles() map[string][]byte {
+	return map[string][]byte{
+		"/elearning/?cmd=EtestCreator&akcia=download&id=1": []byte("%PDF-1.4\n%ucebnice\n1 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n"),
+	}
+}
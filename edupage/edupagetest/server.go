@@ -0,0 +1,763 @@
+// Package edupagetest provides an in-process fake of the edupage servers,
+// so the edupage client and the api routes can be tested without live credentials.
+//
+//	srv := edupagetest.NewServer()
+//	defer srv.Close()
+//
+//	credentials, err := edupage.LoginWithOptions(srv.Username, srv.Password, srv.School, edupage.LoginOptions{BaseURL: srv.URL})
+package edupagetest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sessionCookie = "PHPSESSID"
+
+// MaxUploadSize is the size limit of the files uploaded to the fake server.
+const MaxUploadSize = 5 << 20
+
+// GSecHash is the gsechash embedded in the /user/ page of the fake server.
+const GSecHash = "fa4e1b2c"
+
+// Server is a fake edupage server. All schools are served by the same server,
+// the school is determined using the Host header of the request.
+//
+// The data returned by the server can be changed using the exported fields
+// before the client requests them.
+type Server struct {
+	*httptest.Server
+
+	School    string
+	Username  string
+	Password  string
+	Firstname string
+	Lastname  string
+
+	// ParentUsername and ParentPassword log in to the parent of the fake user, see ParentID and ChildIDs.
+	ParentUsername string
+	ParentPassword string
+
+	// User is the payload of the userhome(...) call on the /user/ page.
+	User map[string]interface{}
+	// Parent is the payload of the userhome(...) call for the parent,
+	// its StudentID is set to the active child on request.
+	Parent map[string]interface{}
+	// Timeline contains the timeline items, filtered by cas_pridania on request.
+	Timeline []map[string]interface{}
+	// Homeworks contains the homeworks returned with the timeline.
+	Homeworks []map[string]interface{}
+	// Results is the "data" part of the grades response.
+	Results map[string]interface{}
+	// Lessons contains the lessons of each weekday, starting with monday.
+	Lessons [][]map[string]interface{}
+	// Absences contains the attendance records of the students, filtered by the student and the date on request.
+	Absences []map[string]interface{}
+	// Substitutions contains the substitutions of the school, filtered by the date on request.
+	Substitutions []map[string]interface{}
+	// Menu contains the canteen day template, the day is repeated for every workday.
+	Menu map[string]interface{}
+	// Files contains the downloadable attachments by their url, relative to the server.
+	// The uploaded files are served as well.
+	Files map[string][]byte
+	// Latency delays every response, so the concurrent requests of the clients overlap.
+	Latency time.Duration
+
+	mu            sync.Mutex
+	sessions      map[string]*session
+	messages      []url.Values
+	confirmations []url.Values
+	// uploads are the contents of the uploaded files, by their path
+	uploads map[string][]byte
+	// activeChild is the child last switched to by a parent
+	activeChild string
+	// requests counts the requests by their path
+	requests map[string]int
+	// failures are the numbers of the next requests of the paths which fail, see Fail
+	failures map[string]int
+}
+
+// NewServer starts a new fake edupage server, filled with a small school.
+// The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		School:    "fakeschool",
+		Username:  "jan.novak",
+		Password:  "heslo123",
+		Firstname: "Jan",
+		Lastname:  "Novák",
+
+		ParentUsername: "pavel.novak",
+		ParentPassword: "heslo456",
+
+		sessions: make(map[string]*session),
+		uploads:  make(map[string][]byte),
+		requests: make(map[string]int),
+		failures: make(map[string]int),
+	}
+	s.User = defaultUser(s)
+	s.Parent = defaultParent(s)
+	s.Timeline = defaultTimeline()
+	s.Homeworks = defaultHomeworks()
+	s.Results = defaultResults()
+	s.Lessons = defaultLessons()
+	s.Absences = defaultAbsences()
+	s.Substitutions = defaultSubstitutions()
+	s.Menu = defaultMenu()
+	s.Files = defaultFiles()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/edubarLogin.php", s.handleLogin)
+	mux.HandleFunc("/login/eauth", s.authorized(s.handlePing))
+	mux.HandleFunc("/login/switchchild", s.authorized(s.handleSwitchChild))
+	mux.HandleFunc("/user/", s.authorized(s.handleUser))
+	mux.HandleFunc("/timeline/", s.authorized(s.handleTimeline))
+	mux.HandleFunc("/znamky/", s.authorized(s.handleResults))
+	mux.HandleFunc("/timetable/server/currenttt.js", s.authorized(s.handleTimetable))
+	mux.HandleFunc("/dashboard/server/attendance.js", s.authorized(s.handleAttendance))
+	mux.HandleFunc("/substitution/server/viewer.js", s.authorized(s.handleSubstitutions))
+	mux.HandleFunc("/menu/", s.authorized(s.handleMenu))
+	mux.HandleFunc("/cloud/", s.authorized(s.handleFile))
+	mux.HandleFunc("/elearning/", s.authorized(s.handleFile))
+
+	s.Server = httptest.NewServer(s.counted(mux))
+	return s
+}
+
+// Host returns the edupage host of the fake school.
+func (s *Server) Host() string {
+	return s.School + ".edupage.org"
+}
+
+// Name returns the full name of the fake user, as returned by the login route.
+func (s *Server) Name() string {
+	return s.Firstname + " " + s.Lastname
+}
+
+// Messages returns the decoded forms of all messages created on the server.
+func (s *Server) Messages() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.messages...)
+}
+
+// Confirmations returns the decoded forms of all confirmations of timeline items, e.g. likes and votes.
+func (s *Server) Confirmations() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.confirmations...)
+}
+
+// Upload returns the content of the file uploaded to the path.
+func (s *Server) Upload(path string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.uploads[path]
+	return content, ok
+}
+
+// ExpireSessions logs out every client logged in to the server.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]*session)
+}
+
+// ActiveChild returns the child selected in the sessions of the parent, the last switched to one.
+func (s *Server) ActiveChild() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeChild
+}
+
+// Requests returns the number of requests made to the path, e.g. "/znamky/".
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Fail makes the next n requests of the path, e.g. "/user/", fail with an internal server error.
+func (s *Server) Fail(path string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = n
+}
+
+// counted counts the requests by their path, delays them by the latency and fails them, see Fail.
+func (s *Server) counted(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		latency := s.Latency
+		fail := s.failures[r.URL.Path] > 0
+		if fail {
+			s.failures[r.URL.Path]--
+		}
+		s.mu.Unlock()
+
+		time.Sleep(latency)
+		if fail {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// session is a logged in client of the server.
+type session struct {
+	parent bool
+	child  string
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := r.PostFormValue("username")
+	parent := username == s.ParentUsername && s.ParentUsername != ""
+
+	// login1 is the shared login server, it redirects to the school of the user
+	if r.Host != s.Host() {
+		if username != s.Username && !parent {
+			http.Redirect(w, r, "/login/?msg=badlogin", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "https://"+s.Host()+"/login/?username="+url.QueryEscape(username), http.StatusFound)
+		return
+	}
+
+	password := r.PostFormValue("password")
+	if !(username == s.Username && password == s.Password) && !(parent && password == s.ParentPassword) {
+		http.Redirect(w, r, "/login/?msg=badlogin", http.StatusFound)
+		return
+	}
+
+	id := randomID()
+	s.mu.Lock()
+	s.sessions[id] = &session{parent: parent, child: StudentID}
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/"})
+	http.Redirect(w, r, "/user/", http.StatusFound)
+}
+
+// authorized rejects requests without a valid session the same way edupage does,
+// by redirecting them to the login page.
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.loggedIn(r) {
+			if r.URL.Path == "/login/eauth" {
+				fmt.Fprint(w, "notlogged")
+				return
+			}
+			http.Redirect(w, r, "/login/", http.StatusFound)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) loggedIn(r *http.Request) bool {
+	return s.session(r) != nil
+}
+
+func (s *Server) session(r *http.Request) *session {
+	if r.Host != s.Host() {
+		return nil
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[cookie.Value]
+}
+
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, "OK")
+}
+
+func (s *Server) handleSwitchChild(w http.ResponseWriter, r *http.Request) {
+	current := s.session(r)
+	id := r.URL.Query().Get("studid")
+	if !current.parent || !slices.Contains(ChildIDs, id) {
+		fmt.Fprint(w, "ERROR")
+		return
+	}
+
+	s.mu.Lock()
+	current.child = id
+	s.activeChild = id
+	s.mu.Unlock()
+	fmt.Fprint(w, "OK")
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	current := s.session(r)
+
+	s.mu.Lock()
+	payload := s.User
+	if current.parent {
+		payload = make(map[string]interface{}, len(s.Parent))
+		for k, v := range s.Parent {
+			payload[k] = v
+		}
+		userrow := make(map[string]interface{})
+		for k, v := range s.Parent["userrow"].(map[string]interface{}) {
+			userrow[k] = v
+		}
+		userrow["StudentID"] = current.child
+		payload["userrow"] = userrow
+	}
+	user, err := json.Marshal(payload)
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<html><head><script>ASC.gsechash=\"%s\";</script></head>\n", GSecHash)
+	fmt.Fprintf(w, "<body><script>$j(document).ready(function() {\nASC.userhome(%s);\n});</script></body></html>", user)
+}
+
+func (s *Server) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("akcia") {
+	case "getData":
+		form, err := decodePayload(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		from, _ := time.Parse("2006-01-02", form.Get("datefrom"))
+		to, _ := time.Parse("2006-01-02", form.Get("dateto"))
+		to = to.AddDate(0, 0, 1)
+
+		s.mu.Lock()
+		items := make([]map[string]interface{}, 0, len(s.Timeline))
+		for _, item := range s.Timeline {
+			added, _ := time.Parse("2006-01-02 15:04:05", fmt.Sprint(item["cas_pridania"]))
+			if !added.Before(from) && added.Before(to) {
+				items = append(items, item)
+			}
+		}
+		homeworks := s.Homeworks
+		s.mu.Unlock()
+
+		writeEncoded(w, map[string]interface{}{
+			"timelineItems": items,
+			"homeworks":     homeworks,
+		})
+	case "createItem":
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		if target := r.PostForm.Get("reakcia_na"); target != "" && s.timelineItem(target) == nil {
+			s.mu.Unlock()
+			writeJSON(w, map[string]interface{}{"status": "fail", "error": "item not found"})
+			return
+		}
+		s.messages = append(s.messages, r.PostForm)
+		id := fmt.Sprint(900000 + len(s.messages))
+		s.mu.Unlock()
+
+		writeJSON(w, map[string]interface{}{
+			"status":  "ok",
+			"changes": []interface{}{map[string]interface{}{"timelineid": id}},
+		})
+	case "uploadAtt":
+		if err := r.ParseMultipartForm(MaxUploadSize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("att")
+		if err != nil {
+			writeJSON(w, map[string]interface{}{"status": "fail", "error": "no file"})
+			return
+		}
+		defer file.Close()
+
+		content, err := io.ReadAll(io.LimitReader(file, MaxUploadSize+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(content) == 0 || len(content) > MaxUploadSize {
+			writeJSON(w, map[string]interface{}{"status": "fail", "error": "invalid file size"})
+			return
+		}
+
+		id := randomID()
+		attachment := map[string]interface{}{
+			"cloudid":   id,
+			"extension": strings.TrimPrefix(path.Ext(header.Filename), "."),
+			"type":      http.DetectContentType(content),
+			"file":      "/cloud/" + id + "/" + url.PathEscape(header.Filename),
+			"name":      header.Filename,
+		}
+
+		s.mu.Lock()
+		s.uploads[fmt.Sprint(attachment["file"])] = content
+		s.mu.Unlock()
+
+		writeJSON(w, map[string]interface{}{"status": "ok", "data": attachment})
+	case "createConfirmation":
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		target := s.timelineItem(r.PostForm.Get("timelineid"))
+		if target == nil {
+			writeJSON(w, map[string]interface{}{"status": "fail", "error": "item not found"})
+			return
+		}
+		if fmt.Sprint(target["removed"]) == "1" {
+			writeJSON(w, map[string]interface{}{"status": "fail", "error": "item removed"})
+			return
+		}
+		done := r.PostForm.Get("confirmType") == "done"
+		if done && fmt.Sprint(target["typ"]) != "homework" {
+			writeJSON(w, map[string]interface{}{"status": "fail", "error": "not a homework"})
+			return
+		}
+		s.confirmations = append(s.confirmations, r.PostForm)
+		if done {
+			s.markHomeworkDone(target)
+		}
+
+		writeJSON(w, map[string]interface{}{
+			"status":  "ok",
+			"changes": []interface{}{map[string]interface{}{"timelineid": target["timelineid"]}},
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleFile serves the attachments with an ETag, supporting range and conditional requests like edupage.
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	uri := r.URL.RequestURI()
+	s.mu.Lock()
+	content, ok := s.uploads[uri]
+	s.mu.Unlock()
+	if !ok {
+		content, ok = s.Files[uri]
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	http.ServeContent(w, r, path.Base(r.URL.Path), time.Time{}, bytes.NewReader(content))
+}
+
+// markHomeworkDone marks the homework of the timeline item done, the lock must be held.
+// The homeworks are copied, so the responses which are being written aren't changed.
+func (s *Server) markHomeworkDone(item map[string]interface{}) {
+	var data struct {
+		SuperID string `json:"superid"`
+	}
+	_ = json.Unmarshal([]byte(fmt.Sprint(item["data"])), &data)
+
+	homeworks := make([]map[string]interface{}, 0, len(s.Homeworks))
+	for _, homework := range s.Homeworks {
+		if fmt.Sprint(homework["e_superid"]) == data.SuperID && homework["stav"] != "done" {
+			done := make(map[string]interface{}, len(homework))
+			for key, value := range homework {
+				done[key] = value
+			}
+			count, _ := strconv.Atoi(fmt.Sprint(homework["pocet_done"]))
+			done["pocet_done"] = strconv.Itoa(count + 1)
+			done["stav"] = "done"
+			homework = done
+		}
+		homeworks = append(homeworks, homework)
+	}
+	s.Homeworks = homeworks
+}
+
+// timelineItem returns the timeline item with the ID, the lock must be held.
+func (s *Server) timelineItem(id string) map[string]interface{} {
+	for _, item := range s.Timeline {
+		if fmt.Sprint(item["timelineid"]) == id {
+			return item
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
+	if _, err := decodePayload(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeEncoded(w, map[string]interface{}{
+		"status": "ok",
+		"data":   s.Results,
+	})
+}
+
+// rpcArgs decodes the arguments of a call to a server function, e.g. the timetable.
+func rpcArgs(r *http.Request, args interface{}) error {
+	var request struct {
+		Args []json.RawMessage `json:"__args"`
+		GSH  string            `json:"__gsh"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Args) < 2 {
+		return errors.New("invalid request")
+	}
+	return json.Unmarshal(request.Args[1], args)
+}
+
+// inRange reports whether the date of the record is in the interval, the dates are formatted as 2006-01-02.
+func inRange(record map[string]interface{}, from, to string) bool {
+	date, _ := record["date"].(string)
+	return date >= from && date <= to
+}
+
+func (s *Server) handleAttendance(w http.ResponseWriter, r *http.Request) {
+	var args struct {
+		StudentID string `json:"studentid"`
+		DateFrom  string `json:"datefrom"`
+		DateTo    string `json:"dateto"`
+	}
+	if err := rpcArgs(r, &args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Parents only get the attendance of the active child
+	if current := s.session(r); current.parent && args.StudentID != current.child {
+		writeJSON(w, map[string]interface{}{
+			"r": map[string]interface{}{"error": "access denied"},
+		})
+		return
+	}
+
+	s.mu.Lock()
+	absences := []map[string]interface{}{}
+	for _, absence := range s.Absences {
+		if absence["studentid"] == args.StudentID && inRange(absence, args.DateFrom, args.DateTo) {
+			absences = append(absences, absence)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"r": map[string]interface{}{"absences": absences},
+	})
+}
+
+func (s *Server) handleSubstitutions(w http.ResponseWriter, r *http.Request) {
+	var args struct {
+		DateFrom string `json:"datefrom"`
+		DateTo   string `json:"dateto"`
+	}
+	if err := rpcArgs(r, &args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	substitutions := []map[string]interface{}{}
+	for _, substitution := range s.Substitutions {
+		if inRange(substitution, args.DateFrom, args.DateTo) {
+			substitutions = append(substitutions, substitution)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"r": map[string]interface{}{"substitutions": substitutions},
+	})
+}
+
+// timetableFields are the fields of the lessons which contain the ID of the table, the students have all lessons.
+var timetableFields = map[string]string{
+	"students":   "",
+	"classes":    "classids",
+	"teachers":   "teacherids",
+	"classrooms": "classroomids",
+}
+
+// handleTimetable returns the lessons of the student, or of the class, teacher or classroom selected by the table.
+func (s *Server) handleTimetable(w http.ResponseWriter, r *http.Request) {
+	var args struct {
+		DateFrom string `json:"datefrom"`
+		DateTo   string `json:"dateto"`
+		Table    string `json:"table"`
+		ID       string `json:"id"`
+	}
+	if err := rpcArgs(r, &args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	field, ok := timetableFields[args.Table]
+	if !ok {
+		http.Error(w, "unknown table "+args.Table, http.StatusBadRequest)
+		return
+	}
+
+	// Parents only get the timetable of the active child
+	if current := s.session(r); args.Table == "students" && current.parent && args.ID != current.child {
+		writeJSON(w, map[string]interface{}{
+			"r": map[string]interface{}{"error": "access denied"},
+		})
+		return
+	}
+
+	from, err := time.Parse("2006-01-02", args.DateFrom)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := time.Parse("2006-01-02", args.DateTo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	items := []map[string]interface{}{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		weekday := int(day.Weekday()+6) % 7
+		if weekday >= len(s.Lessons) {
+			continue
+		}
+		for _, lesson := range s.Lessons[weekday] {
+			if ids, ok := lesson[field].([]string); field != "" && (!ok || !slices.Contains(ids, args.ID)) {
+				continue
+			}
+			item := make(map[string]interface{}, len(lesson)+1)
+			for k, v := range lesson {
+				item[k] = v
+			}
+			item["date"] = day.Format("2006-01-02")
+			items = append(items, item)
+		}
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"r": map[string]interface{}{"ttitems": items},
+	})
+}
+
+func (s *Server) handleMenu(w http.ResponseWriter, r *http.Request) {
+	date, err := time.Parse("20060102", r.URL.Query().Get("date"))
+	if err != nil {
+		date = time.Now()
+	}
+	monday := date.AddDate(0, 0, -(int(date.Weekday()+6) % 7))
+
+	s.mu.Lock()
+	listok := map[string]interface{}{
+		"addInfo": map[string]interface{}{
+			"kredit":     120.5,
+			"stravnikid": "7001",
+		},
+	}
+	for i := 0; i < 5; i++ {
+		day := monday.AddDate(0, 0, i)
+		menu := make(map[string]interface{}, len(s.Menu)+2)
+		for k, v := range s.Menu {
+			menu[k] = v
+		}
+		menu["prihlas_do"] = day.AddDate(0, 0, -1).Format("2006-01-02") + " 14:00"
+		menu["odhlas_do"] = day.Format("2006-01-02") + " 08:00"
+		listok[day.Format("2006-01-02")] = map[string]interface{}{"2": menu}
+	}
+	s.mu.Unlock()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"csssnina": map[string]interface{}{"novyListok": listok},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<script>$j(document).ready(function() {\nwindow._edubar = {edupageData: %s,\n};\n});</script>", data)
+}
+
+// decodePayload decodes the form created by edupage.CreatePayload.
+func decodePayload(r *http.Request) (url.Values, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	eqap := r.PostForm.Get("eqap")
+	if eqap == "" {
+		return r.PostForm, nil
+	}
+	decoded, err := base64.URLEncoding.DecodeString(eqap)
+	if err != nil {
+		return nil, fmt.Errorf("invalid eqap: %w", err)
+	}
+	return url.ParseQuery(string(decoded))
+}
+
+// writeEncoded writes the value in the "eqz:" base64 envelope used by edupage.
+func writeEncoded(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString("eqz:")
+	buf.WriteString(base64.StdEncoding.EncodeToString(data))
+	w.Write(buf.Bytes())
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return strings.ToLower(hex.EncodeToString(b))
+}
@@ -0,0 +1,66 @@
+package grades
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+// The kinds of the changes of the results.
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeRemoved  = "removed"
+)
+
+// Change is a grade which has been added, modified or removed between two snapshots of the results.
+type Change struct {
+	Kind    string `json:"kind"`
+	EventID string `json:"event_id"`
+	// Before is nil for the added grades
+	Before *model.Event `json:"before"`
+	// After is nil for the removed grades
+	After *model.Event `json:"after"`
+}
+
+// Diff returns the changes of the graded events from before to after, ordered by the event ID.
+// The events without a grade are only compared once they have one, so a grade filled in later is added.
+func Diff(before, after model.Results) []Change {
+	changes := []Change{}
+
+	for id, event := range after.Events {
+		if !graded(event) {
+			continue
+		}
+		previous, ok := before.Events[id]
+		switch {
+		case !ok || !graded(previous):
+			changes = append(changes, Change{Kind: ChangeAdded, EventID: id, After: &event})
+		case gradeState(previous) != gradeState(event):
+			changes = append(changes, Change{Kind: ChangeModified, EventID: id, Before: &previous, After: &event})
+		}
+	}
+
+	for id, event := range before.Events {
+		if !graded(event) {
+			continue
+		}
+		if current, ok := after.Events[id]; !ok || !graded(current) {
+			changes = append(changes, Change{Kind: ChangeRemoved, EventID: id, Before: &event})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].EventID < changes[j].EventID })
+	return changes
+}
+
+// graded reports whether the event has a grade.
+func graded(event model.Event) bool {
+	return event.Data != ""
+}
+
+// gradeState contains the fields of the event which make up the grade, other fields like the signatures are ignored.
+func gradeState(event model.Event) string {
+	return fmt.Sprintf("%s|%v|%s|%s|%s", event.Data, event.Weight, event.EventName, event.Date, event.SubjectID)
+}
@@ -0,0 +1,192 @@
+// Package grades computes the weighted averages, trends and predictions of the results of a student.
+//
+// The grades are converted to the marks of the 1-5 scale, where 1 is the best mark:
+//
+//	summary := grades.Summarize(grades.FromResults(results), time.Now())
+//	needed, ok := summary.Subjects["301"].Needed(1.5, 1)
+package grades
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+// The limits of the marks, BestMark is the best one.
+const (
+	BestMark  = 1.0
+	WorstMark = 5.0
+)
+
+// TrendWindow is the period the Change of the averages is computed over.
+const TrendWindow = 30 * 24 * time.Hour
+
+// The kinds of the grade values.
+const (
+	KindMark    = "mark"
+	KindLetter  = "letter"
+	KindPercent = "percent"
+	KindPoints  = "points"
+)
+
+// letterMarks maps the letter grades to the marks.
+var letterMarks = map[string]float64{
+	"A": 1, "B": 2, "C": 3, "D": 4, "E": 5, "F": 5, "FX": 5,
+}
+
+// percentMarks are the lowest percentages of the marks, the rest is WorstMark.
+var percentMarks = []struct {
+	min  float64
+	mark float64
+}{
+	{90, 1},
+	{75, 2},
+	{50, 3},
+	{30, 4},
+}
+
+// Value is a parsed grade value.
+type Value struct {
+	Raw  string `json:"raw"`
+	Kind string `json:"kind"`
+	// Mark is the value converted to the 1-5 scale
+	Mark float64 `json:"mark"`
+	// Percent is set for the percent and point based values
+	Percent   float64 `json:"percent,omitempty"`
+	Points    float64 `json:"points,omitempty"`
+	MaxPoints float64 `json:"max_points,omitempty"`
+}
+
+// ParseValue parses the grade, e.g. "1", "2-", "B", "85%" or "7/10".
+// Returns false for the values which aren't graded, e.g. "N" for not classified.
+func ParseValue(raw string) (Value, bool) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	if s == "" {
+		return Value{}, false
+	}
+	value := Value{Raw: raw}
+
+	if percent, ok := strings.CutSuffix(s, "%"); ok {
+		p, err := parseNumber(percent)
+		if err != nil || p < 0 {
+			return Value{}, false
+		}
+		value.Kind = KindPercent
+		value.Percent = p
+		value.Mark = percentMark(p)
+		return value, true
+	}
+
+	if points, total, ok := strings.Cut(s, "/"); ok {
+		p, err := parseNumber(points)
+		m, totalErr := parseNumber(total)
+		if err != nil || totalErr != nil || m <= 0 || p < 0 {
+			return Value{}, false
+		}
+		value.Kind = KindPoints
+		value.Points = p
+		value.MaxPoints = m
+		value.Percent = p / m * 100
+		value.Mark = percentMark(value.Percent)
+		return value, true
+	}
+
+	// A minus makes the mark half a grade worse, a plus half a grade better
+	modifier := 0.0
+	if trimmed, ok := strings.CutSuffix(s, "-"); ok && trimmed != "" {
+		s, modifier = trimmed, 0.5
+	} else if trimmed, ok := strings.CutSuffix(s, "+"); ok && trimmed != "" {
+		s, modifier = trimmed, -0.5
+	}
+
+	if mark, ok := letterMarks[s]; ok {
+		value.Kind = KindLetter
+		value.Mark = clamp(mark + modifier)
+		return value, true
+	}
+
+	mark, err := parseNumber(s)
+	if err != nil || mark < BestMark || mark > WorstMark {
+		return Value{}, false
+	}
+	value.Kind = KindMark
+	value.Mark = clamp(mark + modifier)
+	return value, true
+}
+
+func parseNumber(s string) (float64, error) {
+	return strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(s), ",", "."), 64)
+}
+
+func percentMark(percent float64) float64 {
+	for _, limit := range percentMarks {
+		if percent >= limit.min {
+			return limit.mark
+		}
+	}
+	return WorstMark
+}
+
+func clamp(mark float64) float64 {
+	return max(BestMark, min(WorstMark, mark))
+}
+
+// Grade is a graded event of a subject.
+type Grade struct {
+	EventID   string    `json:"event_id"`
+	SubjectID string    `json:"subject_id"`
+	Name      string    `json:"name"`
+	Date      time.Time `json:"date"`
+	Weight    float64   `json:"weight"`
+	Value     Value     `json:"value"`
+}
+
+// FromResults parses the graded events of the results, ordered by their date.
+// The events without a grade or with a zero weight are left out.
+func FromResults(results model.Results) []Grade {
+	grades := make([]Grade, 0, len(results.Events))
+	for id, event := range results.Events {
+		value, ok := ParseValue(event.Data)
+		if !ok {
+			continue
+		}
+		weight := parseWeight(event.Weight)
+		if weight <= 0 {
+			continue
+		}
+		date, _ := time.Parse("2006-01-02", event.Date)
+
+		grades = append(grades, Grade{
+			EventID:   id,
+			SubjectID: event.SubjectID,
+			Name:      event.EventName,
+			Date:      date,
+			Weight:    weight,
+			Value:     value,
+		})
+	}
+
+	sort.Slice(grades, func(i, j int) bool {
+		if !grades[i].Date.Equal(grades[j].Date) {
+			return grades[i].Date.Before(grades[j].Date)
+		}
+		return grades[i].EventID < grades[j].EventID
+	})
+	return grades
+}
+
+// parseWeight parses the weight of the event, which edupage sends as a number or a string. The default weight is 1.
+func parseWeight(weight interface{}) float64 {
+	switch w := weight.(type) {
+	case float64:
+		return w
+	case string:
+		if parsed, err := parseNumber(w); err == nil {
+			return parsed
+		}
+	}
+	return 1
+}
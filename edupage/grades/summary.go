@@ -0,0 +1,114 @@
+package grades
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Point is the weighted average of a subject after a grade.
+type Point struct {
+	Date    time.Time `json:"date"`
+	EventID string    `json:"event_id"`
+	Average float64   `json:"average"`
+}
+
+// SubjectSummary contains the weighted average of the grades of a subject and its development.
+type SubjectSummary struct {
+	SubjectID string  `json:"subject_id"`
+	Average   float64 `json:"average"`
+	Count     int     `json:"count"`
+	// Weight is the sum of the weights of the grades
+	Weight float64 `json:"weight"`
+	// Trend contains the average after every grade, from the oldest one
+	Trend []Point `json:"trend"`
+	// Change is the change of the average during the TrendWindow, a negative change is an improvement.
+	// It's zero when the subject has no grades from before the window.
+	Change float64 `json:"change"`
+
+	// sum is the sum of the weighted marks
+	sum float64
+}
+
+// Summary contains the averages of all subjects.
+type Summary struct {
+	// Average is the mean of the averages of the subjects, zero without grades
+	Average  float64                    `json:"average"`
+	Count    int                        `json:"count"`
+	Subjects map[string]*SubjectSummary `json:"subjects"`
+}
+
+// Summarize computes the weighted averages of the grades, the grades must be ordered by their date, see FromResults.
+// The change of the averages is computed over the TrendWindow before now.
+func Summarize(grades []Grade, now time.Time) Summary {
+	summary := Summary{Subjects: make(map[string]*SubjectSummary)}
+	windowStart := now.Add(-TrendWindow)
+	// previous are the averages of the subjects before the trend window
+	previous := make(map[string]float64)
+
+	for _, grade := range grades {
+		subject, ok := summary.Subjects[grade.SubjectID]
+		if !ok {
+			subject = &SubjectSummary{SubjectID: grade.SubjectID, Trend: []Point{}}
+			summary.Subjects[grade.SubjectID] = subject
+		}
+
+		subject.sum += grade.Value.Mark * grade.Weight
+		subject.Weight += grade.Weight
+		subject.Count++
+		subject.Average = round(subject.sum / subject.Weight)
+		subject.Trend = append(subject.Trend, Point{Date: grade.Date, EventID: grade.EventID, Average: subject.Average})
+
+		if grade.Date.Before(windowStart) {
+			previous[grade.SubjectID] = subject.Average
+		}
+		summary.Count++
+	}
+
+	var total float64
+	for id, subject := range summary.Subjects {
+		if before, ok := previous[id]; ok {
+			subject.Change = round(subject.Average - before)
+		}
+		total += subject.Average
+	}
+	if len(summary.Subjects) > 0 {
+		summary.Average = round(total / float64(len(summary.Subjects)))
+	}
+	return summary
+}
+
+// Needed returns the mark the next grade of the weight needs, so the average reaches the target or a better one.
+// Returns false if the target can't be reached with a single grade, the returned mark is the best one in that case.
+// The mark is WorstMark if any grade keeps the average at the target.
+func (s *SubjectSummary) Needed(target, weight float64) (float64, bool) {
+	if weight <= 0 {
+		return 0, false
+	}
+
+	needed := (target*(s.Weight+weight) - s.sum) / weight
+	switch {
+	case needed < BestMark:
+		return BestMark, false
+	case needed > WorstMark:
+		return WorstMark, true
+	default:
+		// The epsilon keeps the floating point errors from rounding e.g. 1.2 down to 1.19
+		return math.Floor(needed*100+1e-9) / 100, true
+	}
+}
+
+// SortedSubjects returns the summaries of the subjects ordered by their ID.
+func (s Summary) SortedSubjects() []*SubjectSummary {
+	subjects := make([]*SubjectSummary, 0, len(s.Subjects))
+	for _, subject := range s.Subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].SubjectID < subjects[j].SubjectID })
+	return subjects
+}
+
+// round rounds the average to two decimal places.
+func round(average float64) float64 {
+	return math.Round(average*100) / 100
+}
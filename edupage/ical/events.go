@@ -0,0 +1,127 @@
+package ical
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+// lessonType is the type of the timetable items which are lessons.
+const lessonType = "lesson"
+
+// LessonEvents returns the lessons of the timetable, timed using the periods of the DBI in the location of the school.
+// The lessons without a known time are left out.
+func LessonEvents(timetable model.Timetable, dbi *model.DBI, location *time.Location) []Event {
+	events := []Event{}
+	for day, items := range timetable.Days {
+		date, err := time.ParseInLocation(model.TimeFormatYearMonthDay, day, location)
+		if err != nil {
+			continue
+		}
+
+		for _, item := range items {
+			if item.Type != lessonType {
+				continue
+			}
+			start, end, ok := lessonTime(date, item, dbi, location)
+			if !ok {
+				continue
+			}
+
+			subject := dbi.Subjects[item.SubjectID]
+			summary := subject.Name
+			if summary == "" {
+				summary = subject.Short
+			}
+			if groups := strings.TrimSpace(strings.Join(item.GroupNames, ", ")); groups != "" {
+				summary += " (" + groups + ")"
+			}
+
+			classrooms := make([]string, 0, len(item.ClassroomIDs))
+			for _, id := range item.ClassroomIDs {
+				if classroom, ok := dbi.Classrooms[id]; ok {
+					classrooms = append(classrooms, classroom.Name)
+				}
+			}
+			teachers := make([]string, 0, len(item.TeacherIDs))
+			for _, id := range item.TeacherIDs {
+				if teacher, ok := dbi.Teachers[id]; ok {
+					teachers = append(teachers, strings.TrimSpace(teacher.Firstname+" "+teacher.Lastname))
+				}
+			}
+
+			events = append(events, Event{
+				UID:         "lesson-" + day + "-" + item.Period + "-" + item.SubjectID + "-" + item.IGroupID,
+				Start:       start,
+				End:         end,
+				Summary:     summary,
+				Location:    strings.Join(classrooms, ", "),
+				Description: strings.Join(teachers, ", "),
+				Category:    CategoryLesson,
+			})
+		}
+	}
+	return events
+}
+
+// lessonTime returns when the lesson starts and ends. The times of the item are preferred to the times of its periods,
+// the lessons lasting multiple periods end with the last one.
+func lessonTime(date time.Time, item model.TimetableItem, dbi *model.DBI, location *time.Location) (time.Time, time.Time, bool) {
+	first := dbi.Periods[json.Number(item.Period)]
+	last := first
+	if duration, err := item.Duration.Int64(); err == nil && duration > 1 {
+		if period, err := strconv.Atoi(item.Period); err == nil {
+			if p, ok := dbi.Periods[json.Number(strconv.Itoa(period+int(duration)-1))]; ok {
+				last = p
+			}
+		}
+	}
+
+	startTime, endTime := item.StartTime, item.EndTime
+	if startTime == "" {
+		startTime = first.StartTime
+	}
+	if endTime == "" {
+		endTime = last.EndTime
+	}
+
+	start, err := clock(date, startTime, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	end, err := clock(date, endTime, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
+// HomeworkEvents returns the deadlines of the homework, the homework without a due date is left out.
+// The homework due on a day is an all-day event, the deadlines with a time are points in time in the location of the school.
+func HomeworkEvents(homeworks []model.Homework, dbi *model.DBI, location *time.Location) []Event {
+	events := []Event{}
+	for _, homework := range homeworks {
+		due, allDay, ok := homework.Due(location)
+		if !ok {
+			continue
+		}
+
+		summary := homework.Name
+		if subject, ok := dbi.Subjects[homework.SubjectID()]; ok && subject.Name != "" {
+			summary = subject.Name + ": " + summary
+		}
+
+		events = append(events, Event{
+			UID:         "homework-" + homework.ID,
+			Start:       inLocation(due, location),
+			AllDay:      allDay,
+			Summary:     summary,
+			Description: homework.Details,
+			Category:    CategoryHomework,
+		})
+	}
+	return events
+}
@@ -0,0 +1,180 @@
+// Package ical writes the timetable and the homework as an iCalendar (RFC 5545) feed,
+// which calendar apps can subscribe to.
+//
+// The periods of the lessons are local times of the school, they are converted using its time zone:
+//
+//	calendar := ical.Calendar{Name: "Timetable", Domain: "school.edupage.org", Stamp: time.Now()}
+//	calendar.Events = append(ical.LessonEvents(timetable, &user.DBI, location), ical.HomeworkEvents(homeworks, &user.DBI, location)...)
+//	_, err := calendar.WriteTo(w)
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of the feed.
+const ContentType = "text/calendar; charset=utf-8"
+
+// The categories of the events.
+const (
+	CategoryLesson   = "LESSON"
+	CategoryHomework = "HOMEWORK"
+)
+
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405Z"
+	// maxLineLength is the limit of the content lines in octets, the longer ones are folded
+	maxLineLength = 75
+)
+
+// Event is an event of the calendar, a lesson or a homework deadline.
+type Event struct {
+	// UID identifies the event across the updates of the feed
+	UID   string
+	Start time.Time
+	// End is optional, the event is a point in time without it
+	End time.Time
+	// AllDay events last the whole days from the Start to the End, or only the day of the Start
+	AllDay      bool
+	Summary     string
+	Location    string
+	Description string
+	Category    string
+}
+
+// Calendar is a feed of events.
+type Calendar struct {
+	Name string
+	// Domain makes the UIDs of the events unique, e.g. the host of the school
+	Domain string
+	// TimeZone is a hint for the apps displaying the calendar, the times are written in UTC
+	TimeZone string
+	// Stamp is when the feed was created
+	Stamp  time.Time
+	Events []Event
+}
+
+// WriteTo writes the calendar, ordered by the start of the events.
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &contentWriter{w: bufio.NewWriter(w)}
+
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//EduPage2//EduPage2 Server//EN")
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		cw.property("X-WR-CALNAME", c.Name)
+	}
+	if c.TimeZone != "" {
+		cw.property("X-WR-TIMEZONE", c.TimeZone)
+	}
+
+	events := append([]Event(nil), c.Events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+
+	stamp := c.Stamp.UTC().Format(dateTimeFormat)
+	for _, event := range events {
+		cw.line("BEGIN:VEVENT")
+		cw.line("UID:" + escape(event.UID+"@"+c.Domain))
+		cw.line("DTSTAMP:" + stamp)
+		if event.AllDay {
+			end := event.End
+			if end.IsZero() || !end.After(event.Start) {
+				end = event.Start.AddDate(0, 0, 1)
+			}
+			cw.line("DTSTART;VALUE=DATE:" + event.Start.Format(dateFormat))
+			cw.line("DTEND;VALUE=DATE:" + end.Format(dateFormat))
+		} else {
+			cw.line("DTSTART:" + event.Start.UTC().Format(dateTimeFormat))
+			if !event.End.IsZero() && event.End.After(event.Start) {
+				cw.line("DTEND:" + event.End.UTC().Format(dateTimeFormat))
+			}
+		}
+		cw.property("SUMMARY", event.Summary)
+		if event.Location != "" {
+			cw.property("LOCATION", event.Location)
+		}
+		if event.Description != "" {
+			cw.property("DESCRIPTION", event.Description)
+		}
+		if event.Category != "" {
+			cw.property("CATEGORIES", event.Category)
+		}
+		cw.line("END:VEVENT")
+	}
+
+	cw.line("END:VCALENDAR")
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// contentWriter writes the content lines, folded and terminated by CRLF. It keeps the first error.
+type contentWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *contentWriter) property(name, value string) {
+	cw.line(name + ":" + escape(value))
+}
+
+func (cw *contentWriter) line(line string) {
+	if cw.err != nil {
+		return
+	}
+
+	var folded strings.Builder
+	length := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if length+size > maxLineLength {
+			// The continuation lines start with a space, which counts to their length
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+		folded.WriteRune(r)
+		length += size
+	}
+	folded.WriteString("\r\n")
+
+	n, err := cw.w.WriteString(folded.String())
+	cw.n += int64(n)
+	cw.err = err
+}
+
+// escape escapes the text value of a property.
+func escape(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(value)
+}
+
+// inLocation returns the date and the clock of the time in the location, the times parsed without a zone are local times.
+func inLocation(t time.Time, location *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location)
+}
+
+// clock parses a time of the day, e.g. 08:00, on the date in the location.
+func clock(date time.Time, value string, location *time.Location) (time.Time, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", value, err)
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), parsed.Hour(), parsed.Minute(), 0, 0, location), nil
+}
@@ -2,6 +2,7 @@ package edupage
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -13,22 +14,21 @@ import (
 	"github.com/DislikesSchool/EduPage2-server/edupage/model"
 )
 
-func (client *EdupageClient) fetchTimelineModel(datefrom, dateto time.Time) (model.Timeline, error) {
+func (client *EdupageClient) fetchTimelineModel(ctx context.Context, datefrom, dateto time.Time) (model.Timeline, error) {
 	if client.Credentials.httpClient == nil {
 		return model.Timeline{}, errors.New("invalid credentials")
 	}
 
-	url := fmt.Sprintf("https://%s/timeline/?akcia=getData", client.Credentials.Server)
-
 	form := CreatePayload(map[string]string{
 		"datefrom": datefrom.Format("2006-01-02"),
 		"dateto":   dateto.Format("2006-01-02"),
 	})
 
-	response, err := client.Credentials.httpClient.PostForm(url, form)
+	response, err := client.Credentials.postForm(ctx, "/timeline/?akcia=getData", form)
 	if err != nil {
-		return model.Timeline{}, ErrorUnauthorized // most likely case
+		return model.Timeline{}, requestError(ctx, err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != 200 {
 		return model.Timeline{}, fmt.Errorf("server returned code: %d", response.StatusCode)
@@ -55,16 +55,15 @@ func (client *EdupageClient) fetchTimelineModel(datefrom, dateto time.Time) (mod
 	return timeline, nil
 }
 
-func (client *EdupageClient) fetchUserModel() (model.User, error) {
+func (client *EdupageClient) fetchUserModel(ctx context.Context) (model.User, error) {
 	if client.Credentials.httpClient == nil {
 		return model.User{}, errors.New("invalid credentials")
 	}
-	u := fmt.Sprintf("https://%s/user/?", client.Credentials.Server)
-
-	response, err := client.Credentials.httpClient.Get(u)
+	response, err := client.Credentials.get(ctx, "/user/?")
 	if err != nil {
-		return model.User{}, ErrorUnauthorized // most likely case
+		return model.User{}, requestError(ctx, err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != 200 {
 		return model.User{}, fmt.Errorf("server returned code: %d", response.StatusCode)
@@ -96,13 +95,11 @@ func (client *EdupageClient) fetchUserModel() (model.User, error) {
 	return user, nil
 }
 
-func (client *EdupageClient) fetchResultsModel(year, halfyear string) (model.Results, error) {
+func (client *EdupageClient) fetchResultsModel(ctx context.Context, year, halfyear string) (model.Results, error) {
 	if client.Credentials.httpClient == nil {
 		return model.Results{}, errors.New("invalid credentials")
 	}
 
-	url := fmt.Sprintf("https://%s/znamky/?what=studentviewer&akcia=studentData&eqav=1&maxEqav=7", client.Credentials.Server)
-
 	form := CreatePayload(map[string]string{
 		"pohlad":           "podladatumu",
 		"znamky_yearid":    year,
@@ -114,10 +111,11 @@ func (client *EdupageClient) fetchResultsModel(year, halfyear string) (model.Res
 		"updateLastView":   "0",
 	})
 
-	response, err := client.Credentials.httpClient.PostForm(url, form)
+	response, err := client.Credentials.postForm(ctx, "/znamky/?what=studentviewer&akcia=studentData&eqav=1&maxEqav=7", form)
 	if err != nil {
-		return model.Results{}, ErrorUnauthorized // most likely case
+		return model.Results{}, requestError(ctx, err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != 200 {
 		return model.Results{}, fmt.Errorf("server returned code: %d", response.StatusCode)
@@ -145,18 +143,21 @@ func (client *EdupageClient) fetchResultsModel(year, halfyear string) (model.Res
 	return results, nil
 }
 
-func (client *EdupageClient) fetchTimetableModel(datefrom, dateto time.Time) (model.Timetable, error) {
-	if client.Credentials.httpClient == nil {
-		return model.Timetable{}, errors.New("invalid credentials")
-	}
-
-	u := fmt.Sprintf("https://%s/timetable/server/currenttt.js?__func=curentttGetData", client.Credentials.Server)
-
+func (client *EdupageClient) fetchTimetableModel(ctx context.Context, datefrom, dateto time.Time) (model.Timetable, error) {
 	id, err := client.GetStudentID()
 	if err == ErrorUnitialized {
 		return model.Timetable{}, errors.New("failed to create request, user is not initialized")
 	}
 
+	return client.fetchTableTimetableModel(ctx, TableStudents, id, datefrom, dateto)
+}
+
+// fetchTableTimetableModel retrieves the timetable of the student, class, teacher or classroom in the table.
+func (client *EdupageClient) fetchTableTimetableModel(ctx context.Context, table, id string, datefrom, dateto time.Time) (model.Timetable, error) {
+	if client.Credentials.httpClient == nil {
+		return model.Timetable{}, errors.New("invalid credentials")
+	}
+
 	year, currentMonth, _ := datefrom.Date()
 	if currentMonth < 9 {
 		year--
@@ -169,7 +170,7 @@ func (client *EdupageClient) fetchTimetableModel(datefrom, dateto time.Time) (mo
 				"year":                 year,
 				"datefrom":             datefrom.Format(model.TimeFormatYearMonthDay),
 				"dateto":               dateto.Format(model.TimeFormatYearMonthDay),
-				"table":                "students",
+				"table":                table,
 				"id":                   id,
 				"showColors":           false,
 				"showOrig":             true,
@@ -185,10 +186,11 @@ func (client *EdupageClient) fetchTimetableModel(datefrom, dateto time.Time) (mo
 		return model.Timetable{}, fmt.Errorf("failed to create request: %s", err)
 	}
 
-	response, err := client.Credentials.httpClient.Post(u, "application/json", bytes.NewBuffer(request_body))
+	response, err := client.Credentials.post(ctx, "/timetable/server/currenttt.js?__func=curentttGetData", "application/json", bytes.NewBuffer(request_body))
 	if err != nil {
-		return model.Timetable{}, ErrorUnauthorized // most likely case
+		return model.Timetable{}, requestError(ctx, err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != 200 {
 		return model.Timetable{}, fmt.Errorf("server returned code: %d", response.StatusCode)
@@ -207,16 +209,15 @@ func (client *EdupageClient) fetchTimetableModel(datefrom, dateto time.Time) (mo
 	return tt, nil
 }
 
-func (client *EdupageClient) fetchCanteenModel(date time.Time) (model.Canteen, error) {
+func (client *EdupageClient) fetchCanteenModel(ctx context.Context, date time.Time) (model.Canteen, error) {
 	if client.Credentials.httpClient == nil {
 		return model.Canteen{}, errors.New("invalid credentials")
 	}
-	u := fmt.Sprintf("https://%s/menu/?date=%s", client.Credentials.Server, date.Format("20060102"))
-
-	response, err := client.Credentials.httpClient.Get(u)
+	response, err := client.Credentials.get(ctx, "/menu/?date="+date.Format("20060102"))
 	if err != nil {
-		return model.Canteen{}, ErrorUnauthorized // most likely case
+		return model.Canteen{}, requestError(ctx, err)
 	}
+	defer response.Body.Close()
 
 	if response.StatusCode != 200 {
 		return model.Canteen{}, fmt.Errorf("server returned code: %d", response.StatusCode)
@@ -240,6 +241,15 @@ func (client *EdupageClient) fetchCanteenModel(date time.Time) (model.Canteen, e
 	return canteen, nil
 }
 
+// requestError maps the error of a failed request to ErrorUnauthorized, which is the most likely case,
+// unless the request was cancelled or its deadline was exceeded.
+func requestError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return ErrorUnauthorized
+}
+
 func findGSCEHash(body []byte) (string, error) {
 	rg, _ := regexp.Compile(`ASC\.gsechash="(.*)";`)
 	matches := rg.FindAllStringSubmatch(string(body), -1)
@@ -1,12 +1,12 @@
 package edupage
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"path"
 	"strings"
 
 	"golang.org/x/crypto/bcrypt"
@@ -20,12 +20,21 @@ var (
 
 var (
 	edupageDomain = "edupage.org"
-	Server        = ""
-	loginPath     = "login/edubarLogin.php"
+	loginPath     = "/login/edubarLogin.php"
 )
 
+// Server is the host, or the URL, all requests are sent to when LoginOptions.BaseURL is empty.
+// Login no longer stores the server of the user in it, see Credentials.Server.
+//
+// Deprecated: Use LoginOptions.BaseURL instead.
+var Server = ""
+
+// PasswordHashCost is the bcrypt cost used by HashPassword.
+// Tests lower it, as every login hashes the password.
+var PasswordHashCost = 14
+
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), PasswordHashCost)
 	return string(bytes), err
 }
 
@@ -34,40 +43,56 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
+// LoginOptions changes where and how the edupage requests are sent.
+// The zero value talks to the real edupage servers.
+type LoginOptions struct {
+	// BaseURL replaces the "https://<server>" prefix of every request.
+	// The Host header is still set to the edupage server, so a single
+	// fake server can act as every school (see package edupagetest).
+	BaseURL string
+	// Transport is used as the round-tripper of the http client,
+	// http.DefaultTransport is used when nil.
+	Transport http.RoundTripper
+}
+
 type Credentials struct {
 	Username     string
 	Server       string
 	PasswordHash string
 	httpClient   *http.Client
+	baseURL      string
 }
 
 // Login creates EdupageClient you can use to interact the edupage api with.
 // Returns EdupageClient or error.
 func Login(username, password, server string) (Credentials, error) {
+	return LoginWithOptions(username, password, server, LoginOptions{})
+}
+
+// LoginWithOptions works like Login, but sends all requests as specified in the options.
+func LoginWithOptions(username, password, server string, options LoginOptions) (Credentials, error) {
+	if options.BaseURL == "" && Server != "" {
+		options.BaseURL = Server
+		if !strings.Contains(Server, "://") {
+			options.BaseURL = "https://" + Server
+		}
+	}
+
 	server = strings.TrimPrefix(server, "http://")
 	server = strings.TrimPrefix(server, "https://")
 	server = strings.TrimSuffix(server, ".edupage.org")
-	Server = server + "." + edupageDomain
 
-	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	credentials, err := newCredentials(username, server+"."+edupageDomain, options)
 	if err != nil {
 		return Credentials{}, err
 	}
 
-	client := &http.Client{
-		Jar: jar,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return ErrRedirect
-		},
-	}
-
-	u := fmt.Sprintf("https://%s", path.Join(Server, loginPath))
 	d := url.Values{
 		"username": []string{username},
 		"password": []string{password},
 	}
 
-	rs, err := client.PostForm(u, d)
+	rs, err := credentials.postForm(context.Background(), loginPath, d)
 
 	if rs != nil && err != nil {
 		if rs.StatusCode == 302 {
@@ -78,19 +103,20 @@ func Login(username, password, server string) (Credentials, error) {
 					return Credentials{}, err
 				}
 
+				// Relative redirects (other than /user/) lead back to the login page
+				if parsed.Hostname() == "" {
+					return Credentials{}, ErrAuthorization
+				}
+
 				sp := strings.Split(parsed.Hostname(), ".")
 				sub := sp[0]
 
-				return Login(username, password, sub)
+				return LoginWithOptions(username, password, sub, options)
 			} else {
-				var credentials Credentials
-				credentials.Username = username
-				credentials.Server = Server
 				credentials.PasswordHash, err = HashPassword(password)
 				if err != nil {
 					return Credentials{}, err
 				}
-				credentials.httpClient = client
 
 				return credentials, nil
 			}
@@ -98,5 +124,76 @@ func Login(username, password, server string) (Credentials, error) {
 			return Credentials{}, err
 		}
 	}
+	if err == nil {
+		return Credentials{}, ErrAuthorization
+	}
 	return Credentials{}, err
 }
+
+// newCredentials creates credentials with an empty cookie jar for the user on the server.
+func newCredentials(username, server string, options LoginOptions) (Credentials, error) {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return Credentials{
+		Username: username,
+		Server:   server,
+		httpClient: &http.Client{
+			Jar:       jar,
+			Transport: options.Transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return ErrRedirect
+			},
+		},
+		baseURL: options.BaseURL,
+	}, nil
+}
+
+// url returns the absolute url of the path on the credentials' server.
+func (c *Credentials) url(p string) string {
+	if c.baseURL != "" {
+		return strings.TrimSuffix(c.baseURL, "/") + p
+	}
+	return "https://" + c.Server + p
+}
+
+// newRequest creates a request for the path on the credentials' server.
+// The request is cancelled together with the context.
+func (c *Credentials) newRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(p), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = c.Server
+	return req, nil
+}
+
+func (c *Credentials) do(req *http.Request) (*http.Response, error) {
+	if c.httpClient == nil {
+		return nil, errors.New("invalid credentials")
+	}
+	return c.httpClient.Do(req)
+}
+
+func (c *Credentials) get(ctx context.Context, p string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+func (c *Credentials) post(ctx context.Context, p, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodPost, p, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.do(req)
+}
+
+func (c *Credentials) postForm(ctx context.Context, p string, data url.Values) (*http.Response, error) {
+	return c.post(ctx, p, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// The states of an absence, see Absence#Status.
+const (
+	AbsenceExcused   = "excused"
+	AbsenceUnexcused = "unexcused"
+	AbsencePending   = "pending"
+	AbsenceLate      = "late"
+)
+
+// The excuse types of the StudentAbsentType.
+const (
+	excuseTypeExcused   = "ok"
+	excuseTypeUnexcused = "no"
+)
+
+// Absence is a lesson the student has missed or arrived late to.
+type Absence struct {
+	ID        FlexString `json:"id"`
+	StudentID FlexString `json:"studentid"`
+	Date      string     `json:"date"`
+	Period    FlexString `json:"uniperiod"`
+	SubjectID FlexString `json:"subjectid"`
+	// TypeID is the key of the StudentAbsentType in the DBI, it decides whether the absence is excused
+	TypeID FlexString `json:"studentabsent_typeid"`
+	// LateMinutes is set for the late arrivals
+	LateMinutes FlexInt `json:"late_minutes"`
+	Note        string  `json:"note"`
+}
+
+// Attendance contains the absences and late arrivals of the student.
+type Attendance struct {
+	Absences []Absence
+}
+
+// Late reports whether the student has only arrived late to the lesson.
+func (a *Absence) Late() bool {
+	return a.LateMinutes > 0
+}
+
+// Status returns whether the absence is excused, unexcused or waits for an excuse, the late arrivals are AbsenceLate.
+func (a *Absence) Status(dbi *DBI) string {
+	if a.Late() {
+		return AbsenceLate
+	}
+	switch dbi.StudentAbsentTypes[string(a.TypeID)].ExcuseType {
+	case excuseTypeExcused:
+		return AbsenceExcused
+	case excuseTypeUnexcused:
+		return AbsenceUnexcused
+	default:
+		return AbsencePending
+	}
+}
+
+// ParsedDate returns the day of the absence, false if it's unknown.
+func (a *Absence) ParsedDate() (time.Time, bool) {
+	date, err := time.Parse(TimeFormatYearMonthDay, a.Date)
+	return date, err == nil
+}
+
+// Sorted returns the absences from the newest one, the absences of a day are ordered by the period.
+func (a *Attendance) Sorted() []Absence {
+	absences := append([]Absence(nil), a.Absences...)
+	sort.SliceStable(absences, func(i, j int) bool {
+		if absences[i].Date != absences[j].Date {
+			return absences[i].Date > absences[j].Date
+		}
+		return absences[i].Period < absences[j].Period
+	})
+	return absences
+}
+
+func ParseAttendance(data []byte) (Attendance, error) {
+	type Response struct {
+		Absences []Absence `json:"absences"`
+		Error    string    `json:"error"`
+	}
+
+	type RawAttendance struct {
+		Response Response `json:"r"`
+	}
+
+	var r RawAttendance
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Attendance{}, err
+	}
+	if r.Response.Error != "" {
+		return Attendance{}, errors.New(r.Response.Error)
+	}
+
+	return Attendance{Absences: r.Response.Absences}, nil
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+// The states of a homework, see Homework#Status.
+const (
+	HomeworkPending = "pending"
+	HomeworkDone    = "done"
+	HomeworkOverdue = "overdue"
+)
+
+// homeworkStateDone is the state edupage sets once the user has marked the homework done.
+const homeworkStateDone = "done"
+
+// Due returns when the homework is due, false if it has no due date. Edupage sends the local times of the school,
+// they are in the location of the school.
+// The time is midnight when edupage only knows the day, allDay is set in that case.
+func (h *Homework) Due(location *time.Location) (due time.Time, allDay bool, ok bool) {
+	return parseHomeworkTime(h.DatetimeTo, h.DateTo, location)
+}
+
+// Assigned returns when the homework was assigned in the location of the school, false if it's unknown.
+func (h *Homework) Assigned(location *time.Location) (time.Time, bool) {
+	assigned, _, ok := parseHomeworkTime(h.DatetimeFrom, h.DateFrom, location)
+	return assigned, ok
+}
+
+// SubjectID returns the ID of the subject of the homework, the predmetid is a subject ID despite the name of LessonID.
+func (h *Homework) SubjectID() string {
+	return h.LessonID.String()
+}
+
+// Done reports whether the user has marked the homework done.
+func (h *Homework) Done() bool {
+	return h.State == homeworkStateDone
+}
+
+// Status returns the state of the homework at the time, HomeworkDone, HomeworkOverdue or HomeworkPending.
+// Homework due on a day is overdue after that day has ended in the location of the school.
+func (h *Homework) Status(now time.Time, location *time.Location) string {
+	if h.Done() {
+		return HomeworkDone
+	}
+	due, allDay, ok := h.Due(location)
+	if !ok {
+		return HomeworkPending
+	}
+	if allDay {
+		due = due.AddDate(0, 0, 1)
+	}
+	if now.After(due) {
+		return HomeworkOverdue
+	}
+	return HomeworkPending
+}
+
+// parseHomeworkTime parses the datetime in the location, falling back to the date.
+func parseHomeworkTime(datetime, date string, location *time.Location) (time.Time, bool, bool) {
+	if t, err := time.ParseInLocation(TimeFormat, datetime, location); err == nil {
+		return t, false, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", date, location); err == nil {
+		return t, true, true
+	}
+	return time.Time{}, false, false
+}
+
+// SortedHomeworks returns the homeworks of the timeline ordered by their due date, the homeworks without one last.
+func (t *Timeline) SortedHomeworks() []Homework {
+	homeworks := make([]Homework, 0, len(t.Homeworks))
+	for _, homework := range t.Homeworks {
+		homeworks = append(homeworks, homework)
+	}
+
+	sort.Slice(homeworks, func(i, j int) bool {
+		// The order doesn't depend on the location, all homework is in the same one
+		a, _, aok := homeworks[i].Due(time.UTC)
+		b, _, bok := homeworks[j].Due(time.UTC)
+		switch {
+		case aok != bok:
+			return aok
+		case !a.Equal(b):
+			return a.Before(b)
+		default:
+			return homeworks[i].ID < homeworks[j].ID
+		}
+	})
+	return homeworks
+}
+
+// HomeworkItem returns the timeline item of the homework, false if the homework isn't on the timeline.
+func (t *Timeline) HomeworkItem(homework Homework) (TimelineItem, bool) {
+	for _, item := range t.Items {
+		if item.Type != ItemTypeHomework {
+			continue
+		}
+		data, err := item.TypedData()
+		if err != nil {
+			continue
+		}
+		if string(data.(*HomeworkData).SuperID) == homework.ESuperID {
+			return item, true
+		}
+	}
+	return TimelineItem{}, false
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// The kinds of the notes, see Note#Kind.
+const (
+	NotePraise    = "praise"
+	NoteReprimand = "reprimand"
+	NoteOther     = "other"
+)
+
+// The halves of a school year, the first one lasts until January.
+const (
+	FirstHalf  = "P1"
+	SecondHalf = "P2"
+)
+
+// noteKinds maps the types edupage sends with the notes to their kinds.
+var noteKinds = map[string]string{
+	"pochvala":    NotePraise,
+	"pokarhanie":  NoteReprimand,
+	"napomenutie": NoteReprimand,
+	"poznamka":    NoteReprimand,
+	"poznámka":    NoteReprimand,
+	"dutka":       NoteReprimand,
+	"důtka":       NoteReprimand,
+}
+
+// Kind returns whether the note is a praise or a reprimand, NoteOther for the unknown types.
+func (n *Note) Kind() string {
+	if kind, ok := noteKinds[strings.ToLower(strings.TrimSpace(n.Type))]; ok {
+		return kind
+	}
+	return NoteOther
+}
+
+// ParsedDate returns the day of the note, false if it's unknown.
+func (n *Note) ParsedDate() (time.Time, bool) {
+	date, err := time.Parse("2006-01-02", n.Date)
+	return date, err == nil
+}
+
+// SchoolHalf returns the school year, named by the year it starts in, and its half the day belongs to.
+func SchoolHalf(day time.Time) (year string, half string) {
+	switch month := day.Month(); {
+	case month >= time.September:
+		return day.Format("2006"), FirstHalf
+	case month == time.January:
+		return day.AddDate(-1, 0, 0).Format("2006"), FirstHalf
+	default:
+		return day.AddDate(-1, 0, 0).Format("2006"), SecondHalf
+	}
+}
+
+// SortedNotes returns the notes of the results from the newest one, the notes without a date last.
+func (r *Results) SortedNotes() []Note {
+	notes := make([]Note, 0, len(r.Notes))
+	for _, note := range r.Notes {
+		notes = append(notes, note)
+	}
+
+	sort.Slice(notes, func(i, j int) bool {
+		a, aok := notes[i].ParsedDate()
+		b, bok := notes[j].ParsedDate()
+		switch {
+		case aok != bok:
+			return aok
+		case !a.Equal(b):
+			return a.After(b)
+		default:
+			return notes[i].ID < notes[j].ID
+		}
+	})
+	return notes
+}
@@ -0,0 +1,172 @@
+package model
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Occupancy are the classrooms and teachers in use in the periods of the days, computed from the timetables of the school.
+type Occupancy struct {
+	// Days maps the dates (2006-01-02) to the periods to the slots, the days without lessons are missing
+	Days map[string]map[string]*OccupiedSlot `json:"days"`
+}
+
+// OccupiedSlot are the IDs of the classrooms and teachers in use in a period.
+type OccupiedSlot struct {
+	Classrooms []string `json:"classrooms"`
+	Teachers   []string `json:"teachers"`
+}
+
+// NewOccupancy creates an occupancy without any lessons.
+func NewOccupancy() Occupancy {
+	return Occupancy{Days: make(map[string]map[string]*OccupiedSlot)}
+}
+
+// Add marks the classrooms and teachers of the lessons of the timetable as occupied.
+// The lessons lasting multiple periods occupy all of them, the lessons shared by multiple timetables are only counted once.
+func (o *Occupancy) Add(timetable Timetable) {
+	for date, items := range timetable.Days {
+		for _, item := range items {
+			if item.Period == "" {
+				continue
+			}
+			periods, ok := o.Days[date]
+			if !ok {
+				periods = make(map[string]*OccupiedSlot)
+				o.Days[date] = periods
+			}
+			for _, period := range item.periods() {
+				slot, ok := periods[period]
+				if !ok {
+					slot = &OccupiedSlot{Classrooms: []string{}, Teachers: []string{}}
+					periods[period] = slot
+				}
+				slot.Classrooms = appendMissing(slot.Classrooms, item.ClassroomIDs)
+				slot.Teachers = appendMissing(slot.Teachers, item.TeacherIDs)
+			}
+		}
+	}
+}
+
+// Merge adds the days of the other occupancy, which replace the same days of this one.
+func (o *Occupancy) Merge(other Occupancy) {
+	for date, periods := range other.Days {
+		o.Days[date] = periods
+	}
+}
+
+// FreeClassrooms returns the classrooms of the DBI which aren't used in the period of the day, ordered by their name.
+func (o *Occupancy) FreeClassrooms(dbi *DBI, date, period string) []Classroom {
+	slot := o.slot(date, period)
+	free := []Classroom{}
+	for id, classroom := range dbi.Classrooms {
+		if !slices.Contains(slot.Classrooms, id) {
+			free = append(free, classroom)
+		}
+	}
+	sort.Slice(free, func(i, j int) bool {
+		if free[i].Name != free[j].Name {
+			return free[i].Name < free[j].Name
+		}
+		return free[i].ID < free[j].ID
+	})
+	return free
+}
+
+// FreeTeachers returns the teachers of the DBI who don't teach in the period of the day, ordered by their name.
+func (o *Occupancy) FreeTeachers(dbi *DBI, date, period string) []Teacher {
+	slot := o.slot(date, period)
+	free := []Teacher{}
+	for id, teacher := range dbi.Teachers {
+		if !slices.Contains(slot.Teachers, id) {
+			free = append(free, teacher)
+		}
+	}
+	sort.Slice(free, func(i, j int) bool {
+		if free[i].Lastname != free[j].Lastname {
+			return free[i].Lastname < free[j].Lastname
+		}
+		if free[i].Firstname != free[j].Firstname {
+			return free[i].Firstname < free[j].Firstname
+		}
+		return free[i].ID < free[j].ID
+	})
+	return free
+}
+
+// TeacherFreePeriods returns the periods of the day in which the teacher doesn't teach, nil when the school has no lessons that day.
+func (o *Occupancy) TeacherFreePeriods(dbi *DBI, teacherID, date string) []Period {
+	if _, ok := o.Days[date]; !ok {
+		return nil
+	}
+	free := []Period{}
+	for _, period := range SortedPeriods(dbi) {
+		if !slices.Contains(o.slot(date, period.ID).Teachers, teacherID) {
+			free = append(free, period)
+		}
+	}
+	return free
+}
+
+// SortedPeriods returns the periods of the DBI in the order of the day.
+func SortedPeriods(dbi *DBI) []Period {
+	periods := make([]Period, 0, len(dbi.Periods))
+	for _, period := range dbi.Periods {
+		periods = append(periods, period)
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		if periods[i].StartTime != periods[j].StartTime {
+			return periods[i].StartTime < periods[j].StartTime
+		}
+		return comparePeriodIDs(periods[i].ID, periods[j].ID) < 0
+	})
+	return periods
+}
+
+func (o *Occupancy) slot(date, period string) OccupiedSlot {
+	if slot, ok := o.Days[date][period]; ok {
+		return *slot
+	}
+	return OccupiedSlot{}
+}
+
+// periods returns the IDs of the periods the item lasts.
+func (item TimetableItem) periods() []string {
+	periods := []string{item.Period}
+	duration, err := item.Duration.Int64()
+	first, convErr := strconv.Atoi(item.Period)
+	if err != nil || convErr != nil {
+		return periods
+	}
+	for i := 1; i < int(duration); i++ {
+		periods = append(periods, strconv.Itoa(first+i))
+	}
+	return periods
+}
+
+// comparePeriodIDs orders the numeric IDs by their value, the other IDs alphabetically after them.
+func comparePeriodIDs(a, b string) int {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return x - y
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func appendMissing(ids []string, add []string) []string {
+	for _, id := range add {
+		if id != "" && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
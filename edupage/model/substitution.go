@@ -0,0 +1,150 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+)
+
+// The kinds of the changes of the timetable, a lesson can be changed in multiple ways.
+const (
+	// ChangeCancelled is a lesson which won't take place
+	ChangeCancelled = "cancelled"
+	// ChangeAdded is a lesson which isn't in the regular timetable
+	ChangeAdded = "added"
+	// ChangeSubstituted is a lesson taught by another teacher
+	ChangeSubstituted = "substituted"
+	// ChangeMoved is a lesson moved to another classroom
+	ChangeMoved = "moved"
+	// ChangeReplaced is a lesson of another subject
+	ChangeReplaced = "replaced"
+)
+
+// Substitution is a change of a lesson of the school, published by the school on the substitution board.
+// The lists are empty when the substitution doesn't change them.
+type Substitution struct {
+	ID           FlexString `json:"id"`
+	Date         string     `json:"date"`
+	Period       string     `json:"uniperiod"`
+	ClassIDs     []string   `json:"classids"`
+	SubjectID    string     `json:"subjectid"`
+	TeacherIDs   []string   `json:"teacherids"`
+	ClassroomIDs []string   `json:"classroomids"`
+	// TypeID is the key of the SubstitionType in the DBI
+	TypeID    FlexString `json:"substitution_typeid"`
+	Cancelled bool       `json:"removed"`
+	Note      string     `json:"note"`
+}
+
+// TimetableChange is a substitution of a lesson together with the lesson of the regular timetable it changes.
+type TimetableChange struct {
+	Date   string
+	Period string
+	// Kinds are the ways the lesson is changed, see ChangeCancelled
+	Kinds []string
+	// Original is nil for the added lessons
+	Original     *TimetableItem
+	Substitution Substitution
+}
+
+func ParseSubstitutions(data []byte) ([]Substitution, error) {
+	type Response struct {
+		Substitutions []Substitution `json:"substitutions"`
+		Error         string         `json:"error"`
+	}
+
+	type RawSubstitutions struct {
+		Response Response `json:"r"`
+	}
+
+	var r RawSubstitutions
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	if r.Response.Error != "" {
+		return nil, errors.New(r.Response.Error)
+	}
+
+	return r.Response.Substitutions, nil
+}
+
+// Changes compares the substitutions of the class with the timetable, ordered by the date and the period.
+// The substitutions which don't change any lesson of the timetable are left out.
+func (t *Timetable) Changes(substitutions []Substitution, classID string) []TimetableChange {
+	changes := []TimetableChange{}
+
+	for _, substitution := range substitutions {
+		if !slices.Contains(substitution.ClassIDs, classID) {
+			continue
+		}
+
+		change := TimetableChange{
+			Date:         substitution.Date,
+			Period:       substitution.Period,
+			Original:     t.lesson(substitution),
+			Substitution: substitution,
+		}
+
+		switch {
+		case substitution.Cancelled:
+			change.Kinds = []string{ChangeCancelled}
+		case change.Original == nil:
+			change.Kinds = []string{ChangeAdded}
+		default:
+			original := change.Original
+			if len(substitution.TeacherIDs) > 0 && !sameIDs(substitution.TeacherIDs, original.TeacherIDs) {
+				change.Kinds = append(change.Kinds, ChangeSubstituted)
+			}
+			if len(substitution.ClassroomIDs) > 0 && !sameIDs(substitution.ClassroomIDs, original.ClassroomIDs) {
+				change.Kinds = append(change.Kinds, ChangeMoved)
+			}
+			if substitution.SubjectID != "" && substitution.SubjectID != original.SubjectID {
+				change.Kinds = append(change.Kinds, ChangeReplaced)
+			}
+		}
+
+		if len(change.Kinds) > 0 {
+			changes = append(changes, change)
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Date != changes[j].Date {
+			return changes[i].Date < changes[j].Date
+		}
+		return changes[i].Period < changes[j].Period
+	})
+	return changes
+}
+
+// lesson returns the lesson of the timetable the substitution changes, the lesson of the same subject is preferred
+// when there are more lessons in the period, e.g. of different groups.
+func (t *Timetable) lesson(substitution Substitution) *TimetableItem {
+	var found *TimetableItem
+	for i, item := range t.Days[substitution.Date] {
+		if item.Period != substitution.Period {
+			continue
+		}
+		if item.SubjectID == substitution.SubjectID {
+			return &t.Days[substitution.Date][i]
+		}
+		if found == nil {
+			found = &t.Days[substitution.Date][i]
+		}
+	}
+	return found
+}
+
+// sameIDs reports whether the lists contain the same IDs, in any order.
+func sameIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, id := range a {
+		if !slices.Contains(b, id) {
+			return false
+		}
+	}
+	return true
+}
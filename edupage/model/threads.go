@@ -0,0 +1,207 @@
+package model
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ParticipantTeacher = "teacher"
+	ParticipantStudent = "student"
+	ParticipantParent  = "parent"
+)
+
+// userPrefixes map the prefixes of edupage user IDs to the participant types.
+// StudentOnly has to be matched before Student.
+var userPrefixes = []struct {
+	prefix string
+	typ    string
+}{
+	{"Ucitel", ParticipantTeacher},
+	{"StudentOnly", ParticipantStudent},
+	{"Student", ParticipantStudent},
+	{"Rodic", ParticipantParent},
+}
+
+// Participant is a person taking part in a thread.
+type Participant struct {
+	// UserID is the edupage user ID, e.g. Ucitel201
+	UserID string `json:"userid"`
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+}
+
+// Participant resolves the edupage user ID, e.g. Ucitel201 or Rodic501, to the person in the DBI.
+// Returns false for IDs which don't belong to a person, e.g. classes, or people missing from the DBI.
+func (d *DBI) Participant(userID string) (Participant, bool) {
+	for _, p := range userPrefixes {
+		if !strings.HasPrefix(userID, p.prefix) {
+			continue
+		}
+
+		id := strings.TrimPrefix(userID, p.prefix)
+		participant := Participant{UserID: userID, ID: id, Type: p.typ}
+		switch p.typ {
+		case ParticipantTeacher:
+			teacher, ok := d.Teachers[id]
+			if !ok {
+				return participant, false
+			}
+			participant.Name = teacher.Firstname + " " + teacher.Lastname
+		case ParticipantStudent:
+			student, ok := d.Students[id]
+			if !ok {
+				return participant, false
+			}
+			participant.Name = student.Firstname + " " + student.Lastname
+		case ParticipantParent:
+			parent, ok := d.Parents[id]
+			if !ok {
+				return participant, false
+			}
+			participant.Name = parent.Firstname + " " + parent.Lastname
+		}
+		return participant, true
+	}
+	return Participant{UserID: userID}, false
+}
+
+// ThreadMessage is a message of a thread together with the replies to it, ordered from the oldest.
+type ThreadMessage struct {
+	TimelineItem
+	Replies []*ThreadMessage `json:"replies"`
+}
+
+// Thread is a conversation started by a message on the timeline.
+type Thread struct {
+	// ID is the ID of the root message
+	ID   string
+	Root *ThreadMessage
+	// Partial is set when the root is a reply itself, e.g. the message it replies to is older than the range of the timeline
+	Partial      bool
+	MessageCount int
+	// LastActivity is when the newest message of the thread was added
+	LastActivity time.Time
+}
+
+// Walk calls fn for every message of the thread, parents before their replies.
+func (t *Thread) Walk(fn func(message *ThreadMessage)) {
+	var walk func(message *ThreadMessage)
+	walk = func(message *ThreadMessage) {
+		fn(message)
+		for _, reply := range message.Replies {
+			walk(reply)
+		}
+	}
+	walk(t.Root)
+}
+
+// Participants returns the authors of the messages and the recipient of the root message, in the order they joined the thread.
+// People missing from the DBI are named by the timeline.
+func (t *Thread) Participants(dbi *DBI) []Participant {
+	participants := []Participant{}
+	seen := make(map[string]bool)
+	add := func(userID, name string) {
+		if userID == "" || seen[userID] {
+			return
+		}
+
+		participant, ok := dbi.Participant(userID)
+		if !ok {
+			// Recipients may be whole classes or groups, only people are participants
+			if participant.Type == "" {
+				return
+			}
+			participant.Name = name
+		}
+		seen[userID] = true
+		participants = append(participants, participant)
+	}
+
+	add(t.Root.Owner, t.Root.OwnerName)
+	add(t.Root.User, t.Root.UserName)
+	t.Walk(func(message *ThreadMessage) {
+		add(message.Owner, message.OwnerName)
+	})
+	return participants
+}
+
+// Threads builds the conversation trees of the messages on the timeline, the most recently active first.
+// Replies are nested under the message they reply to, at any depth.
+func (t *Timeline) Threads() []Thread {
+	messages := t.linkMessages()
+
+	threads := []Thread{}
+	for _, message := range messages {
+		if _, ok := messages[message.ReactionTo]; ok || message.Type != ItemTypeMessage {
+			continue
+		}
+		threads = append(threads, newThread(message))
+	}
+
+	sort.Slice(threads, func(i, j int) bool {
+		return threads[i].Before(&threads[j])
+	})
+	return threads
+}
+
+// Thread returns the thread started by the message with the ID, together with all replies to it.
+// The message doesn't have to be the root of its thread, the replies to a reply form a thread of their own.
+func (t *Timeline) Thread(id string) (Thread, bool) {
+	message, ok := t.linkMessages()[id]
+	if !ok {
+		return Thread{}, false
+	}
+	return newThread(message), true
+}
+
+// linkMessages wraps the timeline items as messages and appends every reply to the message it replies to.
+func (t *Timeline) linkMessages() map[string]*ThreadMessage {
+	messages := make(map[string]*ThreadMessage, len(t.Items))
+	for id, item := range t.Items {
+		messages[id] = &ThreadMessage{TimelineItem: item, Replies: []*ThreadMessage{}}
+	}
+
+	for _, message := range messages {
+		if parent, ok := messages[message.ReactionTo]; ok && message.ReactionTo != "" {
+			parent.Replies = append(parent.Replies, message)
+		}
+	}
+	return messages
+}
+
+func newThread(root *ThreadMessage) Thread {
+	thread := Thread{
+		ID:      root.ID,
+		Root:    root,
+		Partial: root.ReactionTo != "",
+	}
+
+	thread.Walk(func(message *ThreadMessage) {
+		sortMessages(message.Replies)
+		thread.MessageCount++
+		if message.TimeAdded.After(thread.LastActivity) {
+			thread.LastActivity = message.TimeAdded.Time
+		}
+	})
+	return thread
+}
+
+// Before reports whether the thread is ordered before the other one, by the last activity from the most recent and then by the ID.
+func (t *Thread) Before(other *Thread) bool {
+	if !t.LastActivity.Equal(other.LastActivity) {
+		return t.LastActivity.After(other.LastActivity)
+	}
+	return t.ID > other.ID
+}
+
+func sortMessages(messages []*ThreadMessage) {
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].TimeAdded.Equal(messages[j].TimeAdded.Time) {
+			return messages[i].TimeAdded.Before(messages[j].TimeAdded.Time)
+		}
+		return messages[i].ID < messages[j].ID
+	})
+}
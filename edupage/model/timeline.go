@@ -3,7 +3,7 @@ package model
 import (
 	"encoding/json"
 	"errors"
-	"reflect"
+	"fmt"
 
 	"golang.org/x/exp/maps"
 )
@@ -13,8 +13,12 @@ var (
 )
 
 var (
-	ItemTypeMessage  = "sprava"
-	ItemTypeHomework = "homework"
+	ItemTypeMessage      = "sprava"
+	ItemTypeHomework     = "homework"
+	ItemTypeGrade        = "znamka"
+	ItemTypeExcuse       = "ospravedlnenka"
+	ItemTypeEvent        = "event"
+	ItemTypeSubstitution = "substitution"
 )
 
 type TimelineItem struct {
@@ -40,33 +44,40 @@ type TimelineItem struct {
 	LastReactionBTC Time             `json:"cas_udalosti_btc"`
 }
 
+// TypedData decodes the payload of the item to the struct of its type, see TimelineData.
+func (i *TimelineItem) TypedData() (TimelineData, error) {
+	return DecodeTimelineData(i.Type, i.Data)
+}
+
+// GetAttachments returns the attachments of a message, mapping the file names to their urls.
 func (i *TimelineItem) GetAttachments() (map[string]string, error) {
-	if i.Type == ItemTypeMessage {
-		var attachments = make(map[string]string)
-		data := i.Data
-		if val, ok := data.Value["attachements"]; ok { // It's misspelled in the JSON payload
-			if reflect.TypeOf(val).Kind() == reflect.Map {
-				a := val.(map[string]interface{})
-				for k, v := range a {
-					attachments[v.(string)] = k
-				}
-			}
-		}
-		return attachments, nil
+	if i.Type != ItemTypeMessage {
+		return nil, ErrUnobtainableAttachments
+	}
+
+	data, err := i.TypedData()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnobtainableAttachments, err)
+	}
+
+	attachments := make(map[string]string)
+	for url, name := range data.(*MessageData).Attachments {
+		attachments[name] = url
 	}
-	return nil, ErrUnobtainableAttachments
+	return attachments, nil
 }
 
 func (i *TimelineItem) IsHomeworkWithAttachments() bool {
-	if i.Type == ItemTypeHomework {
-		if superid, ok := i.Data.Value["superid"]; ok && superid != nil && reflect.TypeOf(superid).Kind() == reflect.String {
-			if etc, ok := i.Data.Value["etestCards"]; ok && etc != nil && etc.(float64) == 1 {
-				return true
-			}
-		}
+	if i.Type != ItemTypeHomework {
+		return false
 	}
 
-	return false
+	data, err := i.TypedData()
+	if err != nil {
+		return false
+	}
+	homework := data.(*HomeworkData)
+	return homework.SuperID != "" && homework.ETestCards == 1
 }
 
 type Homework struct {
@@ -107,6 +118,15 @@ type Homework struct {
 	LessonName        string           `json:"predmet_meno"`
 }
 
+// TypedData decodes the payload of the homework.
+func (h *Homework) TypedData() (*HomeworkData, error) {
+	data, err := DecodeTimelineData(ItemTypeHomework, h.Data)
+	if err != nil {
+		return nil, err
+	}
+	return data.(*HomeworkData), nil
+}
+
 // Timeline contains all timeline information
 type Timeline struct {
 	Homeworks map[string]Homework
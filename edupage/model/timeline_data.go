@@ -0,0 +1,167 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// TimelineData is the typed payload of a timeline item, the concrete type is selected by the item type.
+// Items of types without a dedicated struct are decoded to UnknownData.
+type TimelineData interface {
+	ItemType() string
+}
+
+// Attachments maps the urls of the attachments to their file names.
+type Attachments map[string]string
+
+func (a *Attachments) UnmarshalJSON(b []byte) error {
+	// Edupage sends an empty array instead of an empty object
+	if string(b) == "[]" || string(b) == "null" || string(b) == `""` {
+		*a = Attachments{}
+		return nil
+	}
+
+	var v map[string]string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// VotingAnswer is an answer of a poll.
+type VotingAnswer struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// VotingParams are the parameters of a poll attached to a message.
+type VotingParams struct {
+	Answers  []VotingAnswer `json:"answers"`
+	Multiple Flag           `json:"multiple"`
+}
+
+func (p *VotingParams) UnmarshalJSON(b []byte) error {
+	// The params are sometimes stored as a stringified object
+	if len(b) > 0 && b[0] == '"' {
+		s, err := strconv.Unquote(string(b))
+		if err != nil {
+			return err
+		}
+		b = []byte(s)
+	}
+
+	type rawParams VotingParams
+	var raw rawParams
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*p = VotingParams(raw)
+	return nil
+}
+
+// MessageData is the payload of a message (sprava).
+type MessageData struct {
+	Text        string      `json:"messageContent"`
+	Attachments Attachments `json:"attachements"` // It's misspelled in the JSON payload
+	// Receipt is set when the recipients are asked to confirm they have read the message
+	Receipt              Flag          `json:"receipt"`
+	RepliesDisabled      Flag          `json:"repliesDisabled"`
+	RepliesToAllDisabled Flag          `json:"repliesToAllDisabled"`
+	Voting               *VotingParams `json:"votingParams,omitempty"`
+}
+
+func (MessageData) ItemType() string { return ItemTypeMessage }
+
+// HomeworkData is the payload of a homework.
+type HomeworkData struct {
+	Title       string      `json:"nazov"`
+	SubjectID   FlexString  `json:"predmetid"`
+	SuperID     FlexString  `json:"superid"`
+	ETestCards  FlexInt     `json:"etestCards"`
+	Attachments Attachments `json:"attachements"`
+}
+
+func (HomeworkData) ItemType() string { return ItemTypeHomework }
+
+// GradeData is the payload of a new grade (znamka).
+type GradeData struct {
+	Title     string     `json:"nazov"`
+	SubjectID FlexString `json:"predmetid"`
+	Grade     FlexString `json:"znamka"`
+	EventID   FlexString `json:"udalostid"`
+}
+
+func (GradeData) ItemType() string { return ItemTypeGrade }
+
+// ExcuseData is the payload of an absence excuse (ospravedlnenka).
+type ExcuseData struct {
+	StudentID FlexString `json:"studentid"`
+	DateFrom  string     `json:"datefrom"`
+	DateTo    string     `json:"dateto"`
+	Reason    string     `json:"dovod"`
+	State     string     `json:"stav"`
+}
+
+func (ExcuseData) ItemType() string { return ItemTypeExcuse }
+
+// EventData is the payload of a school event, e.g. a trip or a test.
+type EventData struct {
+	Name         string      `json:"name"`
+	DateFrom     string      `json:"datefrom"`
+	DateTo       string      `json:"dateto"`
+	TimeFrom     string      `json:"timefrom"`
+	TimeTo       string      `json:"timeto"`
+	ClassIDs     []string    `json:"classids"`
+	TeacherIDs   []string    `json:"teacherids"`
+	ClassroomIDs []string    `json:"classroomids"`
+	Attachments  Attachments `json:"attachements"`
+}
+
+func (EventData) ItemType() string { return ItemTypeEvent }
+
+// SubstitutionData is the payload of a change in the timetable.
+type SubstitutionData struct {
+	Date    string          `json:"date"`
+	ClassID FlexString      `json:"classid"`
+	Changes json.RawMessage `json:"zmeny,omitempty"`
+}
+
+func (SubstitutionData) ItemType() string { return ItemTypeSubstitution }
+
+// UnknownData is the payload of the item types without a dedicated struct.
+type UnknownData struct {
+	Type  string                 `json:"-"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (d UnknownData) ItemType() string { return d.Type }
+
+var timelineDataTypes = map[string]func() TimelineData{
+	ItemTypeMessage:      func() TimelineData { return &MessageData{} },
+	ItemTypeHomework:     func() TimelineData { return &HomeworkData{} },
+	ItemTypeGrade:        func() TimelineData { return &GradeData{} },
+	ItemTypeExcuse:       func() TimelineData { return &ExcuseData{} },
+	ItemTypeEvent:        func() TimelineData { return &EventData{} },
+	ItemTypeSubstitution: func() TimelineData { return &SubstitutionData{} },
+}
+
+// DecodeTimelineData decodes the payload of a timeline item of the type.
+func DecodeTimelineData(typ string, data StringJsonObject) (TimelineData, error) {
+	create, ok := timelineDataTypes[typ]
+	if !ok {
+		return &UnknownData{Type: typ, Value: data.Value}, nil
+	}
+
+	raw, err := json.Marshal(data.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := create()
+	if err := json.Unmarshal(raw, typed); err != nil {
+		return nil, fmt.Errorf("failed to decode %s data: %w", typ, err)
+	}
+	return typed, nil
+}
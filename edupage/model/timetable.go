@@ -2,6 +2,7 @@ package model
 
 import (
 	"encoding/json"
+	"errors"
 
 	"golang.org/x/exp/maps"
 )
@@ -34,6 +35,7 @@ func (t *Timetable) Merge(src *Timetable) {
 func ParseTimetable(data []byte) (Timetable, error) {
 	type Response struct {
 		Items []TimetableItem `json:"ttitems"`
+		Error string          `json:"error"`
 	}
 
 	type RawTimetable struct {
@@ -46,6 +48,9 @@ func ParseTimetable(data []byte) (Timetable, error) {
 	if err != nil {
 		return Timetable{}, err
 	}
+	if r.Response.Error != "" {
+		return Timetable{}, errors.New(r.Response.Error)
+	}
 
 	var t Timetable
 
@@ -2,6 +2,8 @@ package model
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -25,3 +27,53 @@ func (n *Time) UnmarshalJSON(b []byte) error {
 func (n *Time) MarshalJSON() ([]byte, error) {
 	return json.Marshal(n.Time.Format(TimeFormat))
 }
+
+// Flag is a boolean which edupage encodes as true, 1 or "1".
+type Flag bool
+
+func (f *Flag) UnmarshalJSON(b []byte) error {
+	switch strings.Trim(string(b), "\"") {
+	case "true", "1":
+		*f = true
+	default:
+		*f = false
+	}
+	return nil
+}
+
+// FlexString is a string which edupage sometimes encodes as a number, e.g. IDs.
+type FlexString string
+
+func (s *FlexString) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*s = ""
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var v string
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		*s = FlexString(v)
+		return nil
+	}
+	*s = FlexString(b)
+	return nil
+}
+
+// FlexInt is a number which edupage sometimes encodes as a string, an empty string is zero.
+type FlexInt int
+
+func (n *FlexInt) UnmarshalJSON(b []byte) error {
+	v := strings.Trim(string(b), "\"")
+	if v == "" || v == "null" {
+		*n = 0
+		return nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid number %s", b)
+	}
+	*n = FlexInt(i)
+	return nil
+}
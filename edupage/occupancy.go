@@ -0,0 +1,66 @@
+package edupage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+// occupancyConcurrency limits the timetables of the classes retrieved at the same time.
+const occupancyConcurrency = 4
+
+// GetOccupancy retrieves the timetables of all classes of the school in the specified interval from edupage,
+// and computes which classrooms and teachers are in use.
+// Return ErrorUnauthorized if an authorization error occcurs.
+func (client *EdupageClient) GetOccupancy(from, to time.Time) (model.Occupancy, error) {
+	return client.GetOccupancyContext(context.Background(), from, to)
+}
+
+// GetOccupancyContext works like GetOccupancy, the requests are cancelled together with the context.
+func (client *EdupageClient) GetOccupancyContext(ctx context.Context, from, to time.Time) (model.Occupancy, error) {
+	user, err := client.GetUserContext(ctx, false)
+	if err != nil {
+		return model.Occupancy{}, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		firstErr  error
+		occupancy = model.NewOccupancy()
+		limit     = make(chan struct{}, occupancyConcurrency)
+	)
+	for id := range user.DBI.Classes {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-limit }()
+
+			timetable, err := client.fetchTableTimetableModel(ctx, TableClasses, id, from, to)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to retrieve the timetable of the class %s: %w", id, err)
+					cancel()
+				}
+				return
+			}
+			occupancy.Add(timetable)
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return model.Occupancy{}, firstErr
+	}
+	return occupancy, nil
+}
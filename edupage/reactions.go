@@ -0,0 +1,251 @@
+package edupage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+// The reactions are checked against the item before they are sent, these errors are returned without contacting edupage.
+var (
+	ErrorRepliesDisabled = errors.New("replies to the item are disabled")
+	ErrorNoReceipt       = errors.New("the item doesn't request a read receipt")
+	ErrorNotPoll         = errors.New("the item is not a poll")
+	ErrorInvalidVote     = errors.New("invalid poll answers")
+	ErrorNotHomework     = errors.New("the item is not a homework")
+)
+
+// RefusedError is returned when edupage refuses a reaction, e.g. because the item has been removed in the meantime.
+type RefusedError struct {
+	// Action is the refused reaction, e.g. "reply" or "vote"
+	Action string
+	Status string
+	// Reason is the error message of edupage, it may be empty
+	Reason string
+}
+
+func (e *RefusedError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("edupage refused to %s (status %q)", e.Action, e.Status)
+	}
+	return fmt.Sprintf("edupage refused to %s: %s", e.Action, e.Reason)
+}
+
+// The types of the confirmations of timeline items.
+const (
+	confirmationReceipt = "receipt"
+	confirmationLike    = "like"
+	confirmationVote    = "vote"
+	confirmationDone    = "done"
+)
+
+type ReplyOptions struct {
+	Text string `json:"text"`
+	// ToAuthorOnly sends the reply only to the author of the item, instead of everyone who received it
+	ToAuthorOnly bool         `json:"toAuthorOnly,omitempty"`
+	Attachments  []Attachment `json:"attachments,omitempty"`
+}
+
+// Reply replies to the timeline item, returns the ID of the reply.
+// Returns ErrorRepliesDisabled if the author of the message has disabled replies.
+// Returns *RefusedError if edupage refuses the reply.
+func (client *EdupageClient) Reply(item model.TimelineItem, options ReplyOptions) (string, error) {
+	return client.ReplyContext(context.Background(), item, options)
+}
+
+// ReplyContext works like Reply, the request is cancelled together with the context.
+func (client *EdupageClient) ReplyContext(ctx context.Context, item model.TimelineItem, options ReplyOptions) (string, error) {
+	if message, ok := messageData(item); ok {
+		if message.RepliesDisabled {
+			return "", ErrorRepliesDisabled
+		}
+		// Edupage only delivers the replies to the author in this case
+		if message.RepliesToAllDisabled {
+			options.ToAuthorOnly = true
+		}
+	}
+
+	values := url.Values{
+		"typ":          {model.ItemTypeMessage},
+		"reakcia_na":   {item.ID},
+		"text":         {options.Text},
+		"receipt":      {"0"},
+		"attachements": {encodeAttachments(options.Attachments)},
+	}
+	if options.ToAuthorOnly {
+		values.Set("selectedUser", item.Owner)
+	}
+
+	changes, err := client.timelineAction(ctx, "reply", "createItem", values)
+	if err != nil {
+		return "", err
+	}
+	if len(changes) == 0 {
+		return "", &RefusedError{Action: "reply", Status: "nochanges"}
+	}
+
+	id, _ := changes[0]["timelineid"].(string)
+	return id, nil
+}
+
+// ConfirmReceipt confirms the message has been read, for messages which request a read receipt.
+// Returns ErrorNoReceipt if the message doesn't request one.
+// Returns *RefusedError if edupage refuses the confirmation.
+func (client *EdupageClient) ConfirmReceipt(item model.TimelineItem) error {
+	return client.ConfirmReceiptContext(context.Background(), item)
+}
+
+// ConfirmReceiptContext works like ConfirmReceipt, the request is cancelled together with the context.
+func (client *EdupageClient) ConfirmReceiptContext(ctx context.Context, item model.TimelineItem) error {
+	message, ok := messageData(item)
+	if !ok || !bool(message.Receipt) {
+		return ErrorNoReceipt
+	}
+	return client.confirm(ctx, "confirm receipt", item, confirmationReceipt, nil)
+}
+
+// Like likes the timeline item.
+// Returns *RefusedError if edupage refuses the like.
+func (client *EdupageClient) Like(item model.TimelineItem) error {
+	return client.LikeContext(context.Background(), item)
+}
+
+// LikeContext works like Like, the request is cancelled together with the context.
+func (client *EdupageClient) LikeContext(ctx context.Context, item model.TimelineItem) error {
+	return client.confirm(ctx, "like", item, confirmationLike, nil)
+}
+
+// Vote votes in the poll of the message, the answers are the IDs of the PollOptions.
+// Only a single answer is allowed, unless the poll allows multiple ones.
+// Returns ErrorNotPoll if the message has no poll, ErrorInvalidVote if the answers don't match the poll.
+// Returns *RefusedError if edupage refuses the vote.
+func (client *EdupageClient) Vote(item model.TimelineItem, answers []string) error {
+	return client.VoteContext(context.Background(), item, answers)
+}
+
+// VoteContext works like Vote, the request is cancelled together with the context.
+func (client *EdupageClient) VoteContext(ctx context.Context, item model.TimelineItem, answers []string) error {
+	message, ok := messageData(item)
+	if !ok || message.Voting == nil {
+		return ErrorNotPoll
+	}
+
+	if len(answers) == 0 || (len(answers) > 1 && !bool(message.Voting.Multiple)) {
+		return ErrorInvalidVote
+	}
+	valid := make(map[string]bool, len(message.Voting.Answers))
+	for _, answer := range message.Voting.Answers {
+		valid[answer.ID] = true
+	}
+	chosen := make(map[string]bool, len(answers))
+	for _, answer := range answers {
+		if !valid[answer] {
+			return fmt.Errorf("%w: unknown answer %s", ErrorInvalidVote, answer)
+		}
+		if chosen[answer] {
+			return fmt.Errorf("%w: answer %s chosen twice", ErrorInvalidVote, answer)
+		}
+		chosen[answer] = true
+	}
+
+	encoded, err := json.Marshal(answers)
+	if err != nil {
+		return err
+	}
+	return client.confirm(ctx, "vote", item, confirmationVote, url.Values{"answers": {string(encoded)}})
+}
+
+// MarkHomeworkDone marks the homework done, the item is the timeline item of the homework, see Timeline#HomeworkItem.
+// Returns ErrorNotHomework if the item isn't a homework.
+// Returns *RefusedError if edupage refuses the change.
+func (client *EdupageClient) MarkHomeworkDone(item model.TimelineItem) error {
+	return client.MarkHomeworkDoneContext(context.Background(), item)
+}
+
+// MarkHomeworkDoneContext works like MarkHomeworkDone, the request is cancelled together with the context.
+func (client *EdupageClient) MarkHomeworkDoneContext(ctx context.Context, item model.TimelineItem) error {
+	if item.Type != model.ItemTypeHomework {
+		return ErrorNotHomework
+	}
+	return client.confirm(ctx, "mark homework done", item, confirmationDone, nil)
+}
+
+// messageData decodes the payload of the item if it's a message.
+func messageData(item model.TimelineItem) (*model.MessageData, bool) {
+	if item.Type != model.ItemTypeMessage {
+		return nil, false
+	}
+	data, err := item.TypedData()
+	if err != nil {
+		return nil, false
+	}
+	return data.(*model.MessageData), true
+}
+
+// confirm creates a confirmation of the item, e.g. a like.
+func (client *EdupageClient) confirm(ctx context.Context, action string, item model.TimelineItem, typ string, values url.Values) error {
+	if values == nil {
+		values = url.Values{}
+	}
+	values.Set("timelineid", item.ID)
+	values.Set("confirmType", typ)
+
+	_, err := client.timelineAction(ctx, action, "createConfirmation", values)
+	return err
+}
+
+// timelineAction posts the form to the timeline action, returns the changes made by edupage.
+// Returns *RefusedError if edupage doesn't respond with the ok status.
+func (client *EdupageClient) timelineAction(ctx context.Context, action, akcia string, values url.Values) ([]map[string]interface{}, error) {
+	if client.Credentials.httpClient == nil {
+		return nil, errors.New("invalid credentials")
+	}
+
+	req, err := client.Credentials.newRequest(ctx, http.MethodPost, "/timeline/?akcia="+akcia, strings.NewReader(values.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new HTTP request: %s", err)
+	}
+	req.Header.Set("Accept", "application/json, text/javascript, */*; q=0.01")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+
+	resp, err := client.Credentials.do(req)
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %s", err)
+	}
+
+	var res struct {
+		Status  string                   `json:"status"`
+		Error   string                   `json:"error"`
+		Changes []map[string]interface{} `json:"changes"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("failed to parse response body: %s", err)
+	}
+
+	switch res.Status {
+	case "ok":
+		return res.Changes, nil
+	case "notlogged":
+		return nil, ErrorUnauthorized
+	default:
+		return nil, &RefusedError{Action: action, Status: res.Status, Reason: res.Error}
+	}
+}
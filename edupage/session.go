@@ -0,0 +1,78 @@
+package edupage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// Session is the serializable state of a logged in client.
+// It can be stored and later restored with RestoreClient, without the user's password.
+type Session struct {
+	Username     string            `json:"username"`
+	Server       string            `json:"server"`
+	PasswordHash string            `json:"passwordHash"`
+	GSecHash     string            `json:"gsechash"`
+	Cookies      map[string]string `json:"cookies"`
+}
+
+// ExportSession returns the session cookies and the gsechash of the client.
+func (client *EdupageClient) ExportSession() (Session, error) {
+	if client.Credentials.httpClient == nil || client.Credentials.httpClient.Jar == nil {
+		return Session{}, errors.New("invalid credentials")
+	}
+
+	cookies := make(map[string]string)
+	for _, cookie := range client.Credentials.httpClient.Jar.Cookies(client.Credentials.cookieURL()) {
+		cookies[cookie.Name] = cookie.Value
+	}
+
+	return Session{
+		Username:     client.Credentials.Username,
+		Server:       client.Credentials.Server,
+		PasswordHash: client.Credentials.PasswordHash,
+		GSecHash:     client.gsechash,
+		Cookies:      cookies,
+	}, nil
+}
+
+// cookieURL returns the url the session cookies are stored under.
+// The cookie jar uses the Host of the requests, which is always the edupage server.
+func (c *Credentials) cookieURL() *url.URL {
+	return &url.URL{Scheme: "https", Host: c.Server, Path: "/"}
+}
+
+// RestoreClient creates a client from an exported session and checks that the session is still alive.
+// Returns ErrorUnauthorized when the session has expired and the user has to log in again.
+func RestoreClient(ctx context.Context, session Session, options LoginOptions) (*EdupageClient, error) {
+	if session.Server == "" || len(session.Cookies) == 0 {
+		return nil, errors.New("invalid session")
+	}
+
+	credentials, err := newCredentials(session.Username, session.Server, options)
+	if err != nil {
+		return nil, err
+	}
+	credentials.PasswordHash = session.PasswordHash
+
+	cookies := make([]*http.Cookie, 0, len(session.Cookies))
+	for name, value := range session.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value, Path: "/"})
+	}
+	credentials.httpClient.Jar.SetCookies(credentials.cookieURL(), cookies)
+
+	client := &EdupageClient{
+		Credentials: credentials,
+		gsechash:    session.GSecHash,
+	}
+
+	// Fetching the user model also refreshes the gsechash
+	user, err := client.fetchUserModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client.user = &user
+
+	return client, nil
+}
@@ -0,0 +1,58 @@
+package edupage
+
+import (
+	"context"
+	"time"
+
+	"github.com/DislikesSchool/EduPage2-server/edupage/model"
+)
+
+// The tables of the timetables on edupage, the timetable of the user is in the students table.
+const (
+	TableStudents   = "students"
+	TableClasses    = "classes"
+	TableTeachers   = "teachers"
+	TableClassrooms = "classrooms"
+)
+
+// GetClassTimetable retrieves the timetable of the class in the specified interval from edupage.
+// Returns ErrorNotFound if the class isn't in the DBI of the school.
+func (client *EdupageClient) GetClassTimetable(id string, from, to time.Time) (model.Timetable, error) {
+	return client.GetClassTimetableContext(context.Background(), id, from, to)
+}
+
+// GetClassTimetableContext works like GetClassTimetable, the request is cancelled together with the context.
+func (client *EdupageClient) GetClassTimetableContext(ctx context.Context, id string, from, to time.Time) (model.Timetable, error) {
+	if _, err := client.GetClassByID(id); err != nil {
+		return model.Timetable{}, err
+	}
+	return client.fetchTableTimetableModel(ctx, TableClasses, id, from, to)
+}
+
+// GetTeacherTimetable retrieves the timetable of the teacher in the specified interval from edupage.
+// Returns ErrorNotFound if the teacher isn't in the DBI of the school.
+func (client *EdupageClient) GetTeacherTimetable(id string, from, to time.Time) (model.Timetable, error) {
+	return client.GetTeacherTimetableContext(context.Background(), id, from, to)
+}
+
+// GetTeacherTimetableContext works like GetTeacherTimetable, the request is cancelled together with the context.
+func (client *EdupageClient) GetTeacherTimetableContext(ctx context.Context, id string, from, to time.Time) (model.Timetable, error) {
+	if _, err := client.GetTeacherByID(id); err != nil {
+		return model.Timetable{}, err
+	}
+	return client.fetchTableTimetableModel(ctx, TableTeachers, id, from, to)
+}
+
+// GetClassroomTimetable retrieves the timetable of the classroom in the specified interval from edupage.
+// Returns ErrorNotFound if the classroom isn't in the DBI of the school.
+func (client *EdupageClient) GetClassroomTimetable(id string, from, to time.Time) (model.Timetable, error) {
+	return client.GetClassroomTimetableContext(context.Background(), id, from, to)
+}
+
+// GetClassroomTimetableContext works like GetClassroomTimetable, the request is cancelled together with the context.
+func (client *EdupageClient) GetClassroomTimetableContext(ctx context.Context, id string, from, to time.Time) (model.Timetable, error) {
+	if _, err := client.GetClassroomByID(id); err != nil {
+		return model.Timetable{}, err
+	}
+	return client.fetchTableTimetableModel(ctx, TableClassrooms, id, from, to)
+}